@@ -18,12 +18,13 @@ Attention:
 	- `Store` method is not safe for concurrent use and intent to use in
 	combination with `stat.ReportSubscription` component or synchronized externally
 	- if alerts from output channel won't be consumed this component will print them as
-	error report
+	error report, unless it is created as blocking traffic state
 */
 type TrafficState struct {
 	windowDurationInSeconds int64
 	reportsCycleInSeconds   int64
 	maxTrafficInWindow      uint64
+	blockOnFullRing         bool
 
 	requestsInWindow             uint64
 	lastReportCycleStartUnixTime int64
@@ -37,6 +38,24 @@ type TrafficState struct {
 func NewTrafficState(
 	windowDurationInSeconds uint64, reportsCycleInSeconds uint64,
 	maxAvgTrafficInReqPerSecond uint64, alertRingSize uint,
+) (*TrafficState, error) {
+	return newTrafficState(windowDurationInSeconds, reportsCycleInSeconds, maxAvgTrafficInReqPerSecond, alertRingSize, false)
+}
+
+/*
+Creates traffic state that never drops alerts, but blocks `Store` till the oldest alert is consumed.
+Intended for batch processing, where reports are produced much faster than alerts are consumed.
+*/
+func NewBlockingTrafficState(
+	windowDurationInSeconds uint64, reportsCycleInSeconds uint64,
+	maxAvgTrafficInReqPerSecond uint64, alertRingSize uint,
+) (*TrafficState, error) {
+	return newTrafficState(windowDurationInSeconds, reportsCycleInSeconds, maxAvgTrafficInReqPerSecond, alertRingSize, true)
+}
+
+func newTrafficState(
+	windowDurationInSeconds uint64, reportsCycleInSeconds uint64,
+	maxAvgTrafficInReqPerSecond uint64, alertRingSize uint, blockOnFullRing bool,
 ) (*TrafficState, error) {
 	slotsSize := windowDurationInSeconds / reportsCycleInSeconds
 	if slotsSize < 1 {
@@ -52,6 +71,7 @@ func NewTrafficState(
 		windowDurationInSeconds: int64(windowDurationInSeconds),
 		reportsCycleInSeconds:   int64(reportsCycleInSeconds),
 		maxTrafficInWindow:      maxAvgTrafficInReqPerSecond * windowDurationInSeconds,
+		blockOnFullRing:         blockOnFullRing,
 
 		requestsInWindow:             0,
 		lastReportCycleStartUnixTime: 0,
@@ -66,6 +86,13 @@ func (s *TrafficState) Alerts() <-chan TrafficAlert {
 	return s.alertsRing
 }
 
+/*
+Closes alerts output channel, when there will be no more reports to store.
+*/
+func (s *TrafficState) Close() {
+	close(s.alertsRing)
+}
+
 func (s *TrafficState) Store(report stat.Report) {
 	if s.reportsCycleInSeconds != report.CycleDurationInSeconds {
 		log.Error(
@@ -95,6 +122,7 @@ func (s *TrafficState) checkForAlertsViolation(report stat.Report) {
 	if s.requestsInWindow >= s.maxTrafficInWindow {
 		s.alertsCount++
 		s.current = &TrafficAlert{
+			Source:                   report.Source,
 			AlertID:                  s.alertsCount,
 			Resolved:                 false,
 			MaxAllowedRequests:       s.maxTrafficInWindow,
@@ -109,6 +137,7 @@ func (s *TrafficState) checkForAlertsViolation(report stat.Report) {
 		return
 	}
 	s.pushAlertToRing(TrafficAlert{
+		Source:                   report.Source,
 		AlertID:                  s.current.AlertID,
 		Resolved:                 true,
 		MaxAllowedRequests:       s.maxTrafficInWindow,
@@ -120,6 +149,10 @@ func (s *TrafficState) checkForAlertsViolation(report stat.Report) {
 }
 
 func (s *TrafficState) pushAlertToRing(a TrafficAlert) {
+	if s.blockOnFullRing {
+		s.alertsRing <- a
+		return
+	}
 	select {
 	case s.alertsRing <- a:
 	default:
@@ -1,6 +1,8 @@
 package alert
 
 type TrafficAlert struct {
+	// source of the report that triggered alert, empty if report was merged from several sources
+	Source                   string
 	AlertID                  uint64
 	Resolved                 bool
 	MaxAllowedRequests       uint64
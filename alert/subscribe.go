@@ -11,10 +11,12 @@ type alertsProvider interface {
 
 /*
 A component used broadcast alerts to multiple consumers.
+When alerts channel is closed, all alerts are delivered and `Done` channel is closed.
 */
 type AlertsSubscription struct {
 	reportProvider alertsProvider
 	listeners      []func(a TrafficAlert)
+	done           chan struct{}
 }
 
 func NewAlertsSubscription(reportProvider alertsProvider, listeners ...func(a TrafficAlert)) (*AlertsSubscription, error) {
@@ -24,12 +26,17 @@ func NewAlertsSubscription(reportProvider alertsProvider, listeners ...func(a Tr
 	if reportProvider.Alerts() == nil {
 		return nil, fmt.Errorf("alertsProvider alerts chan can't be nil")
 	}
-	result := &AlertsSubscription{reportProvider: reportProvider, listeners: listeners}
+	result := &AlertsSubscription{reportProvider: reportProvider, listeners: listeners, done: make(chan struct{})}
 	go result.run()
 	return result, nil
 }
 
+func (s *AlertsSubscription) Done() <-chan struct{} {
+	return s.done
+}
+
 func (s *AlertsSubscription) run() {
+	defer close(s.done)
 	if s.listeners == nil {
 		return
 	}
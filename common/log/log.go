@@ -31,6 +31,18 @@ func Error(format string, args ...interface{}) {
 	fmt.Println()
 }
 
+func Warn(format string, args ...interface{}) {
+	fmt.Print("[WARN] ")
+	fmt.Printf(format, args...)
+	fmt.Println()
+}
+
+func Info(format string, args ...interface{}) {
+	fmt.Print("[INFO] ")
+	fmt.Printf(format, args...)
+	fmt.Println()
+}
+
 var GlobalDebugEnabled = false
 
 func Debug(format string, args ...interface{}) {
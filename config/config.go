@@ -2,17 +2,60 @@ package config
 
 import (
 	"flag"
+	"fmt"
+	"runtime"
+	"strings"
 	"time"
 )
 
 type Config struct {
-	DebugMode bool
+	DebugMode             bool
+	BatchMode             bool
+	BatchParallelism      uint
+	BatchChunkSizeInBytes uint
 
-	FileName               string
-	FileReadBufSizeInBytes uint
-	FileReadPollPeriod     time.Duration
+	FileName                         string
+	FileNames                        []string
+	FileGlobRescanPeriod             time.Duration
+	SplitReportsBySource             bool
+	FileReadBufSizeInBytes           uint
+	FileMaxLineLength                uint
+	FileTruncateLongLines            bool
+	FileReadPollPeriod               time.Duration
+	FileUnterminatedLineFlushTimeout time.Duration
+	FileReadFromStart                bool
+	ReplayRotatedFiles               bool
 
+	Since time.Time
+	Until time.Time
+
+	CheckpointFileName string
+	CheckpointPeriod   time.Duration
+
+	SyslogListen          string
+	SyslogListenAddresses []string
+
+	FileWatchWithInotify          bool
+	FileInotifyFallbackPollPeriod time.Duration
+
+	LogFormat                        string
+	LogFormatDetectionLines          uint
+	LogFormatRedetectionErrorRate    float64
+	NginxLogFormat                   string
+	ApacheLogFormat                  string
+	JSONFieldMapping                 string
+	LogfmtFieldMapping               string
+	W3CExtendedDefaultFields         string
+	RegexLogFormat                   string
+	RegexTimeLayout                  string
+	RegexDurationUnit                string
 	W3CParserSectionsStringCacheSize uint
+	W3CParserTextParts               bool
+
+	SectionDepth        uint
+	SectionTemplate     string
+	SectionTemplates    []string
+	SectionPlaceholders bool
 
 	TrafficStatAggregationPeriodInSeconds uint64
 	TrafficStatAggregationCyclesRingSize  uint
@@ -28,20 +71,196 @@ func ParseFlagsAsConfig() Config {
 	c := Config{}
 
 	flag.BoolVar(&c.DebugMode, "debugMode", false, "enable debug mode")
+	flag.BoolVar(
+		&c.BatchMode, "batchMode", false,
+		"read log file from the start, print final reports and exit at the end of file. Useful for log playback. "+
+			"Files are read concurrently, so reports and alerts are always split by file, like with -splitReportsBySource",
+	)
+	flag.UintVar(
+		&c.BatchParallelism, "batchParallelism", uint(runtime.NumCPU()),
+		"amount of workers that parse chunks of file in parallel in batch mode. "+
+			"Not applied to streams, compressed and rotated files and with -since or -until",
+	)
+	flag.UintVar(
+		&c.BatchChunkSizeInBytes, "batchChunkSizeInBytes", 64*1024*1024,
+		"size of file chunks that are parsed in parallel in batch mode",
+	)
 
-	flag.StringVar(&c.FileName, "fileName", "/tmp/access.log", "log file to monitor")
+	flag.StringVar(
+		&c.FileName, "fileName", "/tmp/access.log",
+		"log files to monitor. Comma separated paths or glob patterns like /var/log/nginx/*.access.log. "+
+			"Use \"-\" to read from stdin, named pipes are read as streams too",
+	)
+	flag.DurationVar(
+		&c.FileGlobRescanPeriod, "fileGlobRescanPeriod", 10*time.Second,
+		"period of glob patterns rescan to pick up new files",
+	)
+	flag.BoolVar(
+		&c.SplitReportsBySource, "splitReportsBySource", false,
+		"aggregate reports and alerts separately for each file instead of merging them. "+
+			"Always enabled by -batchMode, because its files are read concurrently and their records can't be merged by time",
+	)
 	flag.UintVar(
 		&c.FileReadBufSizeInBytes, "fileReadBufSizeInBytes", 16*1024,
 		"size of buffer used to read lines from log",
 	)
+	flag.UintVar(
+		&c.FileMaxLineLength, "fileMaxLineLength", 1024*1024,
+		"max length of line in bytes, longer lines are skipped and counted as dropped. Zero means unlimited",
+	)
+	flag.BoolVar(
+		&c.FileTruncateLongLines, "fileTruncateLongLines", false,
+		"truncate lines longer than -fileMaxLineLength instead of skipping them",
+	)
 	flag.DurationVar(
 		&c.FileReadPollPeriod, "fileReadPollPeriod", 100*time.Millisecond,
 		"period of file poll in case when there is no new lines to read",
 	)
+	flag.DurationVar(
+		&c.FileUnterminatedLineFlushTimeout, "fileUnterminatedLineFlushTimeout", 5*time.Second,
+		"how long to wait for line ending of the last line in file before it is parsed as is. "+
+			"In batch mode the last line is parsed immediately",
+	)
+	flag.BoolVar(
+		&c.FileReadFromStart, "fromStart", false,
+		"read log file from the start instead of the end. Always enabled in batch mode",
+	)
+	flag.BoolVar(
+		&c.ReplayRotatedFiles, "replayRotatedFiles", false,
+		"read rotated files like access.log.2.gz and access.log.1 from the oldest to the newest before the file itself. "+
+			"Compressed files (.gz and .zst) are decompressed transparently, .zst requires zstd tool installed",
+	)
 
+	flag.Var(
+		&timeBoundValue{target: &c.Since}, "since",
+		"skip lines older than this time, the first line is found by binary search without reading the whole file. "+
+			"Accepts RFC3339 time like 2018-05-09T16:00:00Z, local time like \"2018-05-09 16:00\" or \"16:05\" today, "+
+			"or duration before now like 30m. Not applied to streams and rotated files",
+	)
+	flag.Var(
+		&timeBoundValue{target: &c.Until}, "until",
+		"stop reading file after the first line newer than this time, accepts the same formats as -since",
+	)
+
+	flag.StringVar(
+		&c.CheckpointFileName, "checkpointFileName", "",
+		"file to persist reading position, so restart resumes where it left off. Disabled if empty. "+
+			"Can't be used with -replayRotatedFiles, because rotation chain is always replayed from the start",
+	)
+	flag.DurationVar(
+		&c.CheckpointPeriod, "checkpointPeriod", 5*time.Second,
+		"period of reading position persistence",
+	)
+
+	flag.StringVar(
+		&c.SyslogListen, "syslogListen", "",
+		"comma separated addresses to receive syslog messages with log lines, like udp://:5514,tcp://:5514. "+
+			"If set, files are monitored only if -fileName is specified explicitly",
+	)
+
+	flag.BoolVar(
+		&c.FileWatchWithInotify, "fileWatchWithInotify", true,
+		"use inotify to get notified about file changes instead of polling. Falls back to polling if inotify is unavailable",
+	)
+	flag.DurationVar(
+		&c.FileInotifyFallbackPollPeriod, "fileInotifyFallbackPollPeriod", 10*time.Second,
+		"period of file poll in inotify mode, protects from notifications missed by some filesystems",
+	)
+
+	flag.StringVar(
+		&c.LogFormat, "logFormat", "common",
+		"format of log lines: common for Common Log Format, "+
+			"auto to detect one of the formats below by the first lines of each source, "+
+			"combined for Combined Log Format with referer and user agent, default for nginx, "+
+			"nginx for custom nginx format set by -nginxLogFormat, "+
+			"apache for custom Apache format set by -apacheLogFormat, "+
+			"json for JSON objects with keys set by -jsonFieldMapping, "+
+			"logfmt for logfmt lines with keys set by -logfmtFieldMapping, "+
+			"w3cExtended for W3C Extended Log File Format written by IIS, with columns set by #Fields directives, "+
+			"alb for AWS Application and Classic Load Balancer access logs, "+
+			"cloudfront for AWS CloudFront standard logs, "+
+			"haproxy for HAProxy HTTP log format, envoy for Envoy default access log format, "+
+			"or regex for any format described by -regexLogFormat",
+	)
+	flag.UintVar(
+		&c.LogFormatDetectionLines, "logFormatDetectionLines", 100,
+		"amount of the first lines of source that are parsed by all formats to detect format with -logFormat auto, "+
+			"also a window of lines that are checked for spike of parse errors after detection",
+	)
+	flag.Float64Var(
+		&c.LogFormatRedetectionErrorRate, "logFormatRedetectionErrorRate", 0.5,
+		"rate of parse errors in window of -logFormatDetectionLines lines, from 0 to 1, "+
+			"that starts detection of format again with -logFormat auto",
+	)
+	flag.StringVar(
+		&c.NginxLogFormat, "nginxLogFormat",
+		`$remote_addr - $remote_user [$time_local] "$request" $status $body_bytes_sent "$http_referer" "$http_user_agent"`,
+		"nginx log_format definition that is used with -logFormat nginx. "+
+			"Well-known variables, like $remote_addr, $time_local, $request or $status, are parsed, others are skipped",
+	)
+	flag.StringVar(
+		&c.ApacheLogFormat, "apacheLogFormat", `%h %l %u %t "%r" %>s %b "%{Referer}i" "%{User-agent}i"`,
+		"Apache LogFormat directive or its format string that is used with -logFormat apache. "+
+			"Well-known directives, like %h, %t, %r, %>s, %b or %D, are parsed, others are skipped",
+	)
+	flag.StringVar(
+		&c.JSONFieldMapping, "jsonFieldMapping", "time=time,status=status,path=path,method=method,bytes=bytes,duration=duration",
+		"mapping of record fields onto keys of JSON objects that is used with -logFormat json, like time=ts:ms,path=request.uri. "+
+			"Fields are time, status, path, method, host, user, protocol, bytes, referer, user_agent and duration. "+
+			"Time option is epoch unit s, ms, us, ns, or rfc3339 (default), clf or Go layout. "+
+			"Duration option is unit of numbers s (default), ms, us or ns",
+	)
+	flag.StringVar(
+		&c.LogfmtFieldMapping, "logfmtFieldMapping", "time=ts,method=method,path=path,status=status,bytes=bytes,duration=dur",
+		"mapping of record fields onto keys of logfmt lines that is used with -logFormat logfmt. "+
+			"It has the same syntax as -jsonFieldMapping",
+	)
+	flag.StringVar(
+		&c.W3CExtendedDefaultFields, "w3cExtendedDefaultFields",
+		"date time s-ip cs-method cs-uri-stem cs-uri-query s-port cs-username c-ip cs(User-Agent) cs(Referer) "+
+			"sc-status sc-substatus sc-win32-status time-taken",
+		"fields of lines that are used with -logFormat w3cExtended till the first #Fields directive, "+
+			"IIS default fields by default. Empty value means that lines before the first directive are rejected",
+	)
+	flag.StringVar(
+		&c.RegexLogFormat, "regexLogFormat",
+		`^(?P<client>\S+) \S+ (?P<user>\S+) \[(?P<time>[^\]]+)\] "(?P<request>[^"]*)" (?P<status>\d{3}) (?P<bytes>\S+)`,
+		"regular expression with named groups that is used with -logFormat regex, Common Log Format by default. "+
+			"Groups are the same as fields of -jsonFieldMapping, client is an alias of host, "+
+			"and request group, like \"GET /api HTTP/1.1\", is split into method, path and protocol",
+	)
+	flag.StringVar(
+		&c.RegexTimeLayout, "regexTimeLayout", "clf",
+		"layout of time group that is used with -logFormat regex: "+
+			"epoch unit s, ms, us, ns, or rfc3339, clf or Go layout, like \"2006-01-02 15:04:05\"",
+	)
+	flag.StringVar(
+		&c.RegexDurationUnit, "regexDurationUnit", "s",
+		"unit of duration group numbers that is used with -logFormat regex: s, ms, us or ns",
+	)
 	flag.UintVar(
 		&c.W3CParserSectionsStringCacheSize, "w3cParserSectionsStringCacheSize", 16*1024,
-		"size of cache that eliminates allocation of parsed `sections`. Make it bigger than estimated count of sections",
+		"size of caches that eliminate allocation of parsed `sections` and other text parts, like paths, methods, hosts and users. "+
+			"Make it bigger than estimated count of sections",
+	)
+	flag.BoolVar(
+		&c.W3CParserTextParts, "w3cParserTextParts", true,
+		"fill host, ident, user, method, path and protocol of records parsed with -logFormat common or combined. "+
+			"Disable it to parse only sections about twice as fast, paths are still parsed for custom sections",
+	)
+
+	flag.UintVar(
+		&c.SectionDepth, "sectionDepth", 1,
+		"amount of the first path segments that form section, like /api/user of /api/user/123 for depth 2",
+	)
+	flag.StringVar(
+		&c.SectionTemplate, "sectionTemplates", "",
+		"comma separated route templates, like /api/user/:id,/api/order/:id, paths that start with segments "+
+			"of template are counted as its section. Templates are matched in order, before -sectionDepth is applied",
+	)
+	flag.BoolVar(
+		&c.SectionPlaceholders, "sectionPlaceholders", false,
+		"replace numeric, UUID and long hex segments of sections with :id, :uuid and :hex placeholders",
 	)
 
 	flag.Uint64Var(
@@ -72,5 +291,89 @@ func ParseFlagsAsConfig() Config {
 	)
 
 	flag.Parse()
+	c.SyslogListenAddresses = splitList(c.SyslogListen)
+	c.SectionTemplates = splitList(c.SectionTemplate)
+	if len(c.SyslogListenAddresses) == 0 || isFlagSet("fileName") {
+		c.FileNames = splitList(c.FileName)
+	}
 	return c
 }
+
+/*
+Checks combinations of flags that can't work together.
+*/
+func (c Config) Validate() error {
+	if c.ReplayRotatedFiles && c.CheckpointFileName != "" {
+		return fmt.Errorf("-checkpointFileName can't be used with -replayRotatedFiles, " +
+			"rotation chain is replayed from the start and would be counted again after restart")
+	}
+	return nil
+}
+
+var timeBoundLayouts = []string{
+	time.RFC3339, "2006-01-02 15:04:05", "2006-01-02 15:04", "2006-01-02", "02/Jan/2006:15:04:05 -0700",
+}
+
+var timeOfDayLayouts = []string{"15:04:05", "15:04"}
+
+type timeBoundValue struct {
+	target *time.Time
+}
+
+func (v *timeBoundValue) String() string {
+	if v.target == nil || v.target.IsZero() {
+		return ""
+	}
+	return v.target.Format(time.RFC3339)
+}
+
+func (v *timeBoundValue) Set(value string) error {
+	bound, parseErr := parseTimeBound(value, time.Now())
+	if parseErr != nil {
+		return parseErr
+	}
+	*v.target = bound
+	return nil
+}
+
+func parseTimeBound(value string, now time.Time) (time.Time, error) {
+	value = strings.TrimSpace(value)
+	if ago, durationErr := time.ParseDuration(value); durationErr == nil {
+		return now.Add(-ago), nil
+	}
+	for _, layout := range timeBoundLayouts {
+		if bound, parseErr := time.ParseInLocation(layout, value, time.Local); parseErr == nil {
+			return bound, nil
+		}
+	}
+	for _, layout := range timeOfDayLayouts {
+		if timeOfDay, parseErr := time.Parse(layout, value); parseErr == nil {
+			return time.Date(
+				now.Year(), now.Month(), now.Day(),
+				timeOfDay.Hour(), timeOfDay.Minute(), timeOfDay.Second(), 0, now.Location(),
+			), nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("unknown time format: %v", value)
+}
+
+func splitList(list string) []string {
+	var result []string
+	for _, item := range strings.Split(list, ",") {
+		item = strings.TrimSpace(item)
+		if item != "" {
+			result = append(result, item)
+		}
+	}
+	return result
+}
+
+func isFlagSet(name string) bool {
+	result := false
+	flag.Visit(func(f *flag.Flag) {
+		if f.Name == name {
+			result = true
+		}
+	})
+	return result
+}
@@ -0,0 +1,204 @@
+package file
+
+import (
+	"fmt"
+	"github.com/storozhukBM/logstat/common/log"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+)
+
+type lineReadCloser interface {
+	ReadOneLineAsSlice() ([]byte, error)
+	LimitLineLength(maxLineLength uint, truncateLongLines bool)
+	DroppedLines() uint64
+	Close() error
+}
+
+/*
+A component used to replay rotation chain of the log file in chronological order,
+like `access.log.3.gz`, `access.log.2.zst`, `access.log.1` and then `access.log` itself.
+
+Responsibilities:
+	- find rotated files of the chain by their numeric suffix
+	- read rotated files one by one, transparently decompressing them
+	- read target file from the start after all rotated files,
+	so rotation of target file is handled the same way as in `Reader`
+
+Attention:
+	- `ReadOneLineAsSlice` returns a view to internal reading buffer, the same way as `Reader` does.
+	This view is only valid before the next `ReadOneLineAsSlice` call
+	- chain is determined only once during construction
+	- read error of corrupted or truncated rotated file is returned once, then reading goes on with the next file
+	- call `Close` function to free managed resources
+*/
+type ChainReader struct {
+	fileName      string
+	readerBufSize uint
+	rotatedFiles  []string
+
+	maxLineLength                uint
+	truncateLongLines            bool
+	unterminatedLineFlushTimeout time.Duration
+
+	currentIdx                  int
+	current                     lineReadCloser
+	droppedLinesOfFinishedFiles uint64
+}
+
+func NewRotationChainReader(fileName string, readerBufSize uint) (*ChainReader, error) {
+	if fileName == "" {
+		return nil, fmt.Errorf("fileName can't be empty")
+	}
+	rotatedFiles, chainErr := findRotationChain(fileName)
+	if chainErr != nil {
+		return nil, chainErr
+	}
+	log.Debug("rotation chain of file: %v; %v", fileName, rotatedFiles)
+	result := &ChainReader{
+		fileName:      fileName,
+		readerBufSize: readerBufSize,
+		rotatedFiles:  rotatedFiles,
+
+		unterminatedLineFlushTimeout: defaultUnterminatedLineFlushTimeout,
+	}
+	return result, nil
+}
+
+func (c *ChainReader) LimitLineLength(maxLineLength uint, truncateLongLines bool) {
+	c.maxLineLength = maxLineLength
+	c.truncateLongLines = truncateLongLines
+	if c.current != nil {
+		c.current.LimitLineLength(maxLineLength, truncateLongLines)
+	}
+}
+
+/*
+Sets flush timeout of unterminated line for the target file, rotated files are finished,
+so their unterminated lines are returned immediately.
+*/
+func (c *ChainReader) SetUnterminatedLineFlushTimeout(timeout time.Duration) {
+	c.unterminatedLineFlushTimeout = timeout
+	if reader, ok := c.current.(*Reader); ok {
+		reader.SetUnterminatedLineFlushTimeout(timeout)
+	}
+}
+
+/*
+Time when unterminated line at the end of the target file will be returned as is, zero for rotated files.
+*/
+func (c *ChainReader) UnterminatedLineFlushDeadline() time.Time {
+	if reader, ok := c.current.(*Reader); ok {
+		return reader.UnterminatedLineFlushDeadline()
+	}
+	return time.Time{}
+}
+
+func (c *ChainReader) DroppedLines() uint64 {
+	if c.current == nil {
+		return c.droppedLinesOfFinishedFiles
+	}
+	return c.droppedLinesOfFinishedFiles + c.current.DroppedLines()
+}
+
+func (c *ChainReader) Close() error {
+	if c.current == nil {
+		return nil
+	}
+	return c.current.Close()
+}
+
+func (c *ChainReader) ReadOneLineAsSlice() ([]byte, error) {
+	for {
+		if c.current == nil {
+			openErr := c.openCurrent()
+			if openErr != nil {
+				return nil, openErr
+			}
+		}
+		line, readErr := c.current.ReadOneLineAsSlice()
+		if readErr == nil || c.currentIdx == len(c.rotatedFiles) {
+			return line, readErr
+		}
+		if readErr != io.EOF {
+			// broken rotated file can't be read any further, so its error is reported once and the chain goes on
+			c.finishCurrentRotatedFile()
+			return nil, readErr
+		}
+		log.Debug("rotated file is finished: %v", c.rotatedFiles[c.currentIdx])
+		c.finishCurrentRotatedFile()
+	}
+}
+
+func (c *ChainReader) finishCurrentRotatedFile() {
+	log.OnError(c.current.Close, "can't Close file: %v", c.rotatedFiles[c.currentIdx])()
+	c.droppedLinesOfFinishedFiles += c.current.DroppedLines()
+	c.current = nil
+	c.currentIdx++
+}
+
+func (c *ChainReader) openCurrent() error {
+	if c.currentIdx == len(c.rotatedFiles) {
+		reader, readerErr := NewReader(c.fileName, c.readerBufSize, true)
+		if readerErr != nil {
+			return readerErr
+		}
+		reader.LimitLineLength(c.maxLineLength, c.truncateLongLines)
+		reader.SetUnterminatedLineFlushTimeout(c.unterminatedLineFlushTimeout)
+		c.current = reader
+		return nil
+	}
+	reader, readerErr := NewCompressedFileReader(c.rotatedFiles[c.currentIdx], c.readerBufSize)
+	if readerErr != nil {
+		// rotated file can be removed by logrotate, so we skip it
+		log.Error("can't read rotated file, it will be skipped: %v", readerErr)
+		c.currentIdx++
+		return c.openCurrent()
+	}
+	reader.LimitLineLength(c.maxLineLength, c.truncateLongLines)
+	c.current = reader
+	return nil
+}
+
+/*
+Returns rotated files of the chain from the oldest to the newest.
+*/
+func findRotationChain(fileName string) ([]string, error) {
+	dir := filepath.Dir(fileName)
+	rotatedPattern, patternErr := regexp.Compile(`^` + regexp.QuoteMeta(filepath.Base(fileName)) + `\.(\d+)(\.gz|\.zst)?$`)
+	if patternErr != nil {
+		return nil, patternErr
+	}
+	entries, dirErr := ioutil.ReadDir(dir)
+	if dirErr != nil {
+		return nil, fmt.Errorf("can't read directory of file: %v; error: %v", fileName, dirErr)
+	}
+	type rotatedFile struct {
+		name   string
+		number int
+	}
+	var rotatedFiles []rotatedFile
+	for _, entry := range entries {
+		match := rotatedPattern.FindStringSubmatch(entry.Name())
+		if entry.IsDir() || match == nil {
+			continue
+		}
+		number, numberErr := strconv.Atoi(match[1])
+		if numberErr != nil {
+			continue
+		}
+		rotatedFiles = append(rotatedFiles, rotatedFile{name: filepath.Join(dir, entry.Name()), number: number})
+	}
+	sort.Slice(rotatedFiles, func(i, j int) bool {
+		return rotatedFiles[i].number > rotatedFiles[j].number
+	})
+	result := make([]string, 0, len(rotatedFiles))
+	for _, f := range rotatedFiles {
+		result = append(result, f.name)
+	}
+	return result, nil
+}
@@ -0,0 +1,71 @@
+package file
+
+import (
+	"github.com/storozhukBM/logstat/common/log"
+	"github.com/storozhukBM/logstat/common/test"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRotationChainReader(t *testing.T) {
+	t.Parallel()
+	dir, dirErr := ioutil.TempDir("", "test_rotation_chain_reader")
+	test.FailOnError(t, dirErr)
+	defer os.RemoveAll(dir)
+	fileName := filepath.Join(dir, "access.log")
+
+	writeGzipFile(t, fileName+".10.gz", "line 1\n")
+	writeGzipFile(t, fileName+".2.gz", "line 2\nline 3\n")
+	test.FailOnError(t, ioutil.WriteFile(fileName+".1", []byte("line 4\n"), 0644))
+	test.FailOnError(t, ioutil.WriteFile(fileName, []byte("line 5\n"), 0644))
+	test.FailOnError(t, ioutil.WriteFile(fileName+".checkpoint", []byte("{}"), 0644))
+	test.FailOnError(t, ioutil.WriteFile(filepath.Join(dir, "other.log.1"), []byte("other\n"), 0644))
+
+	reader, readerErr := NewRotationChainReader(fileName, 0)
+	test.FailOnError(t, readerErr)
+	defer log.OnError(reader.Close, "can't close chain reader")
+
+	expectStreamLine(t, reader, "line 1")
+	expectStreamLine(t, reader, "line 2")
+	expectStreamLine(t, reader, "line 3")
+	expectStreamLine(t, reader, "line 4")
+	expectStreamLine(t, reader, "line 5")
+	expectStreamEOF(t, reader)
+
+	currentFile, openErr := os.OpenFile(fileName, os.O_APPEND|os.O_WRONLY, 0644)
+	test.FailOnError(t, openErr)
+	defer log.OnError(currentFile.Close, "can't close current file")
+	appendToFile(t, currentFile, []byte("line 6"))
+	expectStreamLine(t, reader, "line 6")
+	expectStreamEOF(t, reader)
+}
+
+func TestRotationChainReaderReportsBrokenRotatedFile(t *testing.T) {
+	t.Parallel()
+	dir, dirErr := ioutil.TempDir("", "test_rotation_chain_reader_broken")
+	test.FailOnError(t, dirErr)
+	defer os.RemoveAll(dir)
+	fileName := filepath.Join(dir, "access.log")
+
+	writeGzipFile(t, fileName+".2.gz", "line 1\nline 2\n")
+	gzipContent, readErr := ioutil.ReadFile(fileName + ".2.gz")
+	test.FailOnError(t, readErr)
+	test.FailOnError(t, ioutil.WriteFile(fileName+".2.gz", gzipContent[:len(gzipContent)-4], 0644))
+	test.FailOnError(t, ioutil.WriteFile(fileName+".1", []byte("line 3\n"), 0644))
+	test.FailOnError(t, ioutil.WriteFile(fileName, []byte("line 4\n"), 0644))
+
+	reader, readerErr := NewRotationChainReader(fileName, 0)
+	test.FailOnError(t, readerErr)
+	defer log.OnError(reader.Close, "can't close chain reader")
+
+	expectStreamLine(t, reader, "line 1")
+	expectStreamLine(t, reader, "line 2")
+	_, brokenErr := reader.ReadOneLineAsSlice()
+	test.Equals(t, io.ErrUnexpectedEOF, brokenErr, "truncated rotated file should be reported")
+	expectStreamLine(t, reader, "line 3")
+	expectStreamLine(t, reader, "line 4")
+	expectStreamEOF(t, reader)
+}
@@ -0,0 +1,118 @@
+package file
+
+import (
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+/*
+Device and inode pair that identifies file independently of its name.
+*/
+type fileIdentity struct {
+	Device uint64
+	Inode  uint64
+}
+
+/*
+Persistent reading position, used to resume reading after restart.
+Hash of the last read line is used to verify that file content wasn't replaced
+while inode stayed the same, for example by copytruncate rotation.
+*/
+type checkpoint struct {
+	Device         uint64 `json:"device"`
+	Inode          uint64 `json:"inode"`
+	Offset         int64  `json:"offset"`
+	LastLineLength int64  `json:"lastLineLength"`
+	LastLineHash   uint64 `json:"lastLineHash"`
+}
+
+func (c checkpoint) identity() fileIdentity {
+	return fileIdentity{Device: c.Device, Inode: c.Inode}
+}
+
+func loadCheckpoint(fileName string) (checkpoint, bool, error) {
+	content, readErr := ioutil.ReadFile(fileName)
+	if os.IsNotExist(readErr) {
+		return checkpoint{}, false, nil
+	}
+	if readErr != nil {
+		return checkpoint{}, false, readErr
+	}
+	result := checkpoint{}
+	unmarshalErr := json.Unmarshal(content, &result)
+	if unmarshalErr != nil {
+		return checkpoint{}, false, fmt.Errorf("can't parse checkpoint: %v; error: %v", fileName, unmarshalErr)
+	}
+	return result, true, nil
+}
+
+/*
+Writes checkpoint into temporary file and renames it, so checkpoint is never partially written.
+*/
+func saveCheckpoint(fileName string, c checkpoint) error {
+	content, marshalErr := json.Marshal(c)
+	if marshalErr != nil {
+		return marshalErr
+	}
+	tmpFileName := fileName + ".tmp"
+	writeErr := ioutil.WriteFile(tmpFileName, content, 0644)
+	if writeErr != nil {
+		return writeErr
+	}
+	return os.Rename(tmpFileName, fileName)
+}
+
+func hashLine(line []byte) uint64 {
+	h := fnv.New64a()
+	_, _ = h.Write(line)
+	return h.Sum64()
+}
+
+/*
+Verifies that line right before checkpoint offset is the same line that was read before restart.
+*/
+func verifyCheckpoint(file *os.File, c checkpoint) bool {
+	if c.LastLineLength == 0 {
+		return true
+	}
+	lastLineStart := c.Offset - c.LastLineLength
+	if lastLineStart < 0 {
+		return false
+	}
+	lastLine := make([]byte, c.LastLineLength)
+	_, readErr := file.ReadAt(lastLine, lastLineStart)
+	if readErr != nil {
+		return false
+	}
+	return hashLine(lastLine) == c.LastLineHash
+}
+
+/*
+Searches for the rotated file with specified identity among siblings of target file,
+like `access.log.1` or `access.log-20180509`.
+*/
+func findRotatedFile(fileName string, identity fileIdentity) (string, bool) {
+	if identity == (fileIdentity{}) {
+		return "", false
+	}
+	dir := filepath.Dir(fileName)
+	prefix := filepath.Base(fileName)
+	entries, dirErr := ioutil.ReadDir(dir)
+	if dirErr != nil {
+		return "", false
+	}
+	for _, entry := range entries {
+		if entry.IsDir() || entry.Name() == prefix || !strings.HasPrefix(entry.Name(), prefix) {
+			continue
+		}
+		if identityOf(entry) == identity {
+			return filepath.Join(dir, entry.Name()), true
+		}
+	}
+	return "", false
+}
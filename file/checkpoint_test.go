@@ -0,0 +1,123 @@
+package file
+
+import (
+	"github.com/storozhukBM/logstat/common/log"
+	"github.com/storozhukBM/logstat/common/test"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestCheckpointedReaderResume(t *testing.T) {
+	t.Parallel()
+	dir, dirErr := ioutil.TempDir("", "test_checkpointed_reader")
+	test.FailOnError(t, dirErr)
+	defer os.RemoveAll(dir)
+	fileName := filepath.Join(dir, "access.log")
+	checkpointFileName := filepath.Join(dir, "access.checkpoint")
+
+	logFile, logFileErr := os.Create(fileName)
+	test.FailOnError(t, logFileErr)
+	defer log.OnError(logFile.Close, "can't close log file")
+	appendToFile(t, logFile, []byte("first line"))
+
+	{
+		reader, readerErr := NewCheckpointedReader(fileName, 0, true, checkpointFileName, time.Hour)
+		test.FailOnError(t, readerErr)
+		expectLine(t, reader, "first line")
+		test.FailOnError(t, reader.Close())
+	}
+
+	appendToFile(t, logFile, []byte("second line"))
+	appendToFile(t, logFile, []byte("third line"))
+	{
+		reader, readerErr := NewCheckpointedReader(fileName, 0, true, checkpointFileName, time.Hour)
+		test.FailOnError(t, readerErr)
+		expectLine(t, reader, "second line")
+		test.FailOnError(t, reader.Close())
+	}
+	{
+		reader, readerErr := NewCheckpointedReader(fileName, 0, false, checkpointFileName, time.Hour)
+		test.FailOnError(t, readerErr)
+		expectLine(t, reader, "third line")
+		expectEOF(t, reader)
+		test.FailOnError(t, reader.Close())
+	}
+}
+
+func TestCheckpointedReaderFinishesRotatedFile(t *testing.T) {
+	t.Parallel()
+	dir, dirErr := ioutil.TempDir("", "test_checkpointed_reader_rotation")
+	test.FailOnError(t, dirErr)
+	defer os.RemoveAll(dir)
+	fileName := filepath.Join(dir, "access.log")
+	checkpointFileName := filepath.Join(dir, "access.checkpoint")
+
+	test.FailOnError(t, ioutil.WriteFile(fileName, []byte("first line\n"), 0644))
+	{
+		reader, readerErr := NewCheckpointedReader(fileName, 0, true, checkpointFileName, time.Hour)
+		test.FailOnError(t, readerErr)
+		expectLine(t, reader, "first line")
+		test.FailOnError(t, reader.Close())
+	}
+
+	rotatedFile, rotatedFileErr := os.OpenFile(fileName, os.O_APPEND|os.O_WRONLY, 0644)
+	test.FailOnError(t, rotatedFileErr)
+	appendToFile(t, rotatedFile, []byte("second line"))
+	test.FailOnError(t, rotatedFile.Close())
+	test.FailOnError(t, os.Rename(fileName, fileName+".1"))
+	test.FailOnError(t, ioutil.WriteFile(fileName, []byte("new first line\n"), 0644))
+
+	{
+		reader, readerErr := NewCheckpointedReader(fileName, 0, false, checkpointFileName, time.Hour)
+		test.FailOnError(t, readerErr)
+		expectLine(t, reader, "second line")
+		expectEOF(t, reader)
+		expectLine(t, reader, "new first line")
+		expectEOF(t, reader)
+		test.FailOnError(t, reader.Close())
+	}
+}
+
+func TestCheckpointedReaderDetectsReplacedContent(t *testing.T) {
+	t.Parallel()
+	dir, dirErr := ioutil.TempDir("", "test_checkpointed_reader_truncation")
+	test.FailOnError(t, dirErr)
+	defer os.RemoveAll(dir)
+	fileName := filepath.Join(dir, "access.log")
+	checkpointFileName := filepath.Join(dir, "access.checkpoint")
+
+	test.FailOnError(t, ioutil.WriteFile(fileName, []byte("first line\n"), 0644))
+	{
+		reader, readerErr := NewCheckpointedReader(fileName, 0, true, checkpointFileName, time.Hour)
+		test.FailOnError(t, readerErr)
+		expectLine(t, reader, "first line")
+		test.FailOnError(t, reader.Close())
+	}
+
+	// same inode, but truncated and rewritten, like after copytruncate rotation
+	test.FailOnError(t, ioutil.WriteFile(fileName, []byte("other line\nnext line\n"), 0644))
+	{
+		reader, readerErr := NewCheckpointedReader(fileName, 0, false, checkpointFileName, time.Hour)
+		test.FailOnError(t, readerErr)
+		expectLine(t, reader, "other line")
+		expectLine(t, reader, "next line")
+		expectEOF(t, reader)
+		test.FailOnError(t, reader.Close())
+	}
+}
+
+func expectLine(t *testing.T, reader *Reader, expLine string) {
+	line, lineErr := reader.ReadOneLineAsSlice()
+	test.FailOnError(t, lineErr)
+	test.Equals(t, []byte(expLine), line, "can't read line")
+}
+
+func expectEOF(t *testing.T, reader *Reader) {
+	line, lineErr := reader.ReadOneLineAsSlice()
+	test.Equals(t, []byte(nil), line, "line should be empty")
+	test.Equals(t, io.EOF, lineErr, "file should be empty now")
+}
@@ -0,0 +1,80 @@
+package file
+
+import (
+	"bufio"
+	"fmt"
+	"github.com/storozhukBM/logstat/common/log"
+	"io"
+	"os"
+)
+
+/*
+Part of file between two line endings, so it can be read independently from other parts.
+*/
+type Chunk struct {
+	Start int64
+	End   int64
+}
+
+/*
+Splits file into chunks of about `chunkSize` bytes, each chunk is extended till the end of its last line.
+*/
+func SplitIntoChunks(fileName string, chunkSize int64) ([]Chunk, error) {
+	if chunkSize < 1 {
+		return nil, fmt.Errorf("chunkSize should be at least 1")
+	}
+	file, fileOpenErr := os.Open(fileName)
+	if fileOpenErr != nil {
+		return nil, fmt.Errorf("can't open file: %+v. error happened: %+v", fileName, fileOpenErr)
+	}
+	defer log.OnError(file.Close, "can't Close file: %v", fileName)()
+	fileInfo, fileStatErr := file.Stat()
+	if fileStatErr != nil {
+		return nil, fileStatErr
+	}
+	size := fileInfo.Size()
+
+	var result []Chunk
+	start := int64(0)
+	for start < size {
+		end := start + chunkSize
+		if end >= size {
+			result = append(result, Chunk{Start: start, End: size})
+			break
+		}
+		// chunk ends right after line ending, that is located at `end - 1` or later
+		reader := bufio.NewReaderSize(io.NewSectionReader(file, end-1, size-end+1), minBufSize)
+		lineRestLength, _, readErr := readLinePrefix(reader)
+		if readErr != nil && readErr != io.EOF {
+			return nil, readErr
+		}
+		end += lineRestLength - 1
+		result = append(result, Chunk{Start: start, End: end})
+		start = end
+	}
+	return result, nil
+}
+
+/*
+Creates stream reader of the file chunk. Line length can be limited the same way as in `Reader`.
+*/
+func NewChunkReader(fileName string, chunk Chunk, readerBufSize uint) (*StreamReader, error) {
+	file, fileOpenErr := os.Open(fileName)
+	if fileOpenErr != nil {
+		return nil, fmt.Errorf("can't open file: %+v. error happened: %+v", fileName, fileOpenErr)
+	}
+	stream := &chunkStream{
+		file:          file,
+		SectionReader: io.NewSectionReader(file, chunk.Start, chunk.End-chunk.Start),
+	}
+	return NewStreamReader(fileName, stream, readerBufSize)
+}
+
+type chunkStream struct {
+	*io.SectionReader
+	file *os.File
+}
+
+func (s *chunkStream) Close() error {
+	return s.file.Close()
+}
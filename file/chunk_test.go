@@ -0,0 +1,54 @@
+package file
+
+import (
+	"github.com/storozhukBM/logstat/common/log"
+	"github.com/storozhukBM/logstat/common/test"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestSplitIntoChunks(t *testing.T) {
+	t.Parallel()
+	tmpFile, tmpFileErr := ioutil.TempFile("", "test_split_into_chunks")
+	test.FailOnError(t, tmpFileErr)
+	defer os.Remove(tmpFile.Name())
+	defer log.OnError(tmpFile.Close, "can't close tmp file")
+
+	var expLines []string
+	for i := 0; i < 300; i++ {
+		line := strings.Repeat("x", i%17)
+		expLines = append(expLines, line)
+		appendToFile(t, tmpFile, []byte(line))
+	}
+	_, writeErr := tmpFile.Write([]byte("unterminated"))
+	test.FailOnError(t, writeErr)
+	expLines = append(expLines, "unterminated")
+
+	for _, chunkSize := range []int64{1, 7, 64, 1000, 100000} {
+		chunks, chunksErr := SplitIntoChunks(tmpFile.Name(), chunkSize)
+		test.FailOnError(t, chunksErr)
+
+		var actLines []string
+		prevEnd := int64(0)
+		for _, chunk := range chunks {
+			test.Equals(t, prevEnd, chunk.Start, "chunks should be contiguous")
+			prevEnd = chunk.End
+			reader, readerErr := NewChunkReader(tmpFile.Name(), chunk, 0)
+			test.FailOnError(t, readerErr)
+			for {
+				line, readErr := reader.ReadOneLineAsSlice()
+				if readErr != nil {
+					break
+				}
+				actLines = append(actLines, string(line))
+			}
+			test.FailOnError(t, reader.Close())
+		}
+		test.Equals(t, expLines, actLines, "chunks should contain all lines of file in order. chunkSize: %v", chunkSize)
+	}
+
+	_, invalidSizeErr := SplitIntoChunks(tmpFile.Name(), 0)
+	test.Equals(t, true, invalidSizeErr != nil, "zero chunk size should be rejected")
+}
@@ -8,10 +8,17 @@ import (
 	"github.com/storozhukBM/logstat/common/log"
 	"io"
 	"os"
+	"time"
 )
 
 const minBufSize = 4 * 1024
 
+// time is checked only once per such amount of lines to keep hot path cheap
+const linesBetweenCheckpointTimeChecks = 1024
+
+// writer is expected to finish its line much faster
+const defaultUnterminatedLineFlushTimeout = 5 * time.Second
+
 /*
 A component used to read new lines from a file.
 Under load in the hot path, this file reader should work with almost zero allocations.
@@ -19,76 +26,182 @@ Under load in the hot path, this file reader should work with almost zero alloca
 Responsibilities:
 	- open file and Close target file
 	- track current reading offset
-	- detect that file was rotated and start from the beginning of the new file
+	- detect that file was rotated and start from the beginning of the new file.
+	Rename rotation is detected by device and inode of the file path, rotated file is read to its end
+	till the new file gets its first lines. Copytruncate rotation is detected by file size and content of the last read line
+	- return line only when its line ending is written, so half-written lines aren't parsed.
+	Unterminated line at the end of file is returned only after flush timeout
+	- start from the end of the file, or from the beginning if `fromStart` is specified
+	- if checkpoint file is specified, periodically persist reading position and resume from it after restart.
+	If file was rotated while reader was down, finish reading of the rotated file before switching to the new one
+	- if time range is specified, start from the first line not older than `since` and stop after `until`
 
 Attention:
 	- `ReadOneLineAsSlice` returns a view to internal reading buffer to avoid copying and pressure on GC. This view is only valid before the next
 	`ReadOneLineAsSlice` call. If you need some parts of it to remain accessible,
 	copy required parts
-	- call `Close` function to free managed resources
+	- call `Close` function to free managed resources and persist last checkpoint
 */
 type Reader struct {
 	fileName      string
 	readerBufSize uint
+	fromStart     bool
+
+	checkpointFileName string
+	checkpointPeriod   time.Duration
+
+	timeRange *timeRange
 
-	initialized          bool
-	endReached           bool
-	currentOffset        int64
-	currentFile          *os.File
-	currentReader        *bufio.Reader
-	overflowForLongLines *bytes.Buffer
+	initialized         bool
+	endReached          bool
+	draining            bool
+	currentOffset       int64
+	currentIdentity     fileIdentity
+	currentFile         *os.File
+	currentReader       *bufio.Reader
+	slicer              *lineSlicer
+	lastRawLineCopy     []byte
+	lastRawLineCheckBuf []byte
+
+	linesSinceCheckpoint int
+	lastCheckpointTime   time.Time
+	lastCheckpoint       checkpoint
 }
 
-func NewReader(fileName string, readerBufSize uint) (*Reader, error) {
+func NewReader(fileName string, readerBufSize uint, fromStart bool) (*Reader, error) {
 	if fileName == "" {
 		return nil, fmt.Errorf("fileName can't be empty")
 	}
 	result := &Reader{
-		fileName:             fileName,
-		readerBufSize:        cmp.MaxUInt(readerBufSize, minBufSize),
-		overflowForLongLines: bytes.NewBuffer(nil),
+		fileName:      fileName,
+		readerBufSize: cmp.MaxUInt(readerBufSize, minBufSize),
+		fromStart:     fromStart,
+		slicer:        newLineSlicer(fileName),
 
 		endReached: true,
 	}
+	result.slicer.waitForLineEndingsWithTimeout(defaultUnterminatedLineFlushTimeout)
 	return result, nil
 }
 
-func (f *Reader) Close() error {
-	if f.currentFile != nil {
-		return f.currentFile.Close()
+/*
+Creates reader that persists its position into `checkpointFileName` every `checkpointPeriod`,
+when end of file is reached and on `Close`. If checkpoint exists, reader resumes from it
+instead of starting from the end or the beginning of the file.
+*/
+func NewCheckpointedReader(
+	fileName string, readerBufSize uint, fromStart bool,
+	checkpointFileName string, checkpointPeriod time.Duration,
+) (*Reader, error) {
+	if checkpointFileName == "" {
+		return nil, fmt.Errorf("checkpointFileName can't be empty")
+	}
+	result, err := NewReader(fileName, readerBufSize, fromStart)
+	if err != nil {
+		return nil, err
+	}
+	result.checkpointFileName = checkpointFileName
+	result.checkpointPeriod = checkpointPeriod
+	return result, nil
+}
+
+/*
+Limits length of lines, so a single corrupted or never terminated line can't exhaust memory.
+Longer lines are skipped till the next line ending, or truncated if `truncateLongLines` is specified,
+and counted as dropped. Zero `maxLineLength` means that length isn't limited.
+*/
+func (f *Reader) LimitLineLength(maxLineLength uint, truncateLongLines bool) {
+	f.slicer.limitLineLength(maxLineLength, truncateLongLines)
+}
+
+/*
+Sets how long unterminated line at the end of file is kept, waiting for its line ending, before it is returned as is.
+Zero timeout means that such line is returned immediately, that is useful for files that aren't written anymore.
+*/
+func (f *Reader) SetUnterminatedLineFlushTimeout(timeout time.Duration) {
+	f.slicer.waitForLineEndingsWithTimeout(timeout)
+}
+
+/*
+Time when unterminated line at the end of file will be returned as is, if nothing is appended to it.
+Zero time means that there is no such line.
+*/
+func (f *Reader) UnterminatedLineFlushDeadline() time.Time {
+	return f.slicer.unterminatedLineFlushDeadline()
+}
+
+/*
+Limits lines by their time, zero `since` or `until` means that this bound isn't limited.
+Initially reader starts from the first line that isn't older than `since`, instead of the end or the beginning of the file,
+this line is found by binary search. After the first line newer than `until` reader reports only `io.EOF`.
+Checkpoint still takes precedence over `since`.
+*/
+func (f *Reader) LimitTimeRange(since time.Time, until time.Time, parseTime LineTimeParser) error {
+	if parseTime == nil {
+		return fmt.Errorf("parseTime can't be nil")
 	}
+	f.timeRange = &timeRange{since: since, until: until, parseTime: parseTime}
 	return nil
 }
 
+/*
+Count of too long lines that were skipped or truncated.
+*/
+func (f *Reader) DroppedLines() uint64 {
+	return f.slicer.droppedLines
+}
+
+func (f *Reader) Close() error {
+	if f.currentFile == nil {
+		return nil
+	}
+	checkpointErr := f.saveCheckpoint()
+	closeErr := f.currentFile.Close()
+	if checkpointErr != nil {
+		return fmt.Errorf("can't save checkpoint: %v", checkpointErr)
+	}
+	return closeErr
+}
+
 func (f *Reader) ReadOneLineAsSlice() ([]byte, error) {
+	if f.timeRange != nil && f.timeRange.untilPassed {
+		return nil, io.EOF
+	}
 	fileErr := f.prepareFileReadAndDetectRotation()
 	if fileErr != nil {
 		return nil, fileErr
 	}
-	f.overflowForLongLines.Reset()
-	returnOverflow := false
-	for {
-		line, isPrefix, readErr := f.currentReader.ReadLine()
-		if readErr != nil {
-			f.endReached = readErr == io.EOF
-			return nil, readErr
+	rawLine, consumed, readErr := f.slicer.readRawLine(f.currentReader)
+	f.currentOffset += int64(consumed)
+	if readErr == io.EOF {
+		if consumed > 0 {
+			// some part of too long line, or late line ending of flushed line, was skipped,
+			// so the last line isn't in front of the offset anymore
+			f.lastRawLineCopy = f.lastRawLineCopy[:0]
 		}
-		f.endReached = false
-
-		f.currentOffset += int64(len(line))
+		f.endReached = true
+		f.checkpointOnEndReached()
+		return nil, readErr
+	}
+	f.endReached = false
+	if readErr != nil {
+		return nil, readErr
+	}
 
-		if isPrefix {
-			log.Debug("using overflow buf: %v; bufSize: %v", f.fileName, f.overflowForLongLines.Cap())
-			f.overflowForLongLines.Write(line)
-			returnOverflow = true
-			continue
-		}
-		if returnOverflow {
-			f.overflowForLongLines.Write(line)
-			return f.overflowForLongLines.Bytes(), nil
-		}
-		return line, nil
+	if f.slicer.lastLineTruncated {
+		// truncated line doesn't match file content, so it can't be used for rotation checks and checkpoints
+		f.lastRawLineCopy = f.lastRawLineCopy[:0]
+	} else {
+		// line view will be invalidated by the next read, so we keep a copy for rotation checks and checkpoints
+		f.lastRawLineCopy = append(shrinkBuffer(f.lastRawLineCopy)[:0], rawLine...)
+	}
+	f.checkpointPeriodically()
+	line := dropLineEnding(rawLine)
+	if f.timeRange != nil && f.timeRange.isPassedBy(line) {
+		log.Debug("time range is passed: %v", f.fileName)
+		return nil, io.EOF
 	}
+	return line, nil
 }
 
 func (f *Reader) prepareFileReadAndDetectRotation() error {
@@ -99,21 +212,83 @@ func (f *Reader) prepareFileReadAndDetectRotation() error {
 	if !f.endReached {
 		return nil
 	}
+	pathInfo, pathStatErr := os.Stat(f.fileName)
+	fileWasRenamed := pathStatErr == nil && identityOf(pathInfo) != f.currentIdentity
+	if fileWasRenamed && !f.draining {
+		// writer can still append to the rotated file, so we should read it once again
+		log.Debug("file was renamed, going to read rotated file till the end: %v", f.fileName)
+		f.draining = true
+		return nil
+	}
+	if f.draining {
+		if pathStatErr != nil || pathInfo.Size() == 0 {
+			// writer didn't switch to the new file yet
+			return nil
+		}
+		size, fileErr := f.checkTargetFileSize()
+		if fileErr != nil {
+			return fileErr
+		}
+		if f.readOffset() < size {
+			// some lines were appended to the rotated file right before the switch
+			return nil
+		}
+		if f.slicer.unterminatedLineLength() > 0 {
+			// writer switched to the new file, so the last line of the rotated one won't be finished
+			f.slicer.flushUnterminatedLineOnNextRead()
+			return nil
+		}
+		log.Debug("rotated file is fully read, going to switch to the new one: %v", f.fileName)
+		return f.reopenFromStart()
+	}
+
 	size, fileErr := f.checkTargetFileSize()
 	if fileErr != nil {
 		return fileErr
 	}
-	fileWasRotated := f.currentOffset > size
-	if !fileWasRotated {
+	fileWasTruncated := f.readOffset() > size || !f.lastRawLineIsIntact()
+	if !fileWasTruncated {
 		return nil
 	}
-	log.Debug("file was rotated going to reopen: %v", f.fileName)
+	log.Debug("file was truncated going to reopen: %v", f.fileName)
+	return f.reopenFromStart()
+}
 
+/*
+Checks that the last read line is still in its place. If it isn't, file was truncated
+and new content already grew past the current offset.
+*/
+func (f *Reader) lastRawLineIsIntact() bool {
+	if len(f.lastRawLineCopy) == 0 {
+		return true
+	}
+	f.lastRawLineCheckBuf = shrinkBuffer(f.lastRawLineCheckBuf)
+	if cap(f.lastRawLineCheckBuf) < len(f.lastRawLineCopy) {
+		f.lastRawLineCheckBuf = make([]byte, len(f.lastRawLineCopy))
+	}
+	checkBuf := f.lastRawLineCheckBuf[:len(f.lastRawLineCopy)]
+	_, readErr := f.currentFile.ReadAt(checkBuf, f.currentOffset-int64(len(checkBuf)))
+	if readErr != nil {
+		return false
+	}
+	return bytes.Equal(checkBuf, f.lastRawLineCopy)
+}
+
+/*
+Offset of the file reader, it includes kept unterminated line, unlike the current offset.
+*/
+func (f *Reader) readOffset() int64 {
+	return f.currentOffset + int64(f.slicer.unterminatedLineLength())
+}
+
+func (f *Reader) reopenFromStart() error {
 	prevFile := f.currentFile
 	defer log.OnError(prevFile.Close, "can't Close file: %v", f.fileName)
 	f.currentOffset = 0
 	f.currentReader = nil
 	f.currentFile = nil
+	f.draining = false
+	f.lastRawLineCopy = f.lastRawLineCopy[:0]
 	reopenFileErr := f.openAndInitializeFile()
 	return reopenFileErr
 }
@@ -129,30 +304,120 @@ func (f *Reader) openAndInitializeFile() error {
 		return fmt.Errorf("can't open file: %+v. error happened: %+v", f.fileName, fileOpenErr)
 	}
 	log.Debug("opened file: %v", f.fileName)
-	f.currentFile = file
 	if f.initialized {
-		f.currentReader = bufio.NewReaderSize(file, int(f.readerBufSize))
 		log.Debug("open reader directly without seek: %v", f.fileName)
-		return nil
+		return f.useFile(file, 0)
+	}
+
+	if f.checkpointFileName != "" {
+		resumed, resumeErr := f.resumeFromCheckpoint(file)
+		if resumeErr != nil || resumed {
+			return resumeErr
+		}
+	}
+	if f.timeRange != nil && !f.timeRange.since.IsZero() {
+		return f.useFileSince(file)
+	}
+	if f.fromStart {
+		return f.useFile(file, 0)
 	}
 
 	// This watcher is newly created, so we should seek to the end of the file initially
-	size, fileErr := f.checkTargetFileSize()
-	if fileErr != nil {
-		return fileErr
+	fileInfo, fileStatErr := file.Stat()
+	if fileStatErr != nil {
+		log.OnError(file.Close, "can't Close file: %v", f.fileName)()
+		return fileStatErr
+	}
+	log.Debug("file size: %v", fileInfo.Size())
+	return f.useFile(file, fileInfo.Size())
+}
+
+func (f *Reader) useFileSince(file *os.File) error {
+	fileInfo, fileStatErr := file.Stat()
+	if fileStatErr != nil {
+		log.OnError(file.Close, "can't Close file: %v", f.fileName)()
+		return fileStatErr
+	}
+	offset, searchErr := f.timeRange.findSinceOffset(file, fileInfo.Size(), int(f.readerBufSize))
+	if searchErr != nil {
+		log.OnError(file.Close, "can't Close file: %v", f.fileName)()
+		return fmt.Errorf("can't find first line since: %v; file: %v; error: %v", f.timeRange.since, f.fileName, searchErr)
+	}
+	log.Debug("found first line since: %v; file: %v; offset: %v", f.timeRange.since, f.fileName, offset)
+	return f.useFile(file, offset)
+}
+
+/*
+Tries to find position saved in checkpoint. Takes ownership of the provided file.
+*/
+func (f *Reader) resumeFromCheckpoint(file *os.File) (bool, error) {
+	saved, found, loadErr := loadCheckpoint(f.checkpointFileName)
+	if loadErr != nil {
+		log.Error("can't load checkpoint, it will be ignored: %v", loadErr)
+		return false, nil
+	}
+	if !found {
+		log.Debug("there is no checkpoint: %v", f.checkpointFileName)
+		return false, nil
+	}
+	f.lastCheckpoint = saved
+
+	fileInfo, fileStatErr := file.Stat()
+	if fileStatErr != nil {
+		log.OnError(file.Close, "can't Close file: %v", f.fileName)()
+		return false, fileStatErr
 	}
-	log.Debug("file size: %v", size)
-	f.currentOffset = size
-	newOffset, seekErr := file.Seek(f.currentOffset, io.SeekStart)
+	if identityOf(fileInfo) == saved.identity() {
+		if verifyCheckpoint(file, saved) {
+			log.Debug("resume from checkpoint: %v; offset: %v", f.fileName, saved.Offset)
+			return true, f.useFile(file, saved.Offset)
+		}
+		log.Debug("file content was replaced, start from the beginning: %v", f.fileName)
+		return true, f.useFile(file, 0)
+	}
+
+	rotatedFileName, rotatedFound := findRotatedFile(f.fileName, saved.identity())
+	if !rotatedFound {
+		log.Error("file was rotated and rotated file can't be found, some lines can be lost: %v", f.fileName)
+		return true, f.useFile(file, 0)
+	}
+	rotatedFile, rotatedOpenErr := os.Open(rotatedFileName)
+	if rotatedOpenErr != nil || !verifyCheckpoint(rotatedFile, saved) {
+		if rotatedOpenErr == nil {
+			log.OnError(rotatedFile.Close, "can't Close file: %v", rotatedFileName)()
+		}
+		log.Error("rotated file can't be resumed, some lines can be lost: %v", rotatedFileName)
+		return true, f.useFile(file, 0)
+	}
+	log.OnError(file.Close, "can't Close file: %v", f.fileName)()
+	log.Debug("resume from rotated file: %v; offset: %v", rotatedFileName, saved.Offset)
+	f.draining = true
+	return true, f.useFile(rotatedFile, saved.Offset)
+}
+
+func (f *Reader) useFile(file *os.File, offset int64) error {
+	fileInfo, fileStatErr := file.Stat()
+	if fileStatErr != nil {
+		log.OnError(file.Close, "can't Close file: %v", f.fileName)()
+		return fileStatErr
+	}
+	newOffset, seekErr := file.Seek(offset, io.SeekStart)
 	if seekErr != nil {
-		return fmt.Errorf("can't seek to the current offset. file: %v; offset: %v", f.fileName, f.currentOffset)
+		log.OnError(file.Close, "can't Close file: %v", f.fileName)()
+		return fmt.Errorf("can't seek to the current offset. file: %v; offset: %v", f.fileName, offset)
 	}
 	log.Debug("seek new offset: %v", newOffset)
-	if newOffset != f.currentOffset {
-		return fmt.Errorf("offset missmatch. exp %v; act: %v", f.currentOffset, newOffset)
+	if newOffset != offset {
+		log.OnError(file.Close, "can't Close file: %v", f.fileName)()
+		return fmt.Errorf("offset missmatch. exp %v; act: %v", offset, newOffset)
 	}
 
+	f.currentFile = file
+	f.currentOffset = offset
+	f.currentIdentity = identityOf(fileInfo)
 	f.currentReader = bufio.NewReaderSize(file, int(f.readerBufSize))
+	f.slicer.reset()
+	f.endReached = false
 	f.initialized = true
 	return nil
 }
@@ -164,3 +429,53 @@ func (f *Reader) checkTargetFileSize() (int64, error) {
 	}
 	return fileInfo.Size(), nil
 }
+
+func (f *Reader) checkpointPeriodically() {
+	if f.checkpointFileName == "" {
+		return
+	}
+	f.linesSinceCheckpoint++
+	if f.linesSinceCheckpoint < linesBetweenCheckpointTimeChecks {
+		return
+	}
+	f.linesSinceCheckpoint = 0
+	if time.Since(f.lastCheckpointTime) < f.checkpointPeriod {
+		return
+	}
+	log.OnError(f.saveCheckpoint, "can't save checkpoint: %v", f.checkpointFileName)()
+}
+
+func (f *Reader) checkpointOnEndReached() {
+	if f.checkpointFileName == "" {
+		return
+	}
+	log.OnError(f.saveCheckpoint, "can't save checkpoint: %v", f.checkpointFileName)()
+}
+
+func (f *Reader) saveCheckpoint() error {
+	if f.checkpointFileName == "" || f.currentFile == nil {
+		return nil
+	}
+	current := checkpoint{
+		Device: f.currentIdentity.Device,
+		Inode:  f.currentIdentity.Inode,
+		Offset: f.currentOffset,
+	}
+	if len(f.lastRawLineCopy) > 0 {
+		current.LastLineLength = int64(len(f.lastRawLineCopy))
+		current.LastLineHash = hashLine(f.lastRawLineCopy)
+	} else if f.lastCheckpoint.identity() == current.identity() && f.lastCheckpoint.Offset == current.Offset {
+		// nothing was read since resume, so keep line from the previous checkpoint
+		current = f.lastCheckpoint
+	}
+	if current == f.lastCheckpoint {
+		return nil
+	}
+	f.lastCheckpointTime = time.Now()
+	saveErr := saveCheckpoint(f.checkpointFileName, current)
+	if saveErr != nil {
+		return saveErr
+	}
+	f.lastCheckpoint = current
+	return nil
+}
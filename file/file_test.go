@@ -7,6 +7,8 @@ import (
 	"io"
 	"io/ioutil"
 	"math/rand"
+	"os"
+	"path/filepath"
 	"testing"
 )
 
@@ -16,7 +18,7 @@ func TestFileReader(t *testing.T) {
 
 	tmpFile, tmpFileErr := ioutil.TempFile("", "test_file_reader")
 	test.FailOnError(t, tmpFileErr)
-	reader, readerErr := NewReader(tmpFile.Name(), lineBufSize)
+	reader, readerErr := NewReader(tmpFile.Name(), lineBufSize, false)
 	test.FailOnError(t, readerErr)
 	defer log.OnError(reader.Close, "can't close file reader")
 
@@ -83,6 +85,109 @@ func TestFileReader(t *testing.T) {
 	}
 }
 
+func TestFileReaderFromStart(t *testing.T) {
+	t.Parallel()
+	const lineBufSize = 16 * 1024
+
+	tmpFile, tmpFileErr := ioutil.TempFile("", "test_file_reader_from_start")
+	test.FailOnError(t, tmpFileErr)
+	appendToFile(t, tmpFile, []byte("first line"))
+	appendToFile(t, tmpFile, []byte("second line"))
+
+	reader, readerErr := NewReader(tmpFile.Name(), lineBufSize, true)
+	test.FailOnError(t, readerErr)
+	defer log.OnError(reader.Close, "can't close file reader")
+
+	{
+		line, lineErr := reader.ReadOneLineAsSlice()
+		test.Equals(t, []byte("first line"), line, "can't read line")
+		test.FailOnError(t, lineErr)
+	}
+	{
+		line, lineErr := reader.ReadOneLineAsSlice()
+		test.Equals(t, []byte("second line"), line, "can't read line")
+		test.FailOnError(t, lineErr)
+	}
+	{
+		line, lineErr := reader.ReadOneLineAsSlice()
+		test.Equals(t, []byte(nil), line, "line should be empty")
+		test.Equals(t, io.EOF, lineErr, "file should be empty now")
+	}
+
+	appendToFile(t, tmpFile, []byte("third line"))
+	{
+		line, lineErr := reader.ReadOneLineAsSlice()
+		test.Equals(t, []byte("third line"), line, "can't read line")
+		test.FailOnError(t, lineErr)
+	}
+}
+
+func TestFileReaderRenameRotation(t *testing.T) {
+	t.Parallel()
+	dir, dirErr := ioutil.TempDir("", "test_file_reader_rename_rotation")
+	test.FailOnError(t, dirErr)
+	defer os.RemoveAll(dir)
+	fileName := filepath.Join(dir, "access.log")
+
+	oldFile, oldFileErr := os.Create(fileName)
+	test.FailOnError(t, oldFileErr)
+	defer log.OnError(oldFile.Close, "can't close old file")
+	appendToFile(t, oldFile, []byte("first line"))
+
+	reader, readerErr := NewReader(fileName, 0, true)
+	test.FailOnError(t, readerErr)
+	defer log.OnError(reader.Close, "can't close file reader")
+	expectLine(t, reader, "first line")
+	expectEOF(t, reader)
+
+	test.FailOnError(t, os.Rename(fileName, fileName+".1"))
+	newFile, newFileErr := os.Create(fileName)
+	test.FailOnError(t, newFileErr)
+	defer log.OnError(newFile.Close, "can't close new file")
+
+	// writer still appends to the rotated file, and new file is empty
+	appendToFile(t, oldFile, []byte("old second line"))
+	expectLine(t, reader, "old second line")
+	expectEOF(t, reader)
+	expectEOF(t, reader)
+
+	// new file grows past the offset of rotated file
+	appendToFile(t, oldFile, []byte("old third line"))
+	appendToFile(t, newFile, []byte("new first line that is longer than everything in the rotated file"))
+	appendToFile(t, newFile, []byte("new second line"))
+	expectLine(t, reader, "old third line")
+	expectEOF(t, reader)
+	expectLine(t, reader, "new first line that is longer than everything in the rotated file")
+	expectLine(t, reader, "new second line")
+	expectEOF(t, reader)
+}
+
+func TestFileReaderCopyTruncateRotation(t *testing.T) {
+	t.Parallel()
+	tmpFile, tmpFileErr := ioutil.TempFile("", "test_file_reader_copytruncate")
+	test.FailOnError(t, tmpFileErr)
+	defer os.Remove(tmpFile.Name())
+	defer log.OnError(tmpFile.Close, "can't close file")
+
+	appendToFile(t, tmpFile, []byte("first line"))
+	reader, readerErr := NewReader(tmpFile.Name(), 0, true)
+	test.FailOnError(t, readerErr)
+	defer log.OnError(reader.Close, "can't close file reader")
+	expectLine(t, reader, "first line")
+	expectEOF(t, reader)
+
+	test.FailOnError(t, tmpFile.Truncate(0))
+	_, seekErr := tmpFile.Seek(0, io.SeekStart)
+	test.FailOnError(t, seekErr)
+	// new content grows past the previous offset before reader notices truncation
+	appendToFile(t, tmpFile, []byte("second line"))
+	appendToFile(t, tmpFile, []byte("third line"))
+
+	expectLine(t, reader, "second line")
+	expectLine(t, reader, "third line")
+	expectEOF(t, reader)
+}
+
 func appendToFile(t testing.TB, writer io.Writer, line []byte) {
 	_, err := writer.Write(line)
 	test.FailOnError(t, err)
@@ -0,0 +1,14 @@
+//go:build windows
+// +build windows
+
+package file
+
+import (
+	"os"
+)
+
+// there is no device and inode on windows, so all files are considered the same
+// and other checks like checkpoint line hash or file size are used instead
+func identityOf(info os.FileInfo) fileIdentity {
+	return fileIdentity{}
+}
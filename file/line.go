@@ -0,0 +1,263 @@
+package file
+
+import (
+	"bufio"
+	"bytes"
+	"github.com/storozhukBM/logstat/common/log"
+	"io"
+	"time"
+)
+
+// buffers that grew bigger than this after some long line are released
+const maxRetainedBufferSize = 64 * 1024
+
+/*
+A component used to slice raw lines, including line endings, from buffered reader.
+Line is returned as a view to reader buffer without copying, if it fits into the buffer.
+Longer lines are collected into overflow buffer.
+
+Responsibilities:
+	- slice lines from buffered reader
+	- if waiting for line endings is enabled, keep unterminated line at the end of data till its line ending arrives,
+	or till flush timeout, so half-written lines aren't returned
+	- swallow late line ending of unterminated line that was already returned, so it isn't read as an empty line
+	- skip or truncate lines longer than max line length, if it is specified, and count them as dropped
+	- shrink overflow buffer after huge lines, so memory is returned back
+
+Attention:
+	- returned line is valid only before the next `readRawLine` call
+	- bytes consumed from the reader can differ from the returned line length,
+	if some too long line was skipped or truncated, or if unterminated line is kept
+*/
+type lineSlicer struct {
+	name                 string
+	maxLineLength        int
+	truncateLongLines    bool
+	overflowForLongLines *bytes.Buffer
+
+	waitForLineEndings           bool
+	unterminatedLineFlushTimeout time.Duration
+	unterminatedLineSince        time.Time
+	keepingUnterminatedLine      bool
+	flushUnterminatedLine        bool
+	lastLineUnterminated         bool
+
+	skippingLongLine  bool
+	lastLineTruncated bool
+	droppedLines      uint64
+}
+
+func newLineSlicer(name string) *lineSlicer {
+	return &lineSlicer{
+		name:                 name,
+		overflowForLongLines: bytes.NewBuffer(nil),
+	}
+}
+
+/*
+Limits length of lines without line endings. Longer lines are skipped till the next line ending,
+or truncated if `truncateLongLines` is specified. Zero `maxLineLength` means that length isn't limited.
+*/
+func (s *lineSlicer) limitLineLength(maxLineLength uint, truncateLongLines bool) {
+	s.maxLineLength = int(maxLineLength)
+	s.truncateLongLines = truncateLongLines
+}
+
+/*
+Keeps unterminated line at the end of data till its line ending arrives, or till `flushTimeout` is passed.
+Without this, unterminated line is returned immediately, that is fine for finished files and streams.
+*/
+func (s *lineSlicer) waitForLineEndingsWithTimeout(flushTimeout time.Duration) {
+	s.waitForLineEndings = true
+	s.unterminatedLineFlushTimeout = flushTimeout
+}
+
+/*
+Returns the kept unterminated line on the next read, even if its flush timeout isn't passed yet.
+*/
+func (s *lineSlicer) flushUnterminatedLineOnNextRead() {
+	s.flushUnterminatedLine = true
+}
+
+/*
+Length of unterminated line that is kept till its line ending, these bytes are already consumed from reader.
+*/
+func (s *lineSlicer) unterminatedLineLength() int {
+	if !s.keepingUnterminatedLine {
+		return 0
+	}
+	return s.overflowForLongLines.Len()
+}
+
+/*
+Time when the kept unterminated line will be returned as is, zero if there is no such line.
+*/
+func (s *lineSlicer) unterminatedLineFlushDeadline() time.Time {
+	if !s.keepingUnterminatedLine || s.unterminatedLineSince.IsZero() {
+		return time.Time{}
+	}
+	return s.unterminatedLineSince.Add(s.unterminatedLineFlushTimeout)
+}
+
+/*
+Forgets the kept unterminated line and skipped line, should be used when reader switches to another file.
+*/
+func (s *lineSlicer) reset() {
+	s.overflowForLongLines.Reset()
+	s.keepingUnterminatedLine = false
+	s.flushUnterminatedLine = false
+	s.lastLineUnterminated = false
+	s.skippingLongLine = false
+}
+
+/*
+Returns raw line and amount of bytes consumed from the reader.
+Consumed bytes are returned even with error, because some part of too long line can be skipped before it.
+*/
+func (s *lineSlicer) readRawLine(reader *bufio.Reader) ([]byte, int, error) {
+	s.shrinkOverflow()
+	s.lastLineTruncated = false
+	consumed := 0
+	for {
+		if s.skippingLongLine {
+			skipped, skipErr := s.skipRestOfLongLine(reader)
+			consumed += skipped
+			if skipErr != nil {
+				return nil, consumed, skipErr
+			}
+		}
+		rawLine, lineConsumed, tooLong, readErr := s.readFullRawLine(reader)
+		consumed += lineConsumed
+		if readErr != nil {
+			return nil, consumed, readErr
+		}
+		afterUnterminatedLine := s.lastLineUnterminated
+		s.lastLineUnterminated = false
+		if !tooLong {
+			terminated := len(rawLine) > 0 && rawLine[len(rawLine)-1] == '\n'
+			if afterUnterminatedLine && terminated && len(dropLineEnding(rawLine)) == 0 {
+				// late line ending of the line that was already returned after flush timeout
+				continue
+			}
+			s.lastLineUnterminated = !terminated
+			return rawLine, consumed, nil
+		}
+		s.droppedLines++
+		if s.truncateLongLines {
+			log.Debug("too long line was truncated: %v", s.name)
+			s.lastLineTruncated = true
+			return rawLine, consumed, nil
+		}
+		log.Debug("too long line was skipped: %v", s.name)
+	}
+}
+
+/*
+Reads the whole line, or only its first `maxLineLength` bytes if it is too long.
+*/
+func (s *lineSlicer) readFullRawLine(reader *bufio.Reader) ([]byte, int, bool, error) {
+	returnOverflow := s.keepingUnterminatedLine
+	// kept bytes are reported as consumed only with the whole line
+	consumed := s.unterminatedLineLength()
+	if !s.keepingUnterminatedLine {
+		s.overflowForLongLines.Reset()
+	}
+	s.keepingUnterminatedLine = false
+	for {
+		rawLine, readErr := reader.ReadSlice('\n')
+		consumed += len(rawLine)
+		if readErr == bufio.ErrBufferFull {
+			overflowLen := s.overflowForLongLines.Len()
+			if s.isTooLong(overflowLen + len(rawLine)) {
+				s.overflowForLongLines.Write(rawLine[:s.maxLineLength-overflowLen])
+				s.skippingLongLine = true
+				return s.overflowForLongLines.Bytes(), consumed, true, nil
+			}
+			log.Debug("using overflow buf: %v; bufSize: %v", s.name, s.overflowForLongLines.Cap())
+			s.overflowForLongLines.Write(rawLine)
+			returnOverflow = true
+			continue
+		}
+		if readErr != nil && readErr != io.EOF {
+			return nil, consumed, false, readErr
+		}
+		if readErr == io.EOF && len(rawLine) == 0 && !returnOverflow {
+			return nil, consumed, false, io.EOF
+		}
+		if returnOverflow || readErr == io.EOF {
+			// unterminated line is copied, because it can be kept till the next read
+			s.overflowForLongLines.Write(rawLine)
+			rawLine = s.overflowForLongLines.Bytes()
+		}
+		line := dropLineEnding(rawLine)
+		if s.isTooLong(len(line)) {
+			// line without line ending can still be written, so its rest should be skipped later
+			s.skippingLongLine = readErr == io.EOF
+			s.unterminatedLineSince = time.Time{}
+			return line[:s.maxLineLength], consumed, true, nil
+		}
+		if readErr == io.EOF && !s.shouldFlushUnterminatedLine() {
+			s.keepingUnterminatedLine = true
+			return nil, 0, false, io.EOF
+		}
+		s.flushUnterminatedLine = false
+		s.unterminatedLineSince = time.Time{}
+		return rawLine, consumed, false, nil
+	}
+}
+
+func (s *lineSlicer) shouldFlushUnterminatedLine() bool {
+	if !s.waitForLineEndings || s.flushUnterminatedLine {
+		return true
+	}
+	if s.unterminatedLineSince.IsZero() {
+		s.unterminatedLineSince = time.Now()
+	}
+	return time.Since(s.unterminatedLineSince) >= s.unterminatedLineFlushTimeout
+}
+
+func (s *lineSlicer) skipRestOfLongLine(reader *bufio.Reader) (int, error) {
+	skipped := 0
+	for {
+		rawLine, readErr := reader.ReadSlice('\n')
+		skipped += len(rawLine)
+		if readErr == bufio.ErrBufferFull {
+			continue
+		}
+		if readErr != nil {
+			// line ending isn't written yet, we will continue to skip on the next read
+			return skipped, readErr
+		}
+		s.skippingLongLine = false
+		return skipped, nil
+	}
+}
+
+func (s *lineSlicer) isTooLong(lineLength int) bool {
+	return s.maxLineLength > 0 && lineLength > s.maxLineLength
+}
+
+func (s *lineSlicer) shrinkOverflow() {
+	if !s.keepingUnterminatedLine && s.overflowForLongLines.Cap() > maxRetainedBufferSize {
+		log.Debug("release overflow buf: %v; bufSize: %v", s.name, s.overflowForLongLines.Cap())
+		s.overflowForLongLines = bytes.NewBuffer(nil)
+	}
+}
+
+func shrinkBuffer(buf []byte) []byte {
+	if cap(buf) > maxRetainedBufferSize {
+		return nil
+	}
+	return buf
+}
+
+func dropLineEnding(rawLine []byte) []byte {
+	line := rawLine
+	if len(line) > 0 && line[len(line)-1] == '\n' {
+		line = line[:len(line)-1]
+	}
+	if len(line) > 0 && line[len(line)-1] == '\r' {
+		line = line[:len(line)-1]
+	}
+	return line
+}
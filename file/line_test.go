@@ -0,0 +1,159 @@
+package file
+
+import (
+	"bytes"
+	"github.com/storozhukBM/logstat/common/log"
+	"github.com/storozhukBM/logstat/common/test"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLineLengthLimit(t *testing.T) {
+	t.Parallel()
+	longLine := strings.Repeat("x", 3*minBufSize)
+	content := "short\nthis line is too long\r\n" + longLine + "\nlast"
+
+	skipReader, skipReaderErr := NewStreamReader("test", ioutil.NopCloser(bytes.NewBufferString(content)), 0)
+	test.FailOnError(t, skipReaderErr)
+	skipReader.LimitLineLength(10, false)
+	expectStreamLine(t, skipReader, "short")
+	expectStreamLine(t, skipReader, "last")
+	expectStreamEOF(t, skipReader)
+	test.Equals(t, uint64(2), skipReader.DroppedLines(), "too long lines should be dropped")
+
+	truncateReader, truncateReaderErr := NewStreamReader("test", ioutil.NopCloser(bytes.NewBufferString(content)), 0)
+	test.FailOnError(t, truncateReaderErr)
+	truncateReader.LimitLineLength(10, true)
+	expectStreamLine(t, truncateReader, "short")
+	expectStreamLine(t, truncateReader, "this line ")
+	expectStreamLine(t, truncateReader, "xxxxxxxxxx")
+	expectStreamLine(t, truncateReader, "last")
+	expectStreamEOF(t, truncateReader)
+	test.Equals(t, uint64(2), truncateReader.DroppedLines(), "too long lines should be counted")
+
+	unlimitedReader, unlimitedReaderErr := NewStreamReader("test", ioutil.NopCloser(bytes.NewBufferString(content)), 0)
+	test.FailOnError(t, unlimitedReaderErr)
+	expectStreamLine(t, unlimitedReader, "short")
+	expectStreamLine(t, unlimitedReader, "this line is too long")
+	expectStreamLine(t, unlimitedReader, longLine)
+	expectStreamLine(t, unlimitedReader, "last")
+	test.Equals(t, uint64(0), unlimitedReader.DroppedLines(), "lines shouldn't be dropped")
+}
+
+func TestFileReaderSkipsUnfinishedLongLine(t *testing.T) {
+	t.Parallel()
+	tmpFile, tmpFileErr := ioutil.TempFile("", "test_file_reader_long_line")
+	test.FailOnError(t, tmpFileErr)
+	defer os.Remove(tmpFile.Name())
+	defer log.OnError(tmpFile.Close, "can't close tmp file")
+
+	reader, readerErr := NewReader(tmpFile.Name(), 0, true)
+	test.FailOnError(t, readerErr)
+	defer log.OnError(reader.Close, "can't close file reader")
+	reader.LimitLineLength(2*minBufSize, false)
+
+	appendToFile(t, tmpFile, []byte("first line"))
+	_, writeErr := tmpFile.Write([]byte(strings.Repeat("x", 3*minBufSize)))
+	test.FailOnError(t, writeErr)
+	expectLine(t, reader, "first line")
+	expectEOF(t, reader)
+
+	// the rest of too long line is still skipped, and it isn't considered as truncation of file
+	appendToFile(t, tmpFile, []byte(strings.Repeat("x", minBufSize)))
+	appendToFile(t, tmpFile, []byte("second line"))
+	expectLine(t, reader, "second line")
+	expectEOF(t, reader)
+	test.Equals(t, uint64(1), reader.DroppedLines(), "too long line should be dropped")
+}
+
+func TestFileReaderKeepsUnterminatedLine(t *testing.T) {
+	t.Parallel()
+	tmpFile, tmpFileErr := ioutil.TempFile("", "test_file_reader_unterminated_line")
+	test.FailOnError(t, tmpFileErr)
+	defer os.Remove(tmpFile.Name())
+	defer log.OnError(tmpFile.Close, "can't close tmp file")
+
+	reader, readerErr := NewReader(tmpFile.Name(), 0, true)
+	test.FailOnError(t, readerErr)
+	defer log.OnError(reader.Close, "can't close file reader")
+	reader.SetUnterminatedLineFlushTimeout(time.Hour)
+
+	appendToFile(t, tmpFile, []byte("first line"))
+	_, writeErr := tmpFile.Write([]byte("half of "))
+	test.FailOnError(t, writeErr)
+	expectLine(t, reader, "first line")
+	expectEOF(t, reader)
+	test.Equals(t, int64(len("first line\n")), reader.currentOffset, "kept line shouldn't be counted in offset")
+
+	appendToFile(t, tmpFile, []byte("second line"))
+	expectLine(t, reader, "half of second line")
+	expectEOF(t, reader)
+
+	_, writeErr = tmpFile.Write([]byte("third line"))
+	test.FailOnError(t, writeErr)
+	expectEOF(t, reader)
+	reader.SetUnterminatedLineFlushTimeout(10 * time.Millisecond)
+	expectEOF(t, reader)
+	time.Sleep(20 * time.Millisecond)
+	expectLine(t, reader, "third line")
+	expectEOF(t, reader)
+
+	_, writeErr = tmpFile.Write([]byte("\r\n\nfourth line"))
+	test.FailOnError(t, writeErr)
+	reader.SetUnterminatedLineFlushTimeout(0)
+	// late line ending of already flushed line is swallowed, but the next empty line is still read
+	expectLine(t, reader, "")
+	expectLine(t, reader, "fourth line")
+	expectEOF(t, reader)
+
+	_, writeErr = tmpFile.Write([]byte("\n"))
+	test.FailOnError(t, writeErr)
+	expectEOF(t, reader)
+	fileInfo, statErr := tmpFile.Stat()
+	test.FailOnError(t, statErr)
+	test.Equals(t, fileInfo.Size(), reader.currentOffset, "swallowed line ending should be counted in offset")
+}
+
+func TestFileReaderUnterminatedLineFlushDeadline(t *testing.T) {
+	t.Parallel()
+	tmpFile, tmpFileErr := ioutil.TempFile("", "test_file_reader_unterminated_line_deadline")
+	test.FailOnError(t, tmpFileErr)
+	defer os.Remove(tmpFile.Name())
+	defer log.OnError(tmpFile.Close, "can't close tmp file")
+
+	reader, readerErr := NewReader(tmpFile.Name(), 0, true)
+	test.FailOnError(t, readerErr)
+	defer log.OnError(reader.Close, "can't close file reader")
+	reader.SetUnterminatedLineFlushTimeout(time.Minute)
+	test.Equals(t, time.Time{}, reader.UnterminatedLineFlushDeadline(), "there is no kept line yet")
+
+	_, writeErr := tmpFile.Write([]byte("unterminated"))
+	test.FailOnError(t, writeErr)
+	before := time.Now()
+	expectEOF(t, reader)
+	deadline := reader.UnterminatedLineFlushDeadline()
+	test.Equals(t, true, !deadline.Before(before.Add(time.Minute)), "deadline should be after flush timeout")
+	test.Equals(t, true, !deadline.After(time.Now().Add(time.Minute)), "deadline shouldn't be later than flush timeout")
+
+	appendToFile(t, tmpFile, []byte(" line"))
+	expectLine(t, reader, "unterminated line")
+	test.Equals(t, time.Time{}, reader.UnterminatedLineFlushDeadline(), "there is no kept line anymore")
+}
+
+func TestLineSlicerShrinksOverflow(t *testing.T) {
+	t.Parallel()
+	content := strings.Repeat("x", 4*maxRetainedBufferSize) + "\nshort\n"
+	reader, readerErr := NewStreamReader("test", ioutil.NopCloser(bytes.NewBufferString(content)), 0)
+	test.FailOnError(t, readerErr)
+
+	line, lineErr := reader.ReadOneLineAsSlice()
+	test.FailOnError(t, lineErr)
+	test.Equals(t, 4*maxRetainedBufferSize, len(line), "huge line should be read")
+	test.Equals(t, true, reader.slicer.overflowForLongLines.Cap() > maxRetainedBufferSize, "overflow should grow")
+
+	expectStreamLine(t, reader, "short")
+	test.Equals(t, true, reader.slicer.overflowForLongLines.Cap() <= maxRetainedBufferSize, "overflow should shrink")
+}
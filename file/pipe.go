@@ -0,0 +1,96 @@
+package file
+
+import (
+	"fmt"
+	"os"
+	"sync"
+)
+
+// file name used to read lines from standard input
+const StdinFileName = "-"
+
+/*
+Creates stream reader of standard input, if file name is `-`, or of the named pipe.
+Stream is opened lazily on the first read, because opening of named pipe blocks till some writer opens it.
+
+Attention:
+	- `Close` can be called concurrently with pending read to interrupt it,
+	this isn't possible only if standard input is a terminal
+	- `io.EOF` means that all writers closed the pipe, so there will be no more lines
+*/
+func NewPipeReader(fileName string, readerBufSize uint) (*StreamReader, error) {
+	if fileName == "" {
+		return nil, fmt.Errorf("fileName can't be empty")
+	}
+	return NewStreamReader(fileName, &pipeStream{fileName: fileName}, readerBufSize)
+}
+
+/*
+Checks if lines of file should be read as a stream, without offsets and rotation detection.
+*/
+func IsPipe(fileName string) bool {
+	if fileName == StdinFileName {
+		return true
+	}
+	info, statErr := os.Stat(fileName)
+	return statErr == nil && info.Mode()&os.ModeNamedPipe != 0
+}
+
+type pipeStream struct {
+	fileName string
+
+	lock   sync.Mutex
+	file   *os.File
+	closed bool
+}
+
+func (p *pipeStream) Read(buf []byte) (int, error) {
+	file, openErr := p.open()
+	if openErr != nil {
+		return 0, openErr
+	}
+	return file.Read(buf)
+}
+
+func (p *pipeStream) Close() error {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	if p.closed {
+		return nil
+	}
+	p.closed = true
+	if p.file != nil {
+		return p.file.Close()
+	}
+	if p.fileName != StdinFileName {
+		unblockPendingPipeOpen(p.fileName)
+	}
+	return nil
+}
+
+func (p *pipeStream) open() (*os.File, error) {
+	p.lock.Lock()
+	file, closed := p.file, p.closed
+	p.lock.Unlock()
+	if closed {
+		return nil, os.ErrClosed
+	}
+	if file != nil {
+		return file, nil
+	}
+
+	// lock isn't held here, so `Close` can interrupt open that waits for a writer
+	file, openErr := openPipe(p.fileName)
+	if openErr != nil {
+		return nil, fmt.Errorf("can't open pipe: %+v. error happened: %+v", p.fileName, openErr)
+	}
+
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	if p.closed {
+		_ = file.Close()
+		return nil, os.ErrClosed
+	}
+	p.file = file
+	return file, nil
+}
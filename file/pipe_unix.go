@@ -0,0 +1,41 @@
+//go:build !windows
+// +build !windows
+
+package file
+
+import (
+	"os"
+	"syscall"
+)
+
+func openPipe(fileName string) (*os.File, error) {
+	if fileName != StdinFileName {
+		// named pipe is registered in runtime poller, so `Close` will unblock pending `Read`
+		return os.Open(fileName)
+	}
+	info, statErr := os.Stdin.Stat()
+	if statErr != nil || info.Mode()&os.ModeNamedPipe == 0 {
+		// terminal or redirected regular file
+		return os.Stdin, nil
+	}
+	// descriptor is switched to non-blocking mode, so `os.NewFile` registers it in runtime poller
+	// and `Close` will unblock pending `Read`
+	nonBlockErr := syscall.SetNonblock(syscall.Stdin, true)
+	if nonBlockErr != nil {
+		return os.Stdin, nil
+	}
+	return os.NewFile(uintptr(syscall.Stdin), "/dev/stdin"), nil
+}
+
+/*
+Opening of named pipe for reading blocks till some writer opens it.
+Opening it for writing from our side releases pending open.
+*/
+func unblockPendingPipeOpen(fileName string) {
+	writer, openErr := os.OpenFile(fileName, os.O_WRONLY|syscall.O_NONBLOCK, 0)
+	if openErr != nil {
+		// there is no pending open
+		return
+	}
+	_ = writer.Close()
+}
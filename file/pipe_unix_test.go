@@ -0,0 +1,72 @@
+//go:build !windows
+// +build !windows
+
+package file
+
+import (
+	"github.com/storozhukBM/logstat/common/test"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestPipeReader(t *testing.T) {
+	t.Parallel()
+	dir, dirErr := ioutil.TempDir("", "test_pipe_reader")
+	test.FailOnError(t, dirErr)
+	defer os.RemoveAll(dir)
+	fileName := filepath.Join(dir, "access.pipe")
+	test.FailOnError(t, syscall.Mkfifo(fileName, 0644))
+	test.Equals(t, true, IsPipe(fileName), "named pipe should be detected")
+	test.Equals(t, true, IsPipe(StdinFileName), "stdin should be detected")
+	test.Equals(t, false, IsPipe(dir), "directory isn't a pipe")
+
+	reader, readerErr := NewPipeReader(fileName, 0)
+	test.FailOnError(t, readerErr)
+
+	go func() {
+		writer, openErr := os.OpenFile(fileName, os.O_WRONLY, 0)
+		if openErr != nil {
+			return
+		}
+		_, _ = writer.Write([]byte("first line\nsecond line\n"))
+		_ = writer.Close()
+	}()
+
+	expectStreamLine(t, reader, "first line")
+	expectStreamLine(t, reader, "second line")
+	expectStreamEOF(t, reader)
+	test.FailOnError(t, reader.Close())
+	test.FailOnError(t, reader.Close())
+}
+
+func TestPipeReaderCloseInterruptsRead(t *testing.T) {
+	t.Parallel()
+	dir, dirErr := ioutil.TempDir("", "test_pipe_reader_close")
+	test.FailOnError(t, dirErr)
+	defer os.RemoveAll(dir)
+	fileName := filepath.Join(dir, "access.pipe")
+	test.FailOnError(t, syscall.Mkfifo(fileName, 0644))
+
+	reader, readerErr := NewPipeReader(fileName, 0)
+	test.FailOnError(t, readerErr)
+
+	readDone := make(chan error)
+	go func() {
+		_, readErr := reader.ReadOneLineAsSlice()
+		readDone <- readErr
+	}()
+	// there is no writer, so read is blocked on pipe open
+	time.Sleep(50 * time.Millisecond)
+	test.FailOnError(t, reader.Close())
+
+	select {
+	case readErr := <-readDone:
+		test.Equals(t, true, readErr != nil, "read should be interrupted with error")
+	case <-time.After(5 * time.Second):
+		t.Fatal("read wasn't interrupted by close")
+	}
+}
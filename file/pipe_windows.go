@@ -0,0 +1,18 @@
+//go:build windows
+// +build windows
+
+package file
+
+import (
+	"os"
+)
+
+func openPipe(fileName string) (*os.File, error) {
+	if fileName == StdinFileName {
+		return os.Stdin, nil
+	}
+	return os.Open(fileName)
+}
+
+func unblockPendingPipeOpen(fileName string) {
+}
@@ -0,0 +1,191 @@
+package file
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"github.com/storozhukBM/logstat/common/cmp"
+	"github.com/storozhukBM/logstat/common/log"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+/*
+A component used to read lines from a stream, like decompressed rotated log file.
+Under load in the hot path, this reader should work with almost zero allocations.
+
+Responsibilities:
+	- read lines from the stream
+	- report `io.EOF` when the stream is finished
+	- Close underlying stream
+
+Attention:
+	- `ReadOneLineAsSlice` returns a view to internal reading buffer, the same way as `Reader` does.
+	This view is only valid before the next `ReadOneLineAsSlice` call
+	- there are no offsets and rotation detection for streams
+	- line length can be limited the same way as in `Reader`
+	- call `Close` function to free managed resources
+*/
+type StreamReader struct {
+	name   string
+	stream io.ReadCloser
+	reader *bufio.Reader
+	slicer *lineSlicer
+}
+
+func NewStreamReader(name string, stream io.ReadCloser, readerBufSize uint) (*StreamReader, error) {
+	if stream == nil {
+		return nil, fmt.Errorf("stream can't be nil")
+	}
+	result := &StreamReader{
+		name:   name,
+		stream: stream,
+		reader: bufio.NewReaderSize(stream, int(cmp.MaxUInt(readerBufSize, minBufSize))),
+		slicer: newLineSlicer(name),
+	}
+	return result, nil
+}
+
+/*
+Creates stream reader of the file that transparently decompresses `.gz` and `.zst` files.
+Files with other extensions are read as is.
+Zstandard is decompressed by external `zstd` tool, so it should be installed.
+Corrupted or truncated archives are reported as read errors instead of `io.EOF`.
+*/
+func NewCompressedFileReader(fileName string, readerBufSize uint) (*StreamReader, error) {
+	stream, streamErr := openDecompressedStream(fileName)
+	if streamErr != nil {
+		return nil, streamErr
+	}
+	return NewStreamReader(fileName, stream, readerBufSize)
+}
+
+func IsCompressedFileName(fileName string) bool {
+	return strings.HasSuffix(fileName, ".gz") || strings.HasSuffix(fileName, ".zst")
+}
+
+func (s *StreamReader) LimitLineLength(maxLineLength uint, truncateLongLines bool) {
+	s.slicer.limitLineLength(maxLineLength, truncateLongLines)
+}
+
+func (s *StreamReader) DroppedLines() uint64 {
+	return s.slicer.droppedLines
+}
+
+func (s *StreamReader) Close() error {
+	return s.stream.Close()
+}
+
+func (s *StreamReader) ReadOneLineAsSlice() ([]byte, error) {
+	rawLine, _, readErr := s.slicer.readRawLine(s.reader)
+	if readErr != nil {
+		return nil, readErr
+	}
+	return dropLineEnding(rawLine), nil
+}
+
+func openDecompressedStream(fileName string) (io.ReadCloser, error) {
+	if strings.HasSuffix(fileName, ".zst") {
+		return openZstdStream(fileName)
+	}
+	file, fileOpenErr := os.Open(fileName)
+	if fileOpenErr != nil {
+		return nil, fmt.Errorf("can't open file: %+v. error happened: %+v", fileName, fileOpenErr)
+	}
+	if !strings.HasSuffix(fileName, ".gz") {
+		return file, nil
+	}
+	gzipReader, gzipErr := gzip.NewReader(file)
+	if gzipErr != nil {
+		log.OnError(file.Close, "can't Close file: %v", fileName)()
+		return nil, fmt.Errorf("can't read gzip file: %v; error: %v", fileName, gzipErr)
+	}
+	return &gzipStream{file: file, Reader: gzipReader}, nil
+}
+
+func openZstdStream(fileName string) (io.ReadCloser, error) {
+	return startCommandStream(fileName, exec.Command("zstd", "--decompress", "--stdout", "--quiet", fileName))
+}
+
+func startCommandStream(name string, cmd *exec.Cmd) (io.ReadCloser, error) {
+	stdout, pipeErr := cmd.StdoutPipe()
+	if pipeErr != nil {
+		return nil, pipeErr
+	}
+	stderr := bytes.NewBuffer(nil)
+	cmd.Stderr = stderr
+	startErr := cmd.Start()
+	if startErr != nil {
+		return nil, fmt.Errorf("can't start %v to decompress file: %v; error: %v", filepath.Base(cmd.Path), name, startErr)
+	}
+	return &commandStream{name: name, cmd: cmd, stderr: stderr, ReadCloser: stdout}, nil
+}
+
+type gzipStream struct {
+	*gzip.Reader
+	file *os.File
+}
+
+func (s *gzipStream) Close() error {
+	gzipErr := s.Reader.Close()
+	fileErr := s.file.Close()
+	if gzipErr != nil {
+		return gzipErr
+	}
+	return fileErr
+}
+
+/*
+Output of the external decompression process.
+Exit status of the process is checked when its output is finished,
+so broken input is reported as read error instead of `io.EOF`.
+*/
+type commandStream struct {
+	io.ReadCloser
+	name   string
+	cmd    *exec.Cmd
+	stderr *bytes.Buffer
+
+	finished  bool
+	finishErr error
+}
+
+func (s *commandStream) Read(p []byte) (int, error) {
+	if s.finished {
+		return 0, s.finishErr
+	}
+	n, readErr := s.ReadCloser.Read(p)
+	if readErr != io.EOF {
+		return n, readErr
+	}
+	// output is fully read, so we can wait for the process and its exit status
+	s.finished = true
+	s.finishErr = io.EOF
+	waitErr := s.cmd.Wait()
+	if waitErr != nil {
+		s.finishErr = fmt.Errorf(
+			"can't decompress file: %v; error: %v; %v", s.name, waitErr, strings.TrimSpace(s.stderr.String()),
+		)
+	}
+	return n, s.finishErr
+}
+
+func (s *commandStream) Close() error {
+	if s.finished {
+		// exit status is already reported by `Read`
+		return nil
+	}
+	// process can be still running if stream wasn't read till the end
+	_ = s.cmd.Process.Kill()
+	_ = s.ReadCloser.Close()
+	waitErr := s.cmd.Wait()
+	if exitErr, ok := waitErr.(*exec.ExitError); ok && !exitErr.Exited() {
+		// process was killed by us
+		return nil
+	}
+	return waitErr
+}
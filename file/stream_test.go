@@ -0,0 +1,147 @@
+package file
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"github.com/storozhukBM/logstat/common/log"
+	"github.com/storozhukBM/logstat/common/test"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestStreamReader(t *testing.T) {
+	t.Parallel()
+	content := "first line\r\nsecond line\n\nlast line without line ending"
+	reader, readerErr := NewStreamReader("test", ioutil.NopCloser(bytes.NewBufferString(content)), 0)
+	test.FailOnError(t, readerErr)
+	defer log.OnError(reader.Close, "can't close stream reader")
+
+	expectStreamLine(t, reader, "first line")
+	expectStreamLine(t, reader, "second line")
+	expectStreamLine(t, reader, "")
+	expectStreamLine(t, reader, "last line without line ending")
+	expectStreamEOF(t, reader)
+}
+
+func TestCompressedFileReaderGzip(t *testing.T) {
+	t.Parallel()
+	dir, dirErr := ioutil.TempDir("", "test_compressed_file_reader_gzip")
+	test.FailOnError(t, dirErr)
+	defer os.RemoveAll(dir)
+	fileName := filepath.Join(dir, "access.log.2.gz")
+	writeGzipFile(t, fileName, "first line\nsecond line\n")
+
+	reader, readerErr := NewCompressedFileReader(fileName, 0)
+	test.FailOnError(t, readerErr)
+	defer log.OnError(reader.Close, "can't close compressed file reader")
+	expectStreamLine(t, reader, "first line")
+	expectStreamLine(t, reader, "second line")
+	expectStreamEOF(t, reader)
+}
+
+func TestCompressedFileReaderZstd(t *testing.T) {
+	t.Parallel()
+	if _, lookErr := exec.LookPath("zstd"); lookErr != nil {
+		t.Skip("zstd tool isn't installed")
+	}
+	dir, dirErr := ioutil.TempDir("", "test_compressed_file_reader_zstd")
+	test.FailOnError(t, dirErr)
+	defer os.RemoveAll(dir)
+	fileName := filepath.Join(dir, "access.log.2")
+	test.FailOnError(t, ioutil.WriteFile(fileName, []byte("first line\nsecond line\n"), 0644))
+	test.FailOnError(t, exec.Command("zstd", "--quiet", "--rm", fileName).Run())
+
+	reader, readerErr := NewCompressedFileReader(fileName+".zst", 0)
+	test.FailOnError(t, readerErr)
+	expectStreamLine(t, reader, "first line")
+	expectStreamLine(t, reader, "second line")
+	expectStreamEOF(t, reader)
+	test.FailOnError(t, reader.Close())
+}
+
+func TestCompressedFileReaderTruncatedZstd(t *testing.T) {
+	t.Parallel()
+	dir, dirErr := ioutil.TempDir("", "test_compressed_file_reader_truncated_zstd")
+	test.FailOnError(t, dirErr)
+	defer os.RemoveAll(dir)
+	fileName := filepath.Join(dir, "access.log.2.zst")
+	// "first line\nsecond line\nthird line\n" compressed by zstd, cut in the middle of the frame
+	truncated := []byte{
+		0x28, 0xb5, 0x2f, 0xfd, 0x24, 0x22, 0x11, 0x01, 0x00, 0x66, 0x69, 0x72,
+		0x73, 0x74, 0x20, 0x6c, 0x69, 0x6e, 0x65, 0x0a, 0x73, 0x65, 0x63, 0x6f,
+	}
+	test.FailOnError(t, ioutil.WriteFile(fileName, truncated, 0644))
+
+	reader, readerErr := NewCompressedFileReader(fileName, 0)
+	if readerErr != nil {
+		// zstd tool isn't installed, so broken archive can't be read at all
+		return
+	}
+	defer log.OnError(reader.Close, "can't close compressed file reader")
+	var readErr error
+	for readErr == nil {
+		_, readErr = reader.ReadOneLineAsSlice()
+	}
+	if readErr == io.EOF {
+		t.Fatalf("truncated archive should be reported as read error")
+	}
+}
+
+func TestCommandStreamReportsExitStatus(t *testing.T) {
+	t.Parallel()
+	cmd := exec.Command(os.Args[0], "-test.run=^TestCommandStreamHelperProcess$")
+	cmd.Env = append(os.Environ(), "LOGSTAT_COMMAND_STREAM_HELPER=1")
+	stream, streamErr := startCommandStream("access.log.2.zst", cmd)
+	test.FailOnError(t, streamErr)
+	reader, readerErr := NewStreamReader("access.log.2.zst", stream, 0)
+	test.FailOnError(t, readerErr)
+
+	expectStreamLine(t, reader, "first line")
+	line, lineErr := reader.ReadOneLineAsSlice()
+	test.Equals(t, []byte(nil), line, "line should be empty")
+	if lineErr == nil || lineErr == io.EOF {
+		t.Fatalf("exit status should be reported as read error, got: %v", lineErr)
+	}
+	test.Equals(t, true, strings.Contains(lineErr.Error(), "premature end"), "stderr should be in error")
+	_, repeatedErr := reader.ReadOneLineAsSlice()
+	test.Equals(t, lineErr, repeatedErr, "error should be reported on every read")
+	test.FailOnError(t, reader.Close())
+}
+
+// Not a real test, it is run as a separate process that imitates failed decompression
+func TestCommandStreamHelperProcess(t *testing.T) {
+	if os.Getenv("LOGSTAT_COMMAND_STREAM_HELPER") != "1" {
+		return
+	}
+	fmt.Fprint(os.Stdout, "first line\nsecond li")
+	fmt.Fprint(os.Stderr, "access.log.2.zst : Read error (39) : premature end\n")
+	os.Exit(1)
+}
+
+func writeGzipFile(t *testing.T, fileName string, content string) {
+	f, createErr := os.Create(fileName)
+	test.FailOnError(t, createErr)
+	defer log.OnError(f.Close, "can't close gzip file")
+	gzipWriter := gzip.NewWriter(f)
+	_, writeErr := gzipWriter.Write([]byte(content))
+	test.FailOnError(t, writeErr)
+	test.FailOnError(t, gzipWriter.Close())
+}
+
+func expectStreamLine(t *testing.T, reader lineReadCloser, expLine string) {
+	line, lineErr := reader.ReadOneLineAsSlice()
+	test.FailOnError(t, lineErr)
+	test.Equals(t, []byte(expLine), line, "can't read line")
+}
+
+func expectStreamEOF(t *testing.T, reader lineReadCloser) {
+	line, lineErr := reader.ReadOneLineAsSlice()
+	test.Equals(t, []byte(nil), line, "line should be empty")
+	test.Equals(t, io.EOF, lineErr, "stream should be finished")
+}
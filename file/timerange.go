@@ -0,0 +1,150 @@
+package file
+
+import (
+	"bufio"
+	"io"
+	"os"
+	"time"
+)
+
+// lines without time, like comments or corrupted lines, are skipped by probe only up to this amount
+const maxLinesToProbeForTime = 64
+
+/*
+Function that extracts unix time of the line, usually it is provided by the parser of log format.
+*/
+type LineTimeParser func(line []byte) (int64, error)
+
+/*
+A component used to limit lines of the file by their time.
+
+Responsibilities:
+	- find offset of the first line that is not older than `since`, using binary search by byte offset,
+	so huge file isn't scanned from its beginning
+	- detect the first line that is newer than `until`
+
+Attention:
+	- lines are expected to be ordered by time, slightly reordered lines near the bounds can be missed
+	- lines without time are returned as is
+*/
+type timeRange struct {
+	since       time.Time
+	until       time.Time
+	parseTime   LineTimeParser
+	untilPassed bool
+}
+
+/*
+Finds offset of the first line with time that isn't before `since`, or the size of file if there is no such line.
+*/
+func (r *timeRange) findSinceOffset(file *os.File, size int64, bufSize int) (int64, error) {
+	if r.since.IsZero() {
+		return 0, nil
+	}
+	since := r.since.Unix()
+	low, high := int64(0), size
+	result := size
+	for low < high {
+		mid := low + (high-low)/2
+		probe, probeErr := r.probeLineAfter(file, mid, size, bufSize)
+		if probeErr != nil {
+			return 0, probeErr
+		}
+		if !probe.found || probe.unixTime >= since {
+			if probe.lineStart < result {
+				result = probe.lineStart
+			}
+			high = mid
+			continue
+		}
+		// every line before the end of probed line is older than `since`
+		low = probe.lineEnd
+	}
+	return result, nil
+}
+
+/*
+Checks that line is newer than `until`. Once it happens, all following lines are considered newer too.
+*/
+func (r *timeRange) isPassedBy(line []byte) bool {
+	if r.untilPassed {
+		return true
+	}
+	if r.until.IsZero() {
+		return false
+	}
+	unixTime, parseErr := r.parseTime(line)
+	if parseErr != nil {
+		return false
+	}
+	r.untilPassed = unixTime > r.until.Unix()
+	return r.untilPassed
+}
+
+type timeProbe struct {
+	lineStart int64
+	lineEnd   int64
+	unixTime  int64
+	found     bool
+}
+
+/*
+Finds the first line with time that starts at `offset` or after it.
+If there is no such line, `lineStart` is the start of the first line after `offset`.
+*/
+func (r *timeRange) probeLineAfter(file *os.File, offset int64, size int64, bufSize int) (timeProbe, error) {
+	position := offset
+	if offset > 0 {
+		// include previous byte, so line that starts exactly at `offset` isn't skipped as partial
+		position = offset - 1
+	}
+	reader := bufio.NewReaderSize(io.NewSectionReader(file, position, size-position), bufSize)
+	if offset > 0 {
+		partialLength, _, skipErr := readLinePrefix(reader)
+		position += partialLength
+		if skipErr == io.EOF {
+			return timeProbe{lineStart: size, lineEnd: size}, nil
+		}
+		if skipErr != nil {
+			return timeProbe{}, skipErr
+		}
+	}
+
+	result := timeProbe{lineStart: position}
+	for i := 0; i < maxLinesToProbeForTime; i++ {
+		lineStart := position
+		lineLength, linePrefix, readErr := readLinePrefix(reader)
+		position += lineLength
+		if readErr != nil && readErr != io.EOF {
+			return timeProbe{}, readErr
+		}
+		if lineLength > 0 {
+			unixTime, parseErr := r.parseTime(dropLineEnding(linePrefix))
+			if parseErr == nil {
+				return timeProbe{lineStart: lineStart, lineEnd: position, unixTime: unixTime, found: true}, nil
+			}
+		}
+		if readErr == io.EOF {
+			break
+		}
+	}
+	return result, nil
+}
+
+/*
+Reads the whole line, but returns only its prefix that fits into reader buffer, time is expected to be there.
+*/
+func readLinePrefix(reader *bufio.Reader) (int64, []byte, error) {
+	var length int64
+	var prefix []byte
+	for {
+		chunk, readErr := reader.ReadSlice('\n')
+		length += int64(len(chunk))
+		if prefix == nil {
+			prefix = append([]byte(nil), chunk...)
+		}
+		if readErr != bufio.ErrBufferFull {
+			return length, prefix, readErr
+		}
+	}
+}
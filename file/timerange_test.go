@@ -0,0 +1,83 @@
+package file
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/storozhukBM/logstat/common/log"
+	"github.com/storozhukBM/logstat/common/test"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestFileReaderTimeRange(t *testing.T) {
+	t.Parallel()
+	tmpFile, tmpFileErr := ioutil.TempFile("", "test_file_reader_time_range")
+	test.FailOnError(t, tmpFileErr)
+	defer os.Remove(tmpFile.Name())
+	defer log.OnError(tmpFile.Close, "can't close tmp file")
+
+	appendToFile(t, tmpFile, []byte("# comment without time"))
+	for i := 1000; i < 3000; i++ {
+		appendToFile(t, tmpFile, []byte(fmt.Sprintf("%v line", i)))
+		if i%100 == 50 {
+			appendToFile(t, tmpFile, []byte("# comment without time"))
+		}
+	}
+
+	cases := []struct {
+		since     int64
+		until     int64
+		firstLine string
+		lastLine  string
+	}{
+		{since: 2500, until: 2600, firstLine: "2500 line", lastLine: "2600 line"},
+		{since: 1000, until: 1000, firstLine: "1000 line", lastLine: "1000 line"},
+		{since: 1, until: 0, firstLine: "1000 line", lastLine: "2999 line"},
+		{since: 2999, until: 0, firstLine: "2999 line", lastLine: "2999 line"},
+		{since: 2201, until: 2201, firstLine: "2201 line", lastLine: "2201 line"},
+	}
+	for _, testCase := range cases {
+		reader, readerErr := NewReader(tmpFile.Name(), 0, false)
+		test.FailOnError(t, readerErr)
+		rangeErr := reader.LimitTimeRange(unixTimeOrZero(testCase.since), unixTimeOrZero(testCase.until), parseLeadingUnixTime)
+		test.FailOnError(t, rangeErr)
+
+		var lines []string
+		for {
+			line, readErr := reader.ReadOneLineAsSlice()
+			if readErr != nil {
+				break
+			}
+			lines = append(lines, string(line))
+		}
+		test.Equals(t, true, len(lines) > 0, "lines should be read in range: %v", testCase)
+		test.Equals(t, testCase.firstLine, lines[0], "first line mismatch in range: %v", testCase)
+		test.Equals(t, testCase.lastLine, lines[len(lines)-1], "last line mismatch in range: %v", testCase)
+		log.OnError(reader.Close, "can't close file reader")()
+	}
+
+	reader, readerErr := NewReader(tmpFile.Name(), 0, true)
+	test.FailOnError(t, readerErr)
+	defer log.OnError(reader.Close, "can't close file reader")
+	test.FailOnError(t, reader.LimitTimeRange(time.Unix(5000, 0), time.Time{}, parseLeadingUnixTime))
+	expectEOF(t, reader)
+	test.Equals(t, fmt.Errorf("parseTime can't be nil"), reader.LimitTimeRange(time.Time{}, time.Time{}, nil), "nil parser")
+}
+
+func unixTimeOrZero(unixTime int64) time.Time {
+	if unixTime == 0 {
+		return time.Time{}
+	}
+	return time.Unix(unixTime, 0)
+}
+
+func parseLeadingUnixTime(line []byte) (int64, error) {
+	timeEnd := bytes.IndexByte(line, ' ')
+	if timeEnd == -1 {
+		return 0, fmt.Errorf("there is no time in line: %s", line)
+	}
+	return strconv.ParseInt(string(line[:timeEnd]), 10, 64)
+}
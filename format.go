@@ -0,0 +1,180 @@
+package main
+
+import (
+	"fmt"
+	"github.com/storozhukBM/logstat/common/log"
+	"github.com/storozhukBM/logstat/config"
+	"github.com/storozhukBM/logstat/file"
+	"github.com/storozhukBM/logstat/parser/apache"
+	"github.com/storozhukBM/logstat/parser/detect"
+	"github.com/storozhukBM/logstat/parser/elb"
+	"github.com/storozhukBM/logstat/parser/envoy"
+	"github.com/storozhukBM/logstat/parser/haproxy"
+	"github.com/storozhukBM/logstat/parser/json"
+	"github.com/storozhukBM/logstat/parser/logfmt"
+	"github.com/storozhukBM/logstat/parser/nginx"
+	"github.com/storozhukBM/logstat/parser/regex"
+	"github.com/storozhukBM/logstat/parser/section"
+	"github.com/storozhukBM/logstat/parser/w3c"
+	"io"
+)
+
+const (
+	autoLogFormat     = "auto"
+	commonLogFormat   = "common"
+	combinedLogFormat = "combined"
+	nginxLogFormat    = "nginx"
+	apacheLogFormat   = "apache"
+	jsonLogFormat     = "json"
+	logfmtLogFormat   = "logfmt"
+	w3cExtendedFormat = "w3cExtended"
+	albLogFormat      = "alb"
+	cloudFrontFormat  = "cloudfront"
+	haproxyLogFormat  = "haproxy"
+	envoyLogFormat    = "envoy"
+	regexLogFormat    = "regex"
+)
+
+/*
+Formats tried by automatic detection. Formats that parse the same lines go from the most specific one,
+like `combined` before `common`, or `cloudfront` before `w3cExtended`. Configured `nginx` and `apache` formats
+go last, because they are Combined Log Format by default. Configured `regex` format isn't detected,
+because it is an explicit escape hatch for formats that aren't supported.
+*/
+var detectableLogFormats = []string{
+	combinedLogFormat, commonLogFormat, jsonLogFormat, logfmtLogFormat, albLogFormat, haproxyLogFormat, envoyLogFormat,
+	cloudFrontFormat, w3cExtendedFormat, nginxLogFormat, apacheLogFormat,
+}
+
+/*
+Creates parser of the configured log format of `source`. Every source and every chunk of batch file needs its own parser,
+because parsers aren't safe for concurrent use. Sections are extracted separately only if they differ from default ones.
+*/
+func newLineParser(cfg config.Config, source string, internCacheSize uint) (lineParser, error) {
+	var parser lineParser
+	var parserErr error
+	if cfg.LogFormat == autoLogFormat {
+		parser, parserErr = newDetectingLineParser(cfg, source, internCacheSize)
+	} else {
+		parser, parserErr = newFormatLineParser(cfg, cfg.LogFormat, internCacheSize)
+	}
+	if parserErr != nil || !hasCustomSections(cfg) {
+		return parser, parserErr
+	}
+	extractor, extractorErr := section.NewExtractor(
+		cfg.SectionDepth, cfg.SectionTemplates, cfg.SectionPlaceholders, internCacheSize,
+	)
+	if extractorErr != nil {
+		return nil, fmt.Errorf("can't setup section extractor: %v", extractorErr)
+	}
+	return section.NewLineToStoreRecordParser(parser, extractor)
+}
+
+/*
+Default section is the first segment of path, that is found by parsers themselves.
+*/
+func hasCustomSections(cfg config.Config) bool {
+	return cfg.SectionDepth != 1 || len(cfg.SectionTemplates) > 0 || cfg.SectionPlaceholders
+}
+
+/*
+Custom sections are extracted from path, so it can't be skipped.
+*/
+func skipW3CTextParts(cfg config.Config) bool {
+	return !cfg.W3CParserTextParts && !hasCustomSections(cfg)
+}
+
+/*
+Creates parser that detects format of `source` by its first lines.
+*/
+func newDetectingLineParser(cfg config.Config, source string, internCacheSize uint) (*detect.LineToStoreRecordParser, error) {
+	candidates := make([]detect.Candidate, 0, len(detectableLogFormats))
+	for _, format := range detectableLogFormats {
+		parser, parserErr := newFormatLineParser(cfg, format, internCacheSize)
+		if parserErr != nil {
+			return nil, fmt.Errorf("can't setup parser of `%v` log format: %v", format, parserErr)
+		}
+		candidates = append(candidates, detect.Candidate{Format: format, Parser: parser})
+	}
+	return detect.NewLineToStoreRecordParser(
+		source, candidates, cfg.LogFormatDetectionLines, cfg.LogFormatRedetectionErrorRate,
+	)
+}
+
+func newFormatLineParser(cfg config.Config, format string, internCacheSize uint) (lineParser, error) {
+	switch format {
+	case commonLogFormat:
+		parser, parserErr := w3c.NewLineToStoreRecordParser(internCacheSize)
+		if parserErr == nil && skipW3CTextParts(cfg) {
+			parser.SkipTextParts()
+		}
+		return parser, parserErr
+	case combinedLogFormat:
+		parser, parserErr := w3c.NewCombinedLineToStoreRecordParser(internCacheSize)
+		if parserErr == nil && skipW3CTextParts(cfg) {
+			parser.SkipTextParts()
+		}
+		return parser, parserErr
+	case nginxLogFormat:
+		return nginx.NewLineToStoreRecordParser(cfg.NginxLogFormat, internCacheSize)
+	case apacheLogFormat:
+		return apache.NewLineToStoreRecordParser(cfg.ApacheLogFormat, internCacheSize)
+	case jsonLogFormat:
+		return json.NewLineToStoreRecordParser(cfg.JSONFieldMapping, internCacheSize)
+	case logfmtLogFormat:
+		return logfmt.NewLineToStoreRecordParser(cfg.LogfmtFieldMapping, internCacheSize)
+	case w3cExtendedFormat:
+		return w3c.NewExtendedLineToStoreRecordParser(cfg.W3CExtendedDefaultFields, internCacheSize)
+	case albLogFormat:
+		return elb.NewLineToStoreRecordParser(internCacheSize)
+	case cloudFrontFormat:
+		return w3c.NewCloudFrontLineToStoreRecordParser(internCacheSize)
+	case haproxyLogFormat:
+		return haproxy.NewLineToStoreRecordParser(internCacheSize)
+	case envoyLogFormat:
+		return envoy.NewLineToStoreRecordParser(internCacheSize)
+	case regexLogFormat:
+		return regex.NewLineToStoreRecordParser(cfg.RegexLogFormat, cfg.RegexTimeLayout, cfg.RegexDurationUnit, internCacheSize)
+	default:
+		return nil, fmt.Errorf("unknown log format: %v", format)
+	}
+}
+
+/*
+Lines of stateful formats depend on preceding lines, like columns declared by `#Fields` directive of
+W3C Extended Log File Format, so chunks of such file can't be parsed independently.
+Format that isn't detected yet is stateful too, because it is detected by the first lines.
+*/
+func isStatefulLogFormat(cfg config.Config) bool {
+	return cfg.LogFormat == w3cExtendedFormat || cfg.LogFormat == cloudFrontFormat || cfg.LogFormat == autoLogFormat
+}
+
+/*
+Detects log format of batch file by its first lines, so all chunks of file are parsed with the same format
+instead of detecting format of each chunk. Returns empty format if it can't be detected.
+*/
+func detectFileLogFormat(cfg config.Config, fileName string) (string, error) {
+	parser, parserErr := newDetectingLineParser(cfg, fileName, 0)
+	if parserErr != nil {
+		return "", parserErr
+	}
+	reader, readerErr := file.NewReader(fileName, cfg.FileReadBufSizeInBytes, true)
+	if readerErr != nil {
+		return "", readerErr
+	}
+	defer log.OnError(reader.Close, "can't close file: %v", fileName)()
+	reader.LimitLineLength(cfg.FileMaxLineLength, cfg.FileTruncateLongLines)
+	reader.SetUnterminatedLineFlushTimeout(0)
+
+	for i := uint(0); i < cfg.LogFormatDetectionLines && parser.Format() == ""; i++ {
+		line, readErr := reader.ReadOneLineAsSlice()
+		if readErr == io.EOF {
+			break
+		}
+		if readErr != nil {
+			return "", readErr
+		}
+		_, _ = parser.Parse(line)
+	}
+	return parser.Format(), nil
+}
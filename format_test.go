@@ -0,0 +1,44 @@
+package main
+
+import (
+	"github.com/storozhukBM/logstat/common/test"
+	"github.com/storozhukBM/logstat/config"
+	"github.com/storozhukBM/logstat/stat"
+	"testing"
+)
+
+func TestDefaultW3CParsersFillTextParts(t *testing.T) {
+	cfg := config.ParseFlagsAsConfig()
+	cases := []struct {
+		format string
+		line   string
+		result stat.Record
+	}{
+		{
+			format: commonLogFormat,
+			line:   `127.0.0.1 - james [09/May/2018:16:00:39 +0000] "GET /report HTTP/1.0" 200 123`,
+			result: stat.Record{
+				UnixTime: 1525881639, Section: "/report", StatusCode: 200, ResponseSize: 123,
+				RemoteHost: "127.0.0.1", Ident: "-", AuthUser: "james", Method: "GET", Path: "/report", Protocol: "HTTP/1.0",
+			},
+		},
+		{
+			format: combinedLogFormat,
+			line: `127.0.0.1 - frank [10/May/2018:01:15:59 +0000] "GET /api/user HTTP/1.1" 200 34 ` +
+				`"http://example.com/start.html" "Mozilla/5.0 (X11; Linux x86_64)"`,
+			result: stat.Record{
+				UnixTime: 1525914959, Section: "/api", StatusCode: 200, ResponseSize: 34,
+				RemoteHost: "127.0.0.1", Ident: "-", AuthUser: "frank", Method: "GET", Path: "/api/user", Protocol: "HTTP/1.1",
+				Referer: "http://example.com/start.html", UserAgent: "Mozilla/5.0 (X11; Linux x86_64)",
+			},
+		},
+	}
+	for _, testCase := range cases {
+		cfg.LogFormat = testCase.format
+		parser, parserErr := newLineParser(cfg, "test", cfg.W3CParserSectionsStringCacheSize)
+		test.FailOnError(t, parserErr)
+		actual, err := parser.Parse([]byte(testCase.line))
+		test.FailOnError(t, err)
+		test.Equals(t, testCase.result, actual, "mismatch on: %s", testCase.line)
+	}
+}
@@ -3,16 +3,16 @@ package main
 import (
 	"context"
 	"fmt"
-	"github.com/storozhukBM/logstat/alert"
 	"github.com/storozhukBM/logstat/common/log"
 	"github.com/storozhukBM/logstat/config"
 	"github.com/storozhukBM/logstat/file"
-	"github.com/storozhukBM/logstat/parser/w3c"
 	"github.com/storozhukBM/logstat/stat"
+	"github.com/storozhukBM/logstat/syslog"
 	"github.com/storozhukBM/logstat/view"
 	"github.com/storozhukBM/logstat/watcher"
 	"os"
 	"os/signal"
+	"strings"
 	"syscall"
 	"time"
 )
@@ -22,64 +22,383 @@ func main() {
 	if cfg.DebugMode {
 		log.GlobalDebugEnabled = true
 	}
-
-	fileReader, readerErr := file.NewReader(cfg.FileName, cfg.FileReadBufSizeInBytes)
-	if readerErr != nil {
-		log.WithError(readerErr, "can't setup file reader")
+	if configErr := cfg.Validate(); configErr != nil {
+		log.WithError(configErr, "invalid configuration")
 		return
 	}
-	defer log.OnError(fileReader.Close, "can't close file reader")
+	if _, parserErr := newLineParser(cfg, "", 0); parserErr != nil {
+		log.WithError(parserErr, "can't setup log parser")
+		return
+	}
+	// files are read concurrently in batch mode, so their records can't be merged into the same cycles
+	splitBySource := cfg.SplitReportsBySource || cfg.BatchMode
+	// there is nothing to wait for when all streams are closed by their writers,
+	// but syslog listener never stops by itself
+	exitAtEnd := (cfg.BatchMode || allArePipes(cfg.FileNames)) && len(cfg.SyslogListenAddresses) == 0
 
 	applicationCtx, applicationCancel := context.WithCancel(context.Background())
 	defer applicationCancel()
 
-	parser, parserErr := w3c.NewLineToStoreRecordParser(cfg.W3CParserSectionsStringCacheSize)
-	if parserErr != nil {
-		log.WithError(parserErr, "can't setup w3c log parser")
+	stdOutView, viewErr := view.NewIOView(applicationCtx, 10*time.Second, os.Stdout)
+	if viewErr != nil {
+		log.WithError(viewErr, "can't setup io view")
 		return
 	}
 
-	storage, storageErr := stat.NewStorage(10, 10)
-	if storageErr != nil {
-		log.WithError(storageErr, "can't setup traffic aggregation storage")
-		return
+	var sharedPipeline *pipeline
+	var sharedStorage *stat.SynchronizedStorage
+	if !splitBySource {
+		var pipelineErr error
+		sharedPipeline, pipelineErr = newPipeline(cfg, stdOutView)
+		if pipelineErr != nil {
+			log.WithError(pipelineErr, "can't setup reports pipeline")
+			return
+		}
+		if haveSeveralSources(cfg) {
+			// records of different sources, merged into the same cycles, can be slightly reordered
+			sharedPipeline.storage.KeepLateRecordsInCurrentCycle()
+		}
+		var storageErr error
+		sharedStorage, storageErr = stat.NewSynchronizedStorage(sharedPipeline.storage)
+		if storageErr != nil {
+			log.WithError(storageErr, "can't setup shared storage")
+			return
+		}
 	}
 
-	_, watcherErr := watcher.NewLogFileWatcher(applicationCtx, fileReader, storage, parser, cfg.FileReadPollPeriod)
-	if watcherErr != nil {
-		log.WithError(watcherErr, "can't setup file watcher")
-		return
+	newSourceStorage := func() (recordStorage, *pipeline, error) {
+		if !splitBySource {
+			return sharedStorage, nil, nil
+		}
+		sourcePipeline, pipelineErr := newPipeline(cfg, stdOutView)
+		if pipelineErr != nil {
+			return nil, nil, fmt.Errorf("can't setup reports pipeline: %v", pipelineErr)
+		}
+		return sourcePipeline.storage, sourcePipeline, nil
 	}
 
-	trafficAlert, trafficAlertErr := alert.NewTrafficState(
-		120, 10, 10, 10,
-	)
-	if trafficAlertErr != nil {
-		log.WithError(trafficAlertErr, "can't setup traffic alert")
-		return
+	startFile := func(ctx context.Context, fileName string) (<-chan struct{}, error) {
+		storage, filePipeline, storageErr := newSourceStorage()
+		if storageErr != nil {
+			return nil, storageErr
+		}
+		return startFileWatcher(ctx, cfg, fileName, storage, filePipeline)
 	}
 
-	stdOutView, viewErr := view.NewIOView(applicationCtx, 10*time.Second, os.Stdout)
-	if viewErr != nil {
-		log.WithError(viewErr, "can't setup io view")
-		return
+	var sourcesDone []<-chan struct{}
+	if len(cfg.FileNames) > 0 {
+		rescanPeriod := cfg.FileGlobRescanPeriod
+		if exitAtEnd {
+			rescanPeriod = 0
+		}
+		globWatcher, globWatcherErr := watcher.NewGlobWatcher(applicationCtx, cfg.FileNames, rescanPeriod, startFile)
+		if globWatcherErr != nil {
+			log.WithError(globWatcherErr, "can't setup files watcher")
+			return
+		}
+		sourcesDone = append(sourcesDone, globWatcher.Done())
 	}
-
-	_, alertSubscriptionErr := alert.NewAlertsSubscription(trafficAlert, stdOutView.TrafficAlert)
-	if alertSubscriptionErr != nil {
-		log.WithError(alertSubscriptionErr, "can't setup alert broadcast")
-		return
+	for _, listenURL := range cfg.SyslogListenAddresses {
+		storage, listenerPipeline, storageErr := newSourceStorage()
+		if storageErr != nil {
+			log.WithError(storageErr, "can't setup syslog storage")
+			return
+		}
+		listenerDone, listenerErr := startSyslogListener(applicationCtx, cfg, listenURL, storage, listenerPipeline)
+		if listenerErr != nil {
+			log.WithError(listenerErr, "can't setup syslog listener")
+			return
+		}
+		sourcesDone = append(sourcesDone, listenerDone)
 	}
+	waitSources := func() {
+		for _, sourceDone := range sourcesDone {
+			<-sourceDone
+		}
+	}
+	allSourcesDone := make(chan struct{})
+	go func() {
+		defer close(allSourcesDone)
+		waitSources()
+	}()
+
+	stopCh := make(chan os.Signal, 1)
+	signal.Notify(stopCh, syscall.SIGTERM, syscall.SIGINT)
 
-	_, statReportSubscriptionErr := stat.NewReportSubscription(storage, trafficAlert.Store, stdOutView.Report)
-	if statReportSubscriptionErr != nil {
-		log.WithError(statReportSubscriptionErr, "can't setup traffic reports broadcast")
+	if exitAtEnd {
+		select {
+		case <-allSourcesDone:
+		case <-stopCh:
+			applicationCancel()
+			<-allSourcesDone
+			return
+		}
+		if sharedPipeline != nil {
+			sharedPipeline.flushAndWait()
+		}
+		log.OnError(stdOutView.Close, "can't flush io view")()
 		return
 	}
 
-	stopCh := make(chan os.Signal)
-	defer close(stopCh)
-	signal.Notify(stopCh, syscall.SIGTERM, syscall.SIGINT)
 	<-stopCh
+	// readers can be closed only after watchers are stopped, so the last checkpoints are consistent
+	applicationCancel()
+	<-allSourcesDone
 	fmt.Println()
 }
+
+/*
+Starts reader, parser and watcher of one file. In batch mode, file pipeline is flushed when file is fully read.
+Pipes are always read till the end of stream, as there is no way to wait for new lines after it.
+*/
+func startFileWatcher(
+	ctx context.Context, cfg config.Config, fileName string,
+	storage recordStorage, filePipeline *pipeline,
+) (<-chan struct{}, error) {
+	isPipe := file.IsPipe(fileName)
+	if canReadInParallel(cfg, fileName, isPipe) && filePipeline != nil {
+		if cfg.LogFormat == autoLogFormat {
+			detectedFormat, detectErr := detectFileLogFormat(cfg, fileName)
+			if detectErr != nil {
+				return nil, fmt.Errorf("can't detect log format: %v", detectErr)
+			}
+			if detectedFormat != "" {
+				cfg.LogFormat = detectedFormat
+			}
+		}
+		if !isStatefulLogFormat(cfg) {
+			return startParallelBatchWatcher(ctx, cfg, fileName, filePipeline)
+		}
+	}
+	fileReader, readerErr := newFileReader(cfg, fileName, isPipe)
+	if readerErr != nil {
+		return nil, fmt.Errorf("can't setup file reader: %v", readerErr)
+	}
+	fileReader.LimitLineLength(cfg.FileMaxLineLength, cfg.FileTruncateLongLines)
+	return startSourceWatcher(ctx, cfg, fileName, fileReader, isPipe, storage, filePipeline)
+}
+
+/*
+Starts parallel reading of batch file by chunks, each chunk has its own reader, parser and shard of file storage.
+File pipeline is flushed when all chunks are merged.
+*/
+func startParallelBatchWatcher(
+	ctx context.Context, cfg config.Config, fileName string, filePipeline *pipeline,
+) (<-chan struct{}, error) {
+	chunks, chunksErr := file.SplitIntoChunks(fileName, int64(cfg.BatchChunkSizeInBytes))
+	if chunksErr != nil {
+		return nil, fmt.Errorf("can't split file into chunks: %v", chunksErr)
+	}
+	log.Debug("file is split into chunks: %v; chunks: %v", fileName, len(chunks))
+	readChunk := func(ctx context.Context, chunkIdx int, shard *stat.Shard) error {
+		chunkReader, readerErr := file.NewChunkReader(fileName, chunks[chunkIdx], cfg.FileReadBufSizeInBytes)
+		if readerErr != nil {
+			return readerErr
+		}
+		defer log.OnError(chunkReader.Close, "can't close chunk of file: %v", fileName)()
+		chunkReader.LimitLineLength(cfg.FileMaxLineLength, cfg.FileTruncateLongLines)
+
+		labeledShard, shardErr := stat.NewSourceLabeledStorage(fileName, shard)
+		if shardErr != nil {
+			return fmt.Errorf("can't setup source labeled storage: %v", shardErr)
+		}
+		parser, parserErr := newLineParser(cfg, fileName, cfg.W3CParserSectionsStringCacheSize)
+		if parserErr != nil {
+			return fmt.Errorf("can't setup log parser: %v", parserErr)
+		}
+		chunkWatcher, watcherErr := watcher.NewBatchLogFileWatcher(ctx, chunkReader, labeledShard, parser)
+		if watcherErr != nil {
+			return fmt.Errorf("can't setup chunk watcher: %v", watcherErr)
+		}
+		<-chunkWatcher.Done()
+		return nil
+	}
+
+	parallelWatcher, watcherErr := watcher.NewParallelBatchWatcher(
+		ctx, filePipeline.storage, len(chunks), int(cfg.BatchParallelism), readChunk,
+	)
+	if watcherErr != nil {
+		return nil, fmt.Errorf("can't setup parallel batch watcher: %v", watcherErr)
+	}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		<-parallelWatcher.Done()
+		filePipeline.flushAndWait()
+	}()
+	return done, nil
+}
+
+/*
+Only regular files can be split into chunks, time range is found only by sequential reader.
+*/
+func canReadInParallel(cfg config.Config, fileName string, isPipe bool) bool {
+	return cfg.BatchMode && cfg.BatchParallelism > 1 && !isPipe && !file.IsCompressedFileName(fileName) &&
+		!cfg.ReplayRotatedFiles && cfg.Since.IsZero() && cfg.Until.IsZero()
+}
+
+/*
+Starts syslog listener, that is watched as a stream till the application is stopped.
+*/
+func startSyslogListener(
+	ctx context.Context, cfg config.Config, listenURL string,
+	storage recordStorage, listenerPipeline *pipeline,
+) (<-chan struct{}, error) {
+	listener, listenerErr := syslog.NewListener(ctx, listenURL)
+	if listenerErr != nil {
+		return nil, listenerErr
+	}
+	return startSourceWatcher(ctx, cfg, listenURL, listener, true, storage, listenerPipeline)
+}
+
+/*
+Starts parser and watcher of lines from one source, stream sources are read till their end.
+Source pipeline, if any, is flushed when lines are fully read from batch file or stream.
+*/
+func startSourceWatcher(
+	ctx context.Context, cfg config.Config, source string, reader lineReadCloser, isStream bool,
+	storage recordStorage, sourcePipeline *pipeline,
+) (<-chan struct{}, error) {
+	labeledStorage, storageErr := stat.NewSourceLabeledStorage(source, storage)
+	if storageErr != nil {
+		log.OnError(reader.Close, "can't close reader")()
+		return nil, fmt.Errorf("can't setup source labeled storage: %v", storageErr)
+	}
+
+	parser, parserErr := newLineParser(cfg, source, cfg.W3CParserSectionsStringCacheSize)
+	if parserErr != nil {
+		log.OnError(reader.Close, "can't close reader")()
+		return nil, fmt.Errorf("can't setup log parser: %v", parserErr)
+	}
+
+	var logFileWatcher *watcher.LogFileWatcher
+	var watcherErr error
+	if cfg.BatchMode || isStream {
+		logFileWatcher, watcherErr = watcher.NewBatchLogFileWatcher(ctx, reader, labeledStorage, parser)
+	} else {
+		logFileWatcher, watcherErr = startLogFileWatcher(ctx, cfg, source, reader, labeledStorage, parser)
+	}
+	if watcherErr != nil {
+		log.OnError(reader.Close, "can't close reader")()
+		return nil, fmt.Errorf("can't setup file watcher: %v", watcherErr)
+	}
+
+	if isStream {
+		// read from stream blocks till the next line, so it can be interrupted only by close
+		go func() {
+			select {
+			case <-ctx.Done():
+				log.OnError(reader.Close, "can't close stream reader")()
+			case <-logFileWatcher.Done():
+			}
+		}()
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		<-logFileWatcher.Done()
+		log.OnError(reader.Close, "can't close reader")()
+		if (cfg.BatchMode || isStream) && sourcePipeline != nil {
+			sourcePipeline.flushAndWait()
+		}
+	}()
+	return done, nil
+}
+
+func newFileReader(cfg config.Config, fileName string, isPipe bool) (lineLengthLimitedReader, error) {
+	if isPipe {
+		return file.NewPipeReader(fileName, cfg.FileReadBufSizeInBytes)
+	}
+	if file.IsCompressedFileName(fileName) {
+		return file.NewCompressedFileReader(fileName, cfg.FileReadBufSizeInBytes)
+	}
+	// unterminated line at the end of file can be finished later only if file is still written
+	flushTimeout := cfg.FileUnterminatedLineFlushTimeout
+	if cfg.BatchMode {
+		flushTimeout = 0
+	}
+	if cfg.ReplayRotatedFiles {
+		chainReader, chainErr := file.NewRotationChainReader(fileName, cfg.FileReadBufSizeInBytes)
+		if chainErr != nil {
+			return nil, chainErr
+		}
+		chainReader.SetUnterminatedLineFlushTimeout(flushTimeout)
+		return chainReader, nil
+	}
+
+	fromStart := cfg.FileReadFromStart || cfg.BatchMode
+	var reader *file.Reader
+	var readerErr error
+	if cfg.CheckpointFileName == "" {
+		reader, readerErr = file.NewReader(fileName, cfg.FileReadBufSizeInBytes, fromStart)
+	} else {
+		reader, readerErr = file.NewCheckpointedReader(
+			fileName, cfg.FileReadBufSizeInBytes, fromStart,
+			checkpointFileNameFor(cfg, fileName), cfg.CheckpointPeriod,
+		)
+	}
+	if readerErr != nil {
+		return nil, readerErr
+	}
+	reader.SetUnterminatedLineFlushTimeout(flushTimeout)
+	if !cfg.Since.IsZero() || !cfg.Until.IsZero() {
+		// reader uses its own parser, because it only needs time of lines
+		timeParser, timeParserErr := newLineParser(cfg, fileName, 0)
+		if timeParserErr != nil {
+			log.OnError(reader.Close, "can't Close file: %v", fileName)()
+			return nil, timeParserErr
+		}
+		timeRangeErr := reader.LimitTimeRange(cfg.Since, cfg.Until, timeParser.ParseTime)
+		if timeRangeErr != nil {
+			log.OnError(reader.Close, "can't Close file: %v", fileName)()
+			return nil, timeRangeErr
+		}
+	}
+	return reader, nil
+}
+
+func allArePipes(fileNames []string) bool {
+	for _, fileName := range fileNames {
+		if watcher.HasGlobMeta(fileName) || !file.IsPipe(fileName) {
+			return false
+		}
+	}
+	return true
+}
+
+func haveSeveralSources(cfg config.Config) bool {
+	if len(cfg.FileNames)+len(cfg.SyslogListenAddresses) > 1 {
+		return true
+	}
+	// glob pattern can match several files and syslog listener can receive messages from several hosts
+	return len(cfg.SyslogListenAddresses) > 0 || (len(cfg.FileNames) > 0 && watcher.HasGlobMeta(cfg.FileNames[0]))
+}
+
+/*
+Each file requires its own checkpoint, so if several files can be watched
+we derive checkpoint name from the file path.
+*/
+func checkpointFileNameFor(cfg config.Config, fileName string) string {
+	if len(cfg.FileNames) == 1 && !watcher.HasGlobMeta(cfg.FileNames[0]) {
+		return cfg.CheckpointFileName
+	}
+	suffix := strings.Replace(strings.TrimPrefix(fileName, string(os.PathSeparator)), string(os.PathSeparator), "_", -1)
+	return cfg.CheckpointFileName + "." + suffix
+}
+
+func startLogFileWatcher(
+	ctx context.Context, cfg config.Config, fileName string,
+	fileReader lineReadCloser, storage *stat.SourceLabeledStorage, parser lineParser,
+) (*watcher.LogFileWatcher, error) {
+	if cfg.FileWatchWithInotify {
+		notifier, notifierErr := watcher.NewInotifyNotifier(ctx, fileName)
+		if notifierErr == nil {
+			return watcher.NewNotifiedLogFileWatcher(
+				ctx, fileReader, storage, parser, notifier, cfg.FileInotifyFallbackPollPeriod,
+			)
+		}
+		log.WithError(notifierErr, "can't setup inotify, fall back to polling")
+	}
+	return watcher.NewLogFileWatcher(ctx, fileReader, storage, parser, cfg.FileReadPollPeriod)
+}
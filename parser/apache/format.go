@@ -0,0 +1,305 @@
+package apache
+
+import (
+	"fmt"
+	"github.com/storozhukBM/logstat/parser/fields"
+	"strings"
+)
+
+type directive int
+
+const (
+	ignoredDirective directive = iota
+	remoteHostDirective
+	clientIPDirective
+	identDirective
+	remoteUserDirective
+	timeDirective
+	epochSecondsTimeDirective
+	epochMillisTimeDirective
+	epochMicrosTimeDirective
+	requestDirective
+	methodDirective
+	urlPathDirective
+	protocolDirective
+	finalStatusDirective
+	originalStatusDirective
+	bodySizeDirective
+	bytesSentDirective
+	latencyMicrosDirective
+	latencyMillisDirective
+	latencySecondsDirective
+	refererDirective
+	userAgentDirective
+)
+
+/*
+Well-known `%` codes without argument that are mapped onto record fields, all other codes are skipped.
+*/
+var knownCodes = map[byte]directive{
+	'h': remoteHostDirective,
+	'a': clientIPDirective,
+	'l': identDirective,
+	'u': remoteUserDirective,
+	't': timeDirective,
+	'r': requestDirective,
+	'm': methodDirective,
+	'U': urlPathDirective,
+	'H': protocolDirective,
+	's': originalStatusDirective,
+	'b': bodySizeDirective,
+	'B': bodySizeDirective,
+	'O': bytesSentDirective,
+	'D': latencyMicrosDirective,
+	'T': latencySecondsDirective,
+}
+
+/*
+Directives that are ignored when another directive of format provides the same record fields.
+*/
+var overriddenBy = map[directive][]directive{
+	clientIPDirective:       {remoteHostDirective},
+	methodDirective:         {requestDirective},
+	urlPathDirective:        {requestDirective},
+	protocolDirective:       {requestDirective},
+	originalStatusDirective: {finalStatusDirective},
+	bytesSentDirective:      {bodySizeDirective},
+	latencySecondsDirective: {latencyMicrosDirective, latencyMillisDirective},
+	latencyMillisDirective:  {latencyMicrosDirective},
+}
+
+/*
+Directive of format and literal that follows it till the next directive or the end of line.
+*/
+type formatPart struct {
+	name      string
+	directive directive
+	suffix    []byte
+	// directive is surrounded by quotes, so its value can contain escaped quotes
+	quoted bool
+}
+
+func (d directive) isTime() bool {
+	return d == timeDirective || d == epochSecondsTimeDirective ||
+		d == epochMillisTimeDirective || d == epochMicrosTimeDirective
+}
+
+/*
+Extracts format string from the whole `LogFormat "..." nickname` directive,
+any other definition is treated as format string itself.
+Escape sequences `\"`, `\\`, `\t` and `\n` of format string are unescaped the same way as Apache does it.
+*/
+func extractFormat(definition string) (string, error) {
+	definition = strings.TrimSpace(definition)
+	if strings.HasPrefix(definition, "LogFormat ") {
+		quoted := strings.TrimSpace(strings.TrimPrefix(definition, "LogFormat "))
+		if !strings.HasPrefix(quoted, `"`) {
+			return "", fmt.Errorf("format string of `LogFormat` directive should be quoted")
+		}
+		formatEnd := fields.FindClosingQuote([]byte(quoted), 1)
+		if formatEnd == -1 {
+			return "", fmt.Errorf("format string of `LogFormat` directive isn't closed by quote")
+		}
+		definition = quoted[1:formatEnd]
+	}
+
+	result := make([]byte, 0, len(definition))
+	for i := 0; i < len(definition); i++ {
+		if definition[i] == '\\' && i+1 < len(definition) {
+			switch definition[i+1] {
+			case '"', '\\':
+				i++
+			case 't':
+				result = append(result, '\t')
+				i++
+				continue
+			case 'n':
+				result = append(result, '\n')
+				i++
+				continue
+			}
+		}
+		result = append(result, definition[i])
+	}
+	return string(result), nil
+}
+
+/*
+Compiles `LogFormat` into the literal prefix of line and parts for each directive.
+Directives are written as `%x`, `%>x`, `%{argument}x` or with status conditions, like `%400,501{User-agent}i`.
+They should be separated by some literal, otherwise the end of one value can't be found,
+the only exception is `%U%q` that is parsed as one path with query string.
+*/
+func compileFormat(logFormat string) ([]byte, []formatPart, error) {
+	var prefix []byte
+	var parts []formatPart
+	literal := make([]byte, 0, len(logFormat))
+	for i := 0; i < len(logFormat); i++ {
+		if logFormat[i] != '%' {
+			literal = append(literal, logFormat[i])
+			continue
+		}
+		if i+1 < len(logFormat) && logFormat[i+1] == '%' {
+			literal = append(literal, '%')
+			i++
+			continue
+		}
+		d, nameEnd, parseErr := parseDirective(logFormat, i)
+		if parseErr != nil {
+			return nil, nil, parseErr
+		}
+		name := logFormat[i:nameEnd]
+		if name == "%q" && len(literal) == 0 && len(parts) > 0 && parts[len(parts)-1].name == "%U" {
+			// `%U%q` is a common way to write path with query string, query string starts with `?` if present
+			parts[len(parts)-1].name = "%U%q"
+			i = nameEnd - 1
+			continue
+		}
+		if d == timeDirective {
+			// time is written in brackets, like `[10/Oct/2000:13:55:36 -0700]`
+			literal = append(literal, '[')
+		}
+		if len(parts) == 0 {
+			prefix = literal
+		} else {
+			if len(literal) == 0 {
+				return nil, nil, fmt.Errorf(
+					"directives `%v` and `%v` aren't separated by any literal", parts[len(parts)-1].name, name,
+				)
+			}
+			parts[len(parts)-1].suffix = literal
+		}
+		parts = append(parts, formatPart{name: name, directive: d})
+		literal = make([]byte, 0, len(logFormat))
+		if d == timeDirective {
+			literal = append(literal, ']')
+		}
+		i = nameEnd - 1
+	}
+	if len(parts) == 0 {
+		return nil, nil, fmt.Errorf("log format has no directives")
+	}
+	parts[len(parts)-1].suffix = literal
+
+	previousLiteral := prefix
+	for i := range parts {
+		parts[i].quoted = fields.IsQuoted(previousLiteral, parts[i].suffix)
+		previousLiteral = parts[i].suffix
+	}
+	resolveDirectives(parts)
+
+	hasTime := false
+	for _, part := range parts {
+		hasTime = hasTime || part.directive.isTime()
+	}
+	if !hasTime {
+		return nil, nil, fmt.Errorf("log format should have `%%t`, `%%{sec}t`, `%%{msec}t` or `%%{usec}t` directive")
+	}
+	return prefix, parts, nil
+}
+
+/*
+Parses directive that starts with `%` at `directiveStart`, returns its end in format.
+*/
+func parseDirective(logFormat string, directiveStart int) (directive, int, error) {
+	i := directiveStart + 1
+	finalStatus := false
+	// modifiers: `<` or `>` for original or final request, and status conditions, like `!200,304`
+	for i < len(logFormat) && strings.IndexByte("<>!,0123456789", logFormat[i]) != -1 {
+		finalStatus = finalStatus || logFormat[i] == '>'
+		i++
+	}
+	argument := ""
+	if i < len(logFormat) && logFormat[i] == '{' {
+		argumentEnd := strings.IndexByte(logFormat[i:], '}')
+		if argumentEnd == -1 {
+			return 0, 0, fmt.Errorf("argument of directive at %v isn't closed by `}`", directiveStart)
+		}
+		argument = logFormat[i+1 : i+argumentEnd]
+		i += argumentEnd + 1
+	}
+	if i >= len(logFormat) {
+		return 0, 0, fmt.Errorf("directive at %v has no code", directiveStart)
+	}
+	code := logFormat[i]
+	if code == '^' {
+		// two letter codes, like `%^ti`, aren't mapped
+		if i+2 >= len(logFormat) {
+			return 0, 0, fmt.Errorf("directive at %v has no code", directiveStart)
+		}
+		return ignoredDirective, i + 3, nil
+	}
+	return directiveOf(code, argument, finalStatus), i + 1, nil
+}
+
+func directiveOf(code byte, argument string, finalStatus bool) directive {
+	switch {
+	case code == 's' && finalStatus:
+		return finalStatusDirective
+	case code == 'i' && strings.EqualFold(argument, "Referer"):
+		return refererDirective
+	case code == 'i' && strings.EqualFold(argument, "User-Agent"):
+		return userAgentDirective
+	case code == 't' && argument != "":
+		return timeDirectiveOf(argument)
+	case code == 'T' && argument != "":
+		return latencyDirectiveOf(argument)
+	case argument != "":
+		// arguments change meaning of other codes, like `%{local}p` or `%{Host}i`
+		return ignoredDirective
+	}
+	return knownCodes[code]
+}
+
+/*
+Only epoch time formats of `%{format}t` are supported, `strftime` formats are skipped.
+*/
+func timeDirectiveOf(argument string) directive {
+	argument = strings.TrimPrefix(strings.TrimPrefix(argument, "begin:"), "end:")
+	switch argument {
+	case "sec":
+		return epochSecondsTimeDirective
+	case "msec":
+		return epochMillisTimeDirective
+	case "usec":
+		return epochMicrosTimeDirective
+	}
+	return ignoredDirective
+}
+
+func latencyDirectiveOf(argument string) directive {
+	switch argument {
+	case "us":
+		return latencyMicrosDirective
+	case "ms":
+		return latencyMillisDirective
+	case "s":
+		return latencySecondsDirective
+	}
+	return ignoredDirective
+}
+
+/*
+Leaves only one directive for each record field: the first time directive, the first occurrence of each directive
+and directives that aren't overridden by more complete ones, like `%r` over `%U` or `%>s` over `%s`.
+*/
+func resolveDirectives(parts []formatPart) {
+	present := make(map[directive]bool)
+	for _, part := range parts {
+		present[part.directive] = true
+	}
+	seen := make(map[directive]bool)
+	seenTime := false
+	for i := range parts {
+		d := parts[i].directive
+		overridden := seen[d] || (d.isTime() && seenTime)
+		for _, preferred := range overriddenBy[d] {
+			overridden = overridden || present[preferred]
+		}
+		seen[d] = true
+		seenTime = seenTime || d.isTime()
+		if overridden {
+			parts[i].directive = ignoredDirective
+		}
+	}
+}
@@ -0,0 +1,235 @@
+package apache
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/storozhukBM/logstat/parser/fields"
+	"github.com/storozhukBM/logstat/stat"
+	"time"
+)
+
+/*
+A component used to parse one line of log written by Apache with custom `LogFormat` to storage req record.
+Format is compiled once into literals that separate directives, so line is scanned
+by `bytes.IndexByte` search of these literals, the same way as in `w3c.LineToStoreRecordParser`.
+
+Responsibilities:
+	- map well-known `%` directives onto record fields:
+		`%h` or `%a`, `%l`, `%u`, `%t` or `%{sec}t`, `%{msec}t`, `%{usec}t`,
+		`%r` or `%m`, `%U` or `%U%q`, `%H`, `%>s` or `%s`, `%b`, `%B` or `%O`,
+		`%D`, `%T`, `%{us}T`, `%{ms}T`, `%{s}T`, `%{Referer}i`, `%{User-Agent}i`
+	- skip all other directives, like `%v`, `%{Host}i` or strftime formats of `%{format}t`
+	- copy required parts of line bytes to separate strings, so line bytes can be recycled and reused afterward
+
+Attention:
+	- format should have at least one supported time directive, the first one is used as time of record
+	- value of directive ends at the first occurrence of the literal that follows it in format,
+	so directives that can contain spaces, like `%r`, should be followed by something else
+	- `%U` is a path without query string, so path of record has query string only if it is written as `%U%q`
+	- empty values written by Apache as `-` are stored as is, but numbers are parsed as zero
+*/
+type LineToStoreRecordParser struct {
+	prefix     []byte
+	parts      []formatPart
+	timeParser fields.CommonLogTimeParser
+
+	hostsInternCache      *fields.InternCache
+	usersInternCache      *fields.InternCache
+	methodsInternCache    *fields.InternCache
+	pathsInternCache      *fields.InternCache
+	protocolsInternCache  *fields.InternCache
+	sectionsInternCache   *fields.InternCache
+	referersInternCache   *fields.InternCache
+	userAgentsInternCache *fields.InternCache
+	unescapeBuf           []byte
+}
+
+/*
+Creates parser of lines written with `logFormat`, that is the whole `LogFormat "..." nickname` directive
+or only its format string. `internCacheSize` limits size of each cache of interned text parts.
+*/
+func NewLineToStoreRecordParser(logFormat string, internCacheSize uint) (*LineToStoreRecordParser, error) {
+	format, extractErr := extractFormat(logFormat)
+	if extractErr != nil {
+		return nil, fmt.Errorf("can't extract log format from `%v`: %v", logFormat, extractErr)
+	}
+	prefix, parts, formatErr := compileFormat(format)
+	if formatErr != nil {
+		return nil, fmt.Errorf("can't compile log format `%v`: %v", format, formatErr)
+	}
+	result := &LineToStoreRecordParser{
+		prefix:                prefix,
+		parts:                 parts,
+		hostsInternCache:      fields.NewInternCache(internCacheSize),
+		usersInternCache:      fields.NewInternCache(internCacheSize),
+		methodsInternCache:    fields.NewInternCache(internCacheSize),
+		pathsInternCache:      fields.NewInternCache(internCacheSize),
+		protocolsInternCache:  fields.NewInternCache(internCacheSize),
+		sectionsInternCache:   fields.NewInternCache(internCacheSize),
+		referersInternCache:   fields.NewInternCache(internCacheSize),
+		userAgentsInternCache: fields.NewInternCache(internCacheSize),
+	}
+	return result, nil
+}
+
+func (p *LineToStoreRecordParser) Parse(line []byte) (stat.Record, error) {
+	if !bytes.HasPrefix(line, p.prefix) {
+		return stat.Record{}, fmt.Errorf("enexpected format of line. line doesn't start with `%s`", p.prefix)
+	}
+	record := stat.Record{}
+	partStart := len(p.prefix)
+	for i := range p.parts {
+		part := &p.parts[i]
+		valuePart, partEnd, findErr := p.findValuePart(line, partStart, part)
+		if findErr != nil {
+			return stat.Record{}, fmt.Errorf("can't find `%v`: %v", part.name, findErr)
+		}
+		parseErr := p.parseValuePart(&record, part.directive, valuePart)
+		if parseErr != nil {
+			return stat.Record{}, fmt.Errorf("can't parse `%v`: %v", part.name, parseErr)
+		}
+		partStart = partEnd
+	}
+	return record, nil
+}
+
+/*
+Parses only time of the line, parts after time directive aren't even scanned.
+*/
+func (p *LineToStoreRecordParser) ParseTime(line []byte) (int64, error) {
+	if !bytes.HasPrefix(line, p.prefix) {
+		return 0, fmt.Errorf("enexpected format of line. line doesn't start with `%s`", p.prefix)
+	}
+	partStart := len(p.prefix)
+	for i := range p.parts {
+		part := &p.parts[i]
+		valuePart, partEnd, findErr := p.findValuePart(line, partStart, part)
+		if findErr != nil {
+			return 0, fmt.Errorf("can't find `%v`: %v", part.name, findErr)
+		}
+		if part.directive.isTime() {
+			unixTime, timeErr := p.parseTime(part.directive, valuePart)
+			if timeErr != nil {
+				return 0, fmt.Errorf("can't parse `%v`: %v", part.name, timeErr)
+			}
+			return unixTime, nil
+		}
+		partStart = partEnd
+	}
+	return 0, fmt.Errorf("log format has no time directive")
+}
+
+/*
+Finds value of directive that starts at `partStart`, returns the start of the next value.
+*/
+func (p *LineToStoreRecordParser) findValuePart(line []byte, partStart int, part *formatPart) ([]byte, int, error) {
+	valuePartEnd, findErr := fields.FindValueEnd(line, partStart, part.suffix, part.quoted)
+	if findErr != nil {
+		return nil, 0, findErr
+	}
+	valuePart := line[partStart:valuePartEnd]
+	if part.quoted && part.directive != ignoredDirective && bytes.IndexByte(valuePart, '\\') != -1 {
+		p.unescapeBuf = fields.AppendUnescaped(p.unescapeBuf[:0], valuePart)
+		valuePart = p.unescapeBuf
+	}
+	return valuePart, valuePartEnd + len(part.suffix), nil
+}
+
+func (p *LineToStoreRecordParser) parseValuePart(record *stat.Record, d directive, valuePart []byte) error {
+	switch d {
+	case remoteHostDirective, clientIPDirective:
+		record.RemoteHost = p.hostsInternCache.Intern(valuePart)
+	case identDirective:
+		record.Ident = p.usersInternCache.Intern(valuePart)
+	case remoteUserDirective:
+		record.AuthUser = p.usersInternCache.Intern(valuePart)
+	case timeDirective, epochSecondsTimeDirective, epochMillisTimeDirective, epochMicrosTimeDirective:
+		unixTime, timeErr := p.parseTime(d, valuePart)
+		if timeErr != nil {
+			return timeErr
+		}
+		record.UnixTime = unixTime
+	case requestDirective:
+		methodPart, pathPart, protocolPart, splitErr := fields.SplitRequest(valuePart)
+		if splitErr != nil {
+			return splitErr
+		}
+		record.Method = p.methodsInternCache.Intern(methodPart)
+		record.Protocol = p.protocolsInternCache.Intern(protocolPart)
+		return p.parsePath(record, pathPart)
+	case methodDirective:
+		record.Method = p.methodsInternCache.Intern(valuePart)
+	case urlPathDirective:
+		return p.parsePath(record, valuePart)
+	case protocolDirective:
+		record.Protocol = p.protocolsInternCache.Intern(valuePart)
+	case finalStatusDirective, originalStatusDirective:
+		statusCode, statusCodeErr := fields.ParseInt(valuePart)
+		if statusCodeErr != nil {
+			return statusCodeErr
+		}
+		record.StatusCode = int32(statusCode)
+	case bodySizeDirective, bytesSentDirective:
+		bodySize, bodySizeErr := fields.ParseIntOrDash(valuePart)
+		if bodySizeErr != nil {
+			return bodySizeErr
+		}
+		record.ResponseSize = bodySize
+	case latencyMicrosDirective, latencyMillisDirective, latencySecondsDirective:
+		latency, latencyErr := fields.ParseIntOrDash(valuePart)
+		if latencyErr != nil {
+			return latencyErr
+		}
+		record.Latency = time.Duration(latency) * latencyUnitOf(d)
+	case refererDirective:
+		record.Referer = p.referersInternCache.Intern(valuePart)
+	case userAgentDirective:
+		record.UserAgent = p.userAgentsInternCache.Intern(valuePart)
+	}
+	return nil
+}
+
+func (p *LineToStoreRecordParser) parsePath(record *stat.Record, pathPart []byte) error {
+	sectionPart, sectionErr := fields.SectionOf(pathPart)
+	if sectionErr != nil {
+		return sectionErr
+	}
+	record.Path = p.pathsInternCache.Intern(pathPart)
+	record.Section = p.sectionsInternCache.Intern(sectionPart)
+	return nil
+}
+
+func (p *LineToStoreRecordParser) parseTime(d directive, timePart []byte) (int64, error) {
+	switch d {
+	case epochSecondsTimeDirective, epochMillisTimeDirective, epochMicrosTimeDirective:
+		epochTime, epochErr := fields.ParseInt(timePart)
+		if epochErr != nil {
+			return 0, epochErr
+		}
+		return epochTime / int64(time.Second/epochUnitOf(d)), nil
+	default:
+		return p.timeParser.Parse(timePart)
+	}
+}
+
+func epochUnitOf(d directive) time.Duration {
+	switch d {
+	case epochMillisTimeDirective:
+		return time.Millisecond
+	case epochMicrosTimeDirective:
+		return time.Microsecond
+	default:
+		return time.Second
+	}
+}
+
+func latencyUnitOf(d directive) time.Duration {
+	switch d {
+	case latencyMicrosDirective:
+		return time.Microsecond
+	case latencyMillisDirective:
+		return time.Millisecond
+	default:
+		return time.Second
+	}
+}
@@ -0,0 +1,97 @@
+package apache
+
+import (
+	"github.com/storozhukBM/logstat/common/test"
+	"github.com/storozhukBM/logstat/stat"
+	"testing"
+	"time"
+)
+
+func TestApacheParsing(t *testing.T) {
+	t.Parallel()
+	cases := []struct {
+		format string
+		line   string
+		result stat.Record
+	}{
+		{
+			format: `LogFormat "%h %l %u %t \"%r\" %>s %b \"%{Referer}i\" \"%{User-agent}i\"" combined`,
+			line: `127.0.0.1 - frank [10/May/2018:01:15:59 +0000] "GET /api/user HTTP/1.1" 200 34 ` +
+				`"http://example.com/start.html" "Mozilla/5.0 (X11; Linux x86_64)"`,
+			result: stat.Record{
+				UnixTime: 1525914959, Section: "/api", StatusCode: 200, ResponseSize: 34,
+				RemoteHost: "127.0.0.1", Ident: "-", AuthUser: "frank", Method: "GET", Path: "/api/user", Protocol: "HTTP/1.1",
+				Referer: "http://example.com/start.html", UserAgent: "Mozilla/5.0 (X11; Linux x86_64)",
+			},
+		},
+		{
+			format: `%h %l %u %t \"%r\" %>s %b %D`,
+			line:   `10.0.0.1 - - [10/May/2018:01:15:59 -0700] "POST /api/order?id=1 HTTP/1.0" 503 - 1520`,
+			result: stat.Record{
+				UnixTime: 1525940159, Section: "/api", StatusCode: 503, ResponseSize: 0, Latency: 1520 * time.Microsecond,
+				RemoteHost: "10.0.0.1", Ident: "-", AuthUser: "-", Method: "POST", Path: "/api/order?id=1", Protocol: "HTTP/1.0",
+			},
+		},
+		{
+			format: `%{Host}i %a %{msec}t %m %U%q %H %s %>s %O %B %T %{ms}T 100%%`,
+			line:   `example.com 10.0.0.2 1525914959123 GET /report?full=1 HTTP/2.0 302 200 400 120 1 1234 100%`,
+			result: stat.Record{
+				UnixTime: 1525914959, Section: "/report?full=1", StatusCode: 200, ResponseSize: 120, Latency: 1234 * time.Millisecond,
+				RemoteHost: "10.0.0.2", Method: "GET", Path: "/report?full=1", Protocol: "HTTP/2.0",
+			},
+		},
+		{
+			format: `[%{%d/%b/%Y %T}t] %{usec}t %400,501{User-agent}i|%!200{Referer}i|%{us}T|%^ti`,
+			line:   `[10/May/2018 01:15:59] 1525914959000000 -|-|250|`,
+			result: stat.Record{UnixTime: 1525914959, Referer: "-", UserAgent: "-", Latency: 250 * time.Microsecond},
+		},
+	}
+	for _, testCase := range cases {
+		parser, parserErr := NewLineToStoreRecordParser(testCase.format, 10)
+		test.FailOnError(t, parserErr)
+		actual, err := parser.Parse([]byte(testCase.line))
+		test.FailOnError(t, err)
+		test.Equals(t, testCase.result, actual, "mismatch on: %s", testCase.line)
+		unixTime, timeErr := parser.ParseTime([]byte(testCase.line))
+		test.FailOnError(t, timeErr)
+		test.Equals(t, testCase.result.UnixTime, unixTime, "time mismatch on: %s", testCase.line)
+	}
+}
+
+func TestApacheInvalidLines(t *testing.T) {
+	t.Parallel()
+	parser, parserErr := NewLineToStoreRecordParser(`%h %l %u %t "%r" %>s %b %D`, 0)
+	test.FailOnError(t, parserErr)
+	invalidLines := []string{
+		``,
+		`127.0.0.1 - frank [10/May/2018:01:15:59 +0000] "GET /api/user HTTP/1.1" 200 34`,
+		`127.0.0.1 - frank 10/May/2018:01:15:59 +0000 "GET /api/user HTTP/1.1" 200 34 10`,
+		`127.0.0.1 - frank [10/May/2018:01:15:59 +0000] "GET /api/user HTTP/1.1" 200 34 1.5`,
+		`127.0.0.1 - frank [10/May/2018:01:15:59 +0000] "GET /api/user HTTP/1.1" - 34 10`,
+		`127.0.0.1 - frank [10/May/2018:01:15:59 +0000] "GET /api/user HTTP/1.1 200 34 10`,
+	}
+	for _, line := range invalidLines {
+		_, err := parser.Parse([]byte(line))
+		test.Equals(t, true, err != nil, "line should be rejected: %v", line)
+	}
+}
+
+func TestApacheInvalidFormats(t *testing.T) {
+	t.Parallel()
+	invalidFormats := []string{
+		``,
+		`just literal`,
+		`%h %>s`,
+		`%h%u %t`,
+		`%t %{Referer`,
+		`%t %`,
+		`%{%d/%b/%Y}t %h`,
+		`%t %U%h`,
+		`LogFormat %h %t`,
+		`LogFormat "%h %t`,
+	}
+	for _, format := range invalidFormats {
+		_, err := NewLineToStoreRecordParser(format, 10)
+		test.Equals(t, true, err != nil, "format should be rejected: %v", format)
+	}
+}
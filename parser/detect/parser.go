@@ -0,0 +1,209 @@
+package detect
+
+import (
+	"fmt"
+	"github.com/storozhukBM/logstat/common/log"
+	"github.com/storozhukBM/logstat/stat"
+)
+
+type LineParser interface {
+	Parse(line []byte) (stat.Record, error)
+	ParseTime(line []byte) (int64, error)
+}
+
+/*
+Parser of one log format that can be detected.
+*/
+type Candidate struct {
+	Format string
+	Parser LineParser
+}
+
+/*
+A component used to detect log format of source and parse its lines with parser of detected format.
+First `sampleSize` lines are parsed by all candidates and the candidate with the best parse success rate is detected.
+
+Responsibilities:
+	- parse sampled lines by the leading candidate, or by the first candidate that succeeded if leader failed,
+	so sampled lines aren't lost
+	- report detected format of source
+	- count parse errors of detected format by windows of `sampleSize` lines,
+	warn and start detection again if error rate of window exceeds `maxErrorRate`, like when `log_format` is changed
+	- fall back to the first candidate if no candidate parses sampled lines, detection isn't started again after that,
+	so garbage input is parsed by all candidates only once
+
+Attention:
+	- candidates are ordered by priority, so candidate that parses the same lines as another one
+	should go before it if its format is more specific, like Combined Log Format before Common Log Format
+	- lines without records, like directives, are counted as parsed by candidates that skip them
+	- all candidates keep parsing while format isn't detected, so detection is several times slower than parsing
+*/
+type LineToStoreRecordParser struct {
+	source       string
+	candidates   []Candidate
+	sampleSize   uint
+	maxErrorRate float64
+
+	detected     int
+	fallenBack   bool
+	successes    []uint
+	sampledLines uint
+	windowLines  uint
+	windowErrors uint
+}
+
+/*
+Creates parser of lines from `source` that detects one of `candidates` by first `sampleSize` lines.
+`maxErrorRate` is a rate of parse errors, from 0 to 1, that triggers detection again.
+*/
+func NewLineToStoreRecordParser(
+	source string, candidates []Candidate, sampleSize uint, maxErrorRate float64,
+) (*LineToStoreRecordParser, error) {
+	if len(candidates) == 0 {
+		return nil, fmt.Errorf("candidates can't be empty")
+	}
+	for _, c := range candidates {
+		if c.Parser == nil {
+			return nil, fmt.Errorf("parser of `%v` format can't be nil", c.Format)
+		}
+	}
+	if sampleSize == 0 {
+		return nil, fmt.Errorf("sampleSize should be positive")
+	}
+	if maxErrorRate <= 0 || maxErrorRate > 1 {
+		return nil, fmt.Errorf("maxErrorRate should be in range (0, 1]: %v", maxErrorRate)
+	}
+	return &LineToStoreRecordParser{
+		source:       source,
+		candidates:   candidates,
+		sampleSize:   sampleSize,
+		maxErrorRate: maxErrorRate,
+		detected:     -1,
+		successes:    make([]uint, len(candidates)),
+	}, nil
+}
+
+/*
+Returns detected format, or empty string if format isn't detected yet.
+*/
+func (p *LineToStoreRecordParser) Format() string {
+	if p.detected == -1 {
+		return ""
+	}
+	return p.candidates[p.detected].Format
+}
+
+func (p *LineToStoreRecordParser) Parse(line []byte) (stat.Record, error) {
+	if p.detected == -1 {
+		return p.parseSample(line)
+	}
+	record, parseErr := p.candidates[p.detected].Parser.Parse(line)
+	if parseErr == stat.ErrNoRecord {
+		return record, parseErr
+	}
+	if p.fallenBack {
+		return record, parseErr
+	}
+	p.windowLines++
+	if parseErr != nil {
+		p.windowErrors++
+	}
+	if p.windowLines == p.sampleSize {
+		if float64(p.windowErrors)/float64(p.windowLines) > p.maxErrorRate {
+			log.Warn(
+				"parse errors of `%v` log format spiked, log format will be detected again; source: %v; errors: %v of %v lines",
+				p.candidates[p.detected].Format, p.source, p.windowErrors, p.windowLines,
+			)
+			p.detected = -1
+		}
+		p.windowLines, p.windowErrors = 0, 0
+	}
+	return record, parseErr
+}
+
+/*
+Parses time by detected format. While format isn't detected, time is parsed by the leading candidate,
+or by the first candidate that can parse it.
+*/
+func (p *LineToStoreRecordParser) ParseTime(line []byte) (int64, error) {
+	leader := p.leader()
+	unixTime, leaderErr := p.candidates[leader].Parser.ParseTime(line)
+	if leaderErr == nil || p.detected != -1 {
+		return unixTime, leaderErr
+	}
+	for i := range p.candidates {
+		if i == leader {
+			continue
+		}
+		unixTime, timeErr := p.candidates[i].Parser.ParseTime(line)
+		if timeErr == nil {
+			return unixTime, nil
+		}
+	}
+	return 0, leaderErr
+}
+
+func (p *LineToStoreRecordParser) parseSample(line []byte) (stat.Record, error) {
+	leader := p.leader()
+	result, resultIdx := stat.Record{}, -1
+	var resultErr, leaderErr error
+	for i := range p.candidates {
+		record, parseErr := p.candidates[i].Parser.Parse(line)
+		if parseErr != nil && parseErr != stat.ErrNoRecord {
+			if i == leader {
+				leaderErr = parseErr
+			}
+			continue
+		}
+		p.successes[i]++
+		if resultIdx == -1 || i == leader {
+			result, resultErr, resultIdx = record, parseErr, i
+		}
+	}
+
+	p.sampledLines++
+	if p.sampledLines == p.sampleSize {
+		p.finishDetection()
+	}
+	if resultIdx == -1 {
+		return stat.Record{}, leaderErr
+	}
+	return result, resultErr
+}
+
+func (p *LineToStoreRecordParser) finishDetection() {
+	best := p.leader()
+	if p.successes[best] == 0 {
+		p.detected, p.fallenBack = 0, true
+		log.Warn(
+			"can't detect log format, no format parses sampled lines, falls back to %v; source: %v; lines: %v",
+			p.candidates[0].Format, p.source, p.sampledLines,
+		)
+	} else {
+		p.detected = best
+		log.Info(
+			"log format is detected: %v; source: %v; parsed lines: %v of %v",
+			p.candidates[best].Format, p.source, p.successes[best], p.sampledLines,
+		)
+	}
+	p.sampledLines = 0
+	for i := range p.successes {
+		p.successes[i] = 0
+	}
+}
+
+/*
+Returns detected candidate, or candidate that parsed the most of sampled lines, the first one wins in case of tie.
+*/
+func (p *LineToStoreRecordParser) leader() int {
+	if p.detected != -1 {
+		return p.detected
+	}
+	leader := 0
+	for i := range p.successes {
+		if p.successes[i] > p.successes[leader] {
+			leader = i
+		}
+	}
+	return leader
+}
@@ -0,0 +1,121 @@
+package detect
+
+import (
+	"fmt"
+	"github.com/storozhukBM/logstat/common/test"
+	"github.com/storozhukBM/logstat/stat"
+	"strings"
+	"testing"
+)
+
+func TestDetection(t *testing.T) {
+	t.Parallel()
+	parser := newTestParser(t, 4)
+
+	lines := []string{"b:1", "a:2", "b:3", "x:4"}
+	for i, line := range lines {
+		record, err := parser.Parse([]byte(line))
+		if line == "x:4" {
+			test.Equals(t, true, err != nil, "line should be rejected: %v", line)
+			continue
+		}
+		test.FailOnError(t, err)
+		test.Equals(t, line, record.Path, "sampled line should be parsed")
+		test.Equals(t, "", parser.Format(), "format shouldn't be detected after %v lines", i+1)
+	}
+	test.Equals(t, "b", parser.Format(), "format with the best success rate should be detected")
+
+	_, err := parser.Parse([]byte("a:5"))
+	test.Equals(t, true, err != nil, "lines of other formats should be rejected after detection")
+	unixTime, timeErr := parser.ParseTime([]byte("b:6"))
+	test.FailOnError(t, timeErr)
+	test.Equals(t, int64(6), unixTime, "time mismatch")
+}
+
+func TestDetectionTie(t *testing.T) {
+	t.Parallel()
+	parser := newTestParser(t, 2)
+	for _, line := range []string{"ab:1", "ab:2"} {
+		_, err := parser.Parse([]byte(line))
+		test.FailOnError(t, err)
+	}
+	test.Equals(t, "a", parser.Format(), "the first candidate should win in case of tie")
+}
+
+func TestRedetection(t *testing.T) {
+	t.Parallel()
+	parser := newTestParser(t, 2)
+	for _, line := range []string{"a:1", "a:2"} {
+		_, err := parser.Parse([]byte(line))
+		test.FailOnError(t, err)
+	}
+	test.Equals(t, "a", parser.Format(), "format should be detected")
+
+	for _, line := range []string{"a:3", "b:4"} {
+		_, _ = parser.Parse([]byte(line))
+	}
+	test.Equals(t, "a", parser.Format(), "format should be kept while error rate doesn't exceed max")
+	for _, line := range []string{"b:5", "b:6"} {
+		_, _ = parser.Parse([]byte(line))
+	}
+	test.Equals(t, "", parser.Format(), "format should be detected again after errors spike")
+	for _, line := range []string{"b:7", "b:8"} {
+		record, err := parser.Parse([]byte(line))
+		test.FailOnError(t, err)
+		test.Equals(t, line, record.Path, "sampled line should be parsed by the other candidate")
+	}
+	test.Equals(t, "b", parser.Format(), "changed format should be detected")
+}
+
+func TestDetectionFailure(t *testing.T) {
+	t.Parallel()
+	parser := newTestParser(t, 2)
+	for _, line := range []string{"x:1", "x:2"} {
+		_, _ = parser.Parse([]byte(line))
+	}
+	test.Equals(t, "a", parser.Format(), "first format should be used if no candidate parses lines")
+	for _, line := range []string{"b:1", "b:2", "b:3", "b:4"} {
+		_, parseErr := parser.Parse([]byte(line))
+		test.Equals(t, true, parseErr != nil, "line should be parsed only by the first format: %v", line)
+	}
+	test.Equals(t, "a", parser.Format(), "format shouldn't be detected again after fallback")
+	_, noRecordErr := parser.Parse([]byte("#:3"))
+	test.Equals(t, stat.ErrNoRecord, noRecordErr, "line without record should be skipped")
+
+	_, emptyErr := NewLineToStoreRecordParser("test", nil, 1, 0.5)
+	test.Equals(t, true, emptyErr != nil, "empty candidates should be rejected")
+	_, rateErr := NewLineToStoreRecordParser("test", []Candidate{{Format: "a", Parser: prefixParser("a")}}, 1, 0)
+	test.Equals(t, true, rateErr != nil, "zero error rate should be rejected")
+}
+
+func newTestParser(t *testing.T, sampleSize uint) *LineToStoreRecordParser {
+	candidates := []Candidate{{Format: "a", Parser: prefixParser("a")}, {Format: "b", Parser: prefixParser("b")}}
+	parser, parserErr := NewLineToStoreRecordParser("test", candidates, sampleSize, 0.5)
+	test.FailOnError(t, parserErr)
+	return parser
+}
+
+/*
+Parses lines like `ab:12`, if they contain its prefix before `:`. Lines that start with `#` have no record.
+*/
+type prefixParser string
+
+func (p prefixParser) Parse(line []byte) (stat.Record, error) {
+	if strings.HasPrefix(string(line), "#") {
+		return stat.Record{}, stat.ErrNoRecord
+	}
+	formatEnd := strings.IndexByte(string(line), ':')
+	if formatEnd == -1 || !strings.Contains(string(line[:formatEnd]), string(p)) {
+		return stat.Record{}, fmt.Errorf("line isn't `%v`: %s", string(p), line)
+	}
+	return stat.Record{Path: string(line)}, nil
+}
+
+func (p prefixParser) ParseTime(line []byte) (int64, error) {
+	if _, parseErr := p.Parse(line); parseErr != nil {
+		return 0, parseErr
+	}
+	var unixTime int64
+	_, scanErr := fmt.Sscanf(string(line[strings.IndexByte(string(line), ':')+1:]), "%d", &unixTime)
+	return unixTime, scanErr
+}
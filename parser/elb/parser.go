@@ -0,0 +1,214 @@
+package elb
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/storozhukBM/logstat/parser/fields"
+	"github.com/storozhukBM/logstat/stat"
+	"time"
+)
+
+/*
+Columns of Classic ELB access log, ALB writes the same columns after connection type,
+like `http` or `h2`. Columns after user agent, like `ssl_cipher` or `trace_id`, are skipped.
+*/
+const (
+	timeColumn = iota
+	loadBalancerColumn
+	clientColumn
+	targetColumn
+	requestProcessingTimeColumn
+	targetProcessingTimeColumn
+	responseProcessingTimeColumn
+	elbStatusColumn
+	targetStatusColumn
+	receivedBytesColumn
+	sentBytesColumn
+	requestColumn
+	userAgentColumn
+	columnsCount
+)
+
+/*
+A component used to parse one line of AWS Application Load Balancer or Classic Load Balancer access log
+to storage req record. Line is split by spaces, quoted columns, like request and user agent, can contain spaces.
+
+Responsibilities:
+	- detect ALB lines by connection type before time, so both load balancers can be parsed by the same parser
+	- parse status code returned by load balancer and status code returned by target as upstream status code
+	- sum request, target and response processing times into latency, target processing time is upstream latency
+	- strip scheme, host and port from URL of request, so path of record starts with `/`
+	- copy required parts of line bytes to separate strings, so line bytes can be recycled and reused afterward
+
+Attention:
+	- processing times written as `-1`, because target wasn't reached, are parsed as zero
+	- status codes written as `-`, because target didn't respond, are parsed as zero
+	- TCP requests of Classic Load Balancer, written as `- - - `, are rejected
+	- port of client is stripped from remote host
+*/
+type LineToStoreRecordParser struct {
+	hostsInternCache      *fields.InternCache
+	methodsInternCache    *fields.InternCache
+	pathsInternCache      *fields.InternCache
+	protocolsInternCache  *fields.InternCache
+	sectionsInternCache   *fields.InternCache
+	userAgentsInternCache *fields.InternCache
+	unescapeBufs          [columnsCount][]byte
+}
+
+/*
+Creates parser, `internCacheSize` limits size of each cache of interned text parts.
+*/
+func NewLineToStoreRecordParser(internCacheSize uint) (*LineToStoreRecordParser, error) {
+	result := &LineToStoreRecordParser{
+		hostsInternCache:      fields.NewInternCache(internCacheSize),
+		methodsInternCache:    fields.NewInternCache(internCacheSize),
+		pathsInternCache:      fields.NewInternCache(internCacheSize),
+		protocolsInternCache:  fields.NewInternCache(internCacheSize),
+		sectionsInternCache:   fields.NewInternCache(internCacheSize),
+		userAgentsInternCache: fields.NewInternCache(internCacheSize),
+	}
+	return result, nil
+}
+
+func (p *LineToStoreRecordParser) Parse(line []byte) (stat.Record, error) {
+	var columns [columnsCount][]byte
+	scanErr := p.scanColumns(line, columns[:])
+	if scanErr != nil {
+		return stat.Record{}, scanErr
+	}
+	record := stat.Record{}
+	unixTime, timeErr := fields.ParseISO8601Time(columns[timeColumn])
+	if timeErr != nil {
+		return stat.Record{}, fmt.Errorf("can't parse time: %v", timeErr)
+	}
+	record.UnixTime = unixTime
+	record.RemoteHost = p.hostsInternCache.Intern(stripPort(columns[clientColumn]))
+
+	requestErr := p.parseRequest(&record, columns[requestColumn])
+	if requestErr != nil {
+		return stat.Record{}, fmt.Errorf("can't parse request: %v", requestErr)
+	}
+	record.UserAgent = p.userAgentsInternCache.Intern(columns[userAgentColumn])
+
+	statusCode, statusCodeErr := fields.ParseIntOrDash(columns[elbStatusColumn])
+	if statusCodeErr != nil {
+		return stat.Record{}, fmt.Errorf("can't parse status code: %v", statusCodeErr)
+	}
+	record.StatusCode = int32(statusCode)
+	upstreamStatusCode, upstreamStatusCodeErr := fields.ParseIntOrDash(columns[targetStatusColumn])
+	if upstreamStatusCodeErr != nil {
+		return stat.Record{}, fmt.Errorf("can't parse target status code: %v", upstreamStatusCodeErr)
+	}
+	record.UpstreamStatusCode = int32(upstreamStatusCode)
+	sentBytes, sentBytesErr := fields.ParseIntOrDash(columns[sentBytesColumn])
+	if sentBytesErr != nil {
+		return stat.Record{}, fmt.Errorf("can't parse sent bytes: %v", sentBytesErr)
+	}
+	record.ResponseSize = sentBytes
+
+	for _, column := range []int{requestProcessingTimeColumn, targetProcessingTimeColumn, responseProcessingTimeColumn} {
+		processingTime, processingTimeErr := parseProcessingTime(columns[column])
+		if processingTimeErr != nil {
+			return stat.Record{}, fmt.Errorf("can't parse processing time: %v", processingTimeErr)
+		}
+		record.Latency += processingTime
+		if column == targetProcessingTimeColumn {
+			record.UpstreamLatency = processingTime
+		}
+	}
+	return record, nil
+}
+
+/*
+Parses only time of the line, columns after time aren't even scanned.
+*/
+func (p *LineToStoreRecordParser) ParseTime(line []byte) (int64, error) {
+	var columns [timeColumn + 1][]byte
+	scanErr := p.scanColumns(line, columns[:])
+	if scanErr != nil {
+		return 0, scanErr
+	}
+	unixTime, timeErr := fields.ParseISO8601Time(columns[timeColumn])
+	if timeErr != nil {
+		return 0, fmt.Errorf("can't parse time: %v", timeErr)
+	}
+	return unixTime, nil
+}
+
+/*
+Scans first `len(columns)` columns of line, connection type written by ALB before time is skipped.
+Content of quoted column is valid only till the next scan.
+*/
+func (p *LineToStoreRecordParser) scanColumns(line []byte, columns [][]byte) error {
+	idx := 0
+	if len(line) > 0 && (line[0] < '0' || line[0] > '9') {
+		typeEnd := bytes.IndexByte(line, ' ')
+		if typeEnd == -1 {
+			return fmt.Errorf("enexpected format of line. can't find time")
+		}
+		idx = typeEnd + 1
+	}
+	for i := range columns {
+		if idx >= len(line) {
+			return fmt.Errorf("enexpected format of line. line has only %v of %v required columns", i, len(columns))
+		}
+		if line[idx] != '"' {
+			columnEnd := len(line)
+			if spaceIdx := bytes.IndexByte(line[idx:], ' '); spaceIdx != -1 {
+				columnEnd = idx + spaceIdx // spaceIdx is relative to idx
+			}
+			columns[i] = line[idx:columnEnd]
+			idx = columnEnd + 1
+			continue
+		}
+		quoteEnd := fields.FindClosingQuote(line, idx+1)
+		if quoteEnd == -1 {
+			return fmt.Errorf("enexpected format of line. quoted column isn't closed")
+		}
+		columns[i] = line[idx+1 : quoteEnd]
+		if bytes.IndexByte(columns[i], '\\') != -1 {
+			p.unescapeBufs[i] = fields.AppendUnescaped(p.unescapeBufs[i][:0], columns[i])
+			columns[i] = p.unescapeBufs[i]
+		}
+		idx = quoteEnd + 2
+	}
+	return nil
+}
+
+/*
+Parses request, like `GET https://www.example.com:443/api/user?id=1 HTTP/1.1`, that has full URL instead of path.
+*/
+func (p *LineToStoreRecordParser) parseRequest(record *stat.Record, requestPart []byte) error {
+	methodPart, urlPart, protocolPart, splitErr := fields.SplitRequest(requestPart)
+	if splitErr != nil {
+		return splitErr
+	}
+	pathPart := fields.PathOfURL(urlPart)
+	sectionPart, sectionErr := fields.SectionOf(pathPart)
+	if sectionErr != nil {
+		return sectionErr
+	}
+	record.Method = p.methodsInternCache.Intern(methodPart)
+	record.Protocol = p.protocolsInternCache.Intern(protocolPart)
+	record.Path = p.pathsInternCache.Intern(pathPart)
+	record.Section = p.sectionsInternCache.Intern(sectionPart)
+	return nil
+}
+
+/*
+Parses processing time in seconds, like `0.000012`, `-1` means that request wasn't processed at this stage.
+*/
+func parseProcessingTime(timePart []byte) (time.Duration, error) {
+	if bytes.Equal(timePart, []byte("-1")) {
+		return 0, nil
+	}
+	return fields.ParseDuration(timePart, time.Second)
+}
+
+func stripPort(hostPart []byte) []byte {
+	if portStart := bytes.LastIndexByte(hostPart, ':'); portStart != -1 {
+		return hostPart[:portStart]
+	}
+	return hostPart
+}
@@ -0,0 +1,77 @@
+package elb
+
+import (
+	"github.com/storozhukBM/logstat/common/test"
+	"github.com/storozhukBM/logstat/stat"
+	"testing"
+	"time"
+)
+
+func TestParsing(t *testing.T) {
+	t.Parallel()
+	parser, parserErr := NewLineToStoreRecordParser(10)
+	test.FailOnError(t, parserErr)
+
+	cases := []struct {
+		line   string
+		result stat.Record
+	}{
+		{
+			line: `http 2018-07-02T22:23:00.186641Z app/my-loadbalancer/50dc6c495c0c9188 192.168.131.39:2817 10.0.0.1:80 ` +
+				`0.000 0.001 0.000 200 200 34 366 "GET http://www.example.com:80/api/user?id=1 HTTP/1.1" "curl/7.46.0" - - ` +
+				`arn:aws:elasticloadbalancing:us-east-2:123456789012:targetgroup/my-targets/73e2d6bc24d8a067 ` +
+				`"Root=1-58337262-36d228ad5d99923122bbe354" "-" "-" 0 2018-07-02T22:22:48.364000Z "forward" "-" "-" "10.0.0.1:80" "200" "-" "-"`,
+			result: stat.Record{
+				UnixTime: 1530570180, Section: "/api", StatusCode: 200, ResponseSize: 366,
+				RemoteHost: "192.168.131.39", Method: "GET", Path: "/api/user?id=1", Protocol: "HTTP/1.1", UserAgent: "curl/7.46.0",
+				Latency: time.Millisecond, UpstreamStatusCode: 200, UpstreamLatency: time.Millisecond,
+			},
+		},
+		{
+			line: `https 2018-07-02T22:23:00.186641Z app/my-loadbalancer/50dc6c495c0c9188 192.168.131.39:2817 - ` +
+				`-1 -1 -1 502 - 34 366 "POST https://www.example.com:443 HTTP/1.1" "Mozilla/5.0 \"quoted\""`,
+			result: stat.Record{
+				UnixTime: 1530570180, Section: "/", StatusCode: 502, ResponseSize: 366,
+				RemoteHost: "192.168.131.39", Method: "POST", Path: "/", Protocol: "HTTP/1.1", UserAgent: `Mozilla/5.0 "quoted"`,
+			},
+		},
+		{
+			line: `2015-05-13T23:39:43.945958Z my-loadbalancer 192.168.131.39:2817 10.0.0.1:80 0.000073 0.001048 0.000057 ` +
+				`200 200 0 29 "GET http://www.example.com:80/ HTTP/1.1" "curl/7.38.0" - -`,
+			result: stat.Record{
+				UnixTime: 1431560383, Section: "/", StatusCode: 200, ResponseSize: 29,
+				RemoteHost: "192.168.131.39", Method: "GET", Path: "/", Protocol: "HTTP/1.1", UserAgent: "curl/7.38.0",
+				Latency: 1178 * time.Microsecond, UpstreamStatusCode: 200, UpstreamLatency: 1048 * time.Microsecond,
+			},
+		},
+	}
+	for _, c := range cases {
+		record, err := parser.Parse([]byte(c.line))
+		test.FailOnError(t, err)
+		test.Equals(t, c.result, record, "record mismatch of line: %v", c.line)
+
+		unixTime, timeErr := parser.ParseTime([]byte(c.line))
+		test.FailOnError(t, timeErr)
+		test.Equals(t, c.result.UnixTime, unixTime, "time mismatch of line: %v", c.line)
+	}
+}
+
+func TestParsingErrors(t *testing.T) {
+	t.Parallel()
+	parser, parserErr := NewLineToStoreRecordParser(10)
+	test.FailOnError(t, parserErr)
+	lines := []string{
+		``,
+		`http`,
+		`http 2018-07-02T22:23:00.186641Z app/my-loadbalancer/50dc6c495c0c9188 192.168.131.39:2817`,
+		`http 2018-07-02 app/lb 192.168.131.39:2817 - 0 0 0 200 200 34 366 "GET http://example.com/ HTTP/1.1" "curl"`,
+		`http 2018-07-02T22:23:00Z app/lb 192.168.131.39:2817 - 0 0 0 x 200 34 366 "GET http://example.com/ HTTP/1.1" "curl"`,
+		`http 2018-07-02T22:23:00Z app/lb 192.168.131.39:2817 - 0 x 0 200 200 34 366 "GET http://example.com/ HTTP/1.1" "curl"`,
+		`http 2018-07-02T22:23:00Z app/lb 192.168.131.39:2817 - 0 0 0 200 200 34 366 "GET http://example.com/ HTTP/1.1`,
+		`2015-05-13T23:39:43.945958Z my-lb 192.168.131.39:2817 10.0.0.1:80 0.1 0.1 0.1 - - 57 502 "- - - " "-"`,
+	}
+	for _, line := range lines {
+		_, err := parser.Parse([]byte(line))
+		test.Equals(t, true, err != nil, "line should be rejected: %v", line)
+	}
+}
@@ -0,0 +1,194 @@
+package envoy
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/storozhukBM/logstat/parser/fields"
+	"github.com/storozhukBM/logstat/stat"
+	"time"
+)
+
+/*
+Columns of Envoy default access log format that follow start time and request.
+Columns after user agent, like `X-REQUEST-ID` or upstream host, are skipped.
+*/
+const (
+	responseCodeColumn = iota
+	responseFlagsColumn
+	bytesReceivedColumn
+	bytesSentColumn
+	durationColumn
+	upstreamServiceTimeColumn
+	forwardedForColumn
+	userAgentColumn
+	columnsCount
+)
+
+/*
+A component used to parse one line of Envoy default access log format to storage req record. For example,
+`[2016-04-15T20:17:00.310Z] "POST /api/v1/locations HTTP/2" 204 - 154 0 226 100 "10.0.35.28" "nsq2http" ...`.
+
+Responsibilities:
+	- parse start time, request, response code, bytes sent and user agent
+	- parse `DURATION` as latency and `X-ENVOY-UPSTREAM-SERVICE-TIME` as upstream latency, both in milliseconds
+	- use the first address of `X-FORWARDED-FOR` as remote host
+	- copy required parts of line bytes to separate strings, so line bytes can be recycled and reused afterward
+
+Attention:
+	- values written by Envoy as `-`, because they are absent, are stored as is, but numbers are parsed as zero
+	- TCP connections, written with request `- - -`, are rejected
+*/
+type LineToStoreRecordParser struct {
+	hostsInternCache      *fields.InternCache
+	methodsInternCache    *fields.InternCache
+	pathsInternCache      *fields.InternCache
+	protocolsInternCache  *fields.InternCache
+	sectionsInternCache   *fields.InternCache
+	userAgentsInternCache *fields.InternCache
+}
+
+/*
+Creates parser, `internCacheSize` limits size of each cache of interned text parts.
+*/
+func NewLineToStoreRecordParser(internCacheSize uint) (*LineToStoreRecordParser, error) {
+	result := &LineToStoreRecordParser{
+		hostsInternCache:      fields.NewInternCache(internCacheSize),
+		methodsInternCache:    fields.NewInternCache(internCacheSize),
+		pathsInternCache:      fields.NewInternCache(internCacheSize),
+		protocolsInternCache:  fields.NewInternCache(internCacheSize),
+		sectionsInternCache:   fields.NewInternCache(internCacheSize),
+		userAgentsInternCache: fields.NewInternCache(internCacheSize),
+	}
+	return result, nil
+}
+
+func (p *LineToStoreRecordParser) Parse(line []byte) (stat.Record, error) {
+	timePart, timePartEnd, timeFindErr := findTimePart(line)
+	if timeFindErr != nil {
+		return stat.Record{}, timeFindErr
+	}
+	record := stat.Record{}
+	unixTime, timeErr := fields.ParseISO8601Time(timePart)
+	if timeErr != nil {
+		return stat.Record{}, fmt.Errorf("can't parse start time: %v", timeErr)
+	}
+	record.UnixTime = unixTime
+
+	if timePartEnd+1 >= len(line) || line[timePartEnd] != ' ' || line[timePartEnd+1] != '"' {
+		return stat.Record{}, fmt.Errorf("enexpected format of line. can't find request after start time")
+	}
+	requestEnd := fields.FindClosingQuote(line, timePartEnd+2)
+	if requestEnd == -1 {
+		return stat.Record{}, fmt.Errorf("enexpected format of line. request isn't closed")
+	}
+	requestErr := p.parseRequest(&record, line[timePartEnd+2:requestEnd])
+	if requestErr != nil {
+		return stat.Record{}, fmt.Errorf("can't parse request: %v", requestErr)
+	}
+
+	var columns [columnsCount][]byte
+	scanErr := scanColumns(line, requestEnd+1, columns[:])
+	if scanErr != nil {
+		return stat.Record{}, scanErr
+	}
+	statusCode, statusCodeErr := fields.ParseInt(columns[responseCodeColumn])
+	if statusCodeErr != nil {
+		return stat.Record{}, fmt.Errorf("can't parse response code: %v", statusCodeErr)
+	}
+	record.StatusCode = int32(statusCode)
+	bytesSent, bytesSentErr := fields.ParseIntOrDash(columns[bytesSentColumn])
+	if bytesSentErr != nil {
+		return stat.Record{}, fmt.Errorf("can't parse bytes sent: %v", bytesSentErr)
+	}
+	record.ResponseSize = bytesSent
+	duration, durationErr := fields.ParseIntOrDash(columns[durationColumn])
+	if durationErr != nil {
+		return stat.Record{}, fmt.Errorf("can't parse duration: %v", durationErr)
+	}
+	record.Latency = time.Duration(duration) * time.Millisecond
+	upstreamServiceTime, upstreamServiceTimeErr := fields.ParseIntOrDash(columns[upstreamServiceTimeColumn])
+	if upstreamServiceTimeErr != nil {
+		return stat.Record{}, fmt.Errorf("can't parse upstream service time: %v", upstreamServiceTimeErr)
+	}
+	record.UpstreamLatency = time.Duration(upstreamServiceTime) * time.Millisecond
+
+	forwardedFor := columns[forwardedForColumn]
+	if addressEnd := bytes.IndexByte(forwardedFor, ','); addressEnd != -1 {
+		forwardedFor = forwardedFor[:addressEnd]
+	}
+	record.RemoteHost = p.hostsInternCache.Intern(forwardedFor)
+	record.UserAgent = p.userAgentsInternCache.Intern(columns[userAgentColumn])
+	return record, nil
+}
+
+/*
+Parses only start time of the line, parts after it aren't even scanned.
+*/
+func (p *LineToStoreRecordParser) ParseTime(line []byte) (int64, error) {
+	timePart, _, timeFindErr := findTimePart(line)
+	if timeFindErr != nil {
+		return 0, timeFindErr
+	}
+	unixTime, timeErr := fields.ParseISO8601Time(timePart)
+	if timeErr != nil {
+		return 0, fmt.Errorf("can't parse start time: %v", timeErr)
+	}
+	return unixTime, nil
+}
+
+func findTimePart(line []byte) ([]byte, int, error) {
+	if len(line) == 0 || line[0] != '[' {
+		return nil, 0, fmt.Errorf("enexpected format of line. line should start with `[`")
+	}
+	timePartEnd := bytes.IndexByte(line, ']')
+	if timePartEnd == -1 {
+		return nil, 0, fmt.Errorf("enexpected format of line. start time isn't closed")
+	}
+	return line[1:timePartEnd], timePartEnd + 1, nil
+}
+
+func (p *LineToStoreRecordParser) parseRequest(record *stat.Record, requestPart []byte) error {
+	methodPart, urlPart, protocolPart, splitErr := fields.SplitRequest(requestPart)
+	if splitErr != nil {
+		return splitErr
+	}
+	pathPart := fields.PathOfURL(urlPart)
+	sectionPart, sectionErr := fields.SectionOf(pathPart)
+	if sectionErr != nil {
+		return sectionErr
+	}
+	record.Method = p.methodsInternCache.Intern(methodPart)
+	record.Protocol = p.protocolsInternCache.Intern(protocolPart)
+	record.Path = p.pathsInternCache.Intern(pathPart)
+	record.Section = p.sectionsInternCache.Intern(sectionPart)
+	return nil
+}
+
+/*
+Scans space-separated columns that start at `columnsStart`, quoted columns are returned without quotes.
+*/
+func scanColumns(line []byte, columnsStart int, columns [][]byte) error {
+	idx := columnsStart
+	for i := range columns {
+		if idx >= len(line) || line[idx] != ' ' || idx+1 >= len(line) {
+			return fmt.Errorf("enexpected format of line. line has only %v of %v columns after request", i, len(columns))
+		}
+		idx++
+		if line[idx] != '"' {
+			columnEnd := len(line)
+			if spaceIdx := bytes.IndexByte(line[idx:], ' '); spaceIdx != -1 {
+				columnEnd = idx + spaceIdx // spaceIdx is relative to idx
+			}
+			columns[i] = line[idx:columnEnd]
+			idx = columnEnd
+			continue
+		}
+		quoteEnd := fields.FindClosingQuote(line, idx+1)
+		if quoteEnd == -1 {
+			return fmt.Errorf("enexpected format of line. quoted column isn't closed")
+		}
+		columns[i] = line[idx+1 : quoteEnd]
+		idx = quoteEnd + 1
+	}
+	return nil
+}
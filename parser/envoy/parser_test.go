@@ -0,0 +1,70 @@
+package envoy
+
+import (
+	"github.com/storozhukBM/logstat/common/test"
+	"github.com/storozhukBM/logstat/stat"
+	"testing"
+	"time"
+)
+
+func TestParsing(t *testing.T) {
+	t.Parallel()
+	parser, parserErr := NewLineToStoreRecordParser(10)
+	test.FailOnError(t, parserErr)
+
+	cases := []struct {
+		line   string
+		result stat.Record
+	}{
+		{
+			line: `[2016-04-15T20:17:00.310Z] "POST /api/v1/locations HTTP/2" 204 - 154 0 226 100 "10.0.35.28" "nsq2http" ` +
+				`"cc21d9b0-cf5c-432b-8c7e-98aeb7988cd2" "locations" "tcp://10.0.2.1:80"`,
+			result: stat.Record{
+				UnixTime: 1460751420, Section: "/api", StatusCode: 204,
+				RemoteHost: "10.0.35.28", Method: "POST", Path: "/api/v1/locations", Protocol: "HTTP/2", UserAgent: "nsq2http",
+				Latency: 226 * time.Millisecond, UpstreamLatency: 100 * time.Millisecond,
+			},
+		},
+		{
+			line: `[2016-04-15T20:17:01.000Z] "GET /health HTTP/1.1" 503 UF,URX 0 91 3 - "10.0.35.28, 10.0.0.1" "-" ` +
+				`"-" "health" "-"`,
+			result: stat.Record{
+				UnixTime: 1460751421, Section: "/health", StatusCode: 503, ResponseSize: 91,
+				RemoteHost: "10.0.35.28", Method: "GET", Path: "/health", Protocol: "HTTP/1.1", UserAgent: "-",
+				Latency: 3 * time.Millisecond,
+			},
+		},
+	}
+	for _, c := range cases {
+		record, err := parser.Parse([]byte(c.line))
+		test.FailOnError(t, err)
+		test.Equals(t, c.result, record, "record mismatch of line: %v", c.line)
+
+		unixTime, timeErr := parser.ParseTime([]byte(c.line))
+		test.FailOnError(t, timeErr)
+		test.Equals(t, c.result.UnixTime, unixTime, "time mismatch of line: %v", c.line)
+	}
+}
+
+func TestParsingErrors(t *testing.T) {
+	t.Parallel()
+	parser, parserErr := NewLineToStoreRecordParser(10)
+	test.FailOnError(t, parserErr)
+	lines := []string{
+		``,
+		`2016-04-15T20:17:00.310Z "GET / HTTP/1.1" 200 - 0 0 1 - "-" "-"`,
+		`[2016-04-15T20:17:00.310Z "GET / HTTP/1.1" 200 - 0 0 1 - "-" "-"`,
+		`[2016-04-15] "GET / HTTP/1.1" 200 - 0 0 1 - "-" "-"`,
+		`[2016-04-15T20:17:00.310Z] GET / HTTP/1.1 200 - 0 0 1 - "-" "-"`,
+		`[2016-04-15T20:17:00.310Z] "GET / HTTP/1.1 200 - 0 0 1 - "-" "-`,
+		`[2016-04-15T20:17:00.310Z] "- - -" 0 UF 0 0 1 - "-" "-"`,
+		`[2016-04-15T20:17:00.310Z] "GET / HTTP/1.1" 200 - 0 0 1 -`,
+		`[2016-04-15T20:17:00.310Z] "GET / HTTP/1.1" - - 0 0 1 - "-" "-"`,
+		`[2016-04-15T20:17:00.310Z] "GET / HTTP/1.1" 200 - 0 0 x - "-" "-"`,
+		`[2016-04-15T20:17:00.310Z] "GET / HTTP/1.1" 200 - 0 0 1 - "-" "-`,
+	}
+	for _, line := range lines {
+		_, err := parser.Parse([]byte(line))
+		test.Equals(t, true, err != nil, "line should be rejected: %v", line)
+	}
+}
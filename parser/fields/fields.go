@@ -0,0 +1,435 @@
+package fields
+
+import (
+	"bytes"
+	"fmt"
+	"hash"
+	"hash/fnv"
+	"strconv"
+	"time"
+	"unicode/utf16"
+	"unicode/utf8"
+	"unsafe"
+)
+
+/*
+Building blocks shared by parsers of different log formats.
+They work with views of line bytes and avoid allocations in the hot path.
+*/
+
+const CommonLogTimeLayout = "02/Jan/2006:15:04:05 -0700"
+
+/*
+Cache of strings that eliminates allocation of repeated text parts of lines, like sections or methods.
+Cache is cleared when its size limit is reached, as protection from memory leaks.
+Zero size means that every part is allocated as a new string.
+*/
+type InternCache struct {
+	size       int
+	internHash hash.Hash32
+	parts      map[uint32]string
+}
+
+func NewInternCache(size uint) *InternCache {
+	return &InternCache{
+		size:       int(size),
+		internHash: fnv.New32a(),
+		parts:      make(map[uint32]string),
+	}
+}
+
+func (c *InternCache) Intern(part []byte) string {
+	if c.size == 0 {
+		return string(part)
+	}
+	if len(c.parts) >= c.size {
+		c.parts = make(map[uint32]string)
+	}
+
+	partStr := bytesView(part)
+	c.internHash.Reset()
+	_, _ = c.internHash.Write(part)
+	partHash := c.internHash.Sum32()
+	partFromCache, ok := c.parts[partHash]
+	if ok && partStr == partFromCache {
+		return partFromCache
+	}
+	partString := string(part)
+	c.parts[partHash] = partString
+	return partString
+}
+
+/*
+Time parser of Common Log Format time, like `10/Oct/2000:13:55:36 -0700`,
+with cache to avoid parsing date and timezone.
+*/
+type CommonLogTimeParser struct {
+	lastFullyParsedTimePart                  []byte
+	lastFullyParsedTimeStartOfTheDayUnixTime int64
+}
+
+func (p *CommonLogTimeParser) Parse(timePart []byte) (int64, error) {
+	if len(timePart) != len(CommonLogTimeLayout) {
+		return 0, fmt.Errorf("enexpected format of time. length mismatch: `%s`", timePart)
+	}
+	if p.lastFullyParsedTimePart == nil {
+		return p.regularTimeParse(timePart)
+	}
+
+	{
+		cacheZonePart := p.lastFullyParsedTimePart[len(p.lastFullyParsedTimePart)-5:]
+		targetZonePart := timePart[len(timePart)-5:]
+		if !bytes.Equal(cacheZonePart, targetZonePart) {
+			return p.regularTimeParse(timePart)
+		}
+	}
+
+	{
+		cacheDatePart := p.lastFullyParsedTimePart[:len(p.lastFullyParsedTimePart)-15]
+		targetDatePart := timePart[:len(timePart)-15]
+		if !bytes.Equal(cacheDatePart, targetDatePart) {
+			return p.regularTimeParse(timePart)
+		}
+	}
+	targetHourPart := timePart[len(timePart)-14 : len(timePart)-12]
+	targetMinutePart := timePart[len(timePart)-11 : len(timePart)-9]
+	targetSecondPart := timePart[len(timePart)-8 : len(timePart)-6]
+
+	hour, hourErr := ParseInt(targetHourPart)
+	if hourErr != nil {
+		return 0, hourErr
+	}
+	minute, minuteErr := ParseInt(targetMinutePart)
+	if minuteErr != nil {
+		return 0, minuteErr
+	}
+	second, secondErr := ParseInt(targetSecondPart)
+	if secondErr != nil {
+		return 0, secondErr
+	}
+
+	secondOfDayUnixTime := (hour * 3600) + (minute * 60) + second
+	return p.lastFullyParsedTimeStartOfTheDayUnixTime + secondOfDayUnixTime, nil
+}
+
+/*
+This parser is really slow (due to generalized layout) [determined by profiling via pprof].
+So we use it only to parse date and timezone and cache results.
+We parse using time.UTC zone to avoid allocations of *time.Location
+*/
+func (p *CommonLogTimeParser) regularTimeParse(timePart []byte) (int64, error) {
+	t, parsingErr := time.ParseInLocation(CommonLogTimeLayout, bytesView(timePart), time.UTC)
+	if parsingErr != nil {
+		return 0, parsingErr
+	}
+	// start of the day in zone of parsed time, so cached seconds of the day are added in the same zone
+	p.lastFullyParsedTimeStartOfTheDayUnixTime = t.Unix() - int64(t.Hour()*3600+t.Minute()*60+t.Second())
+	p.lastFullyParsedTimePart = make([]byte, len(timePart))
+	copy(p.lastFullyParsedTimePart, timePart)
+	return t.Unix(), nil
+}
+
+/*
+Parses ISO 8601 time, like `2018-05-09T16:00:39+00:00` or `2018-05-09T16:00:39.123456Z`.
+*/
+func ParseISO8601Time(timePart []byte) (int64, error) {
+	t, parsingErr := time.ParseInLocation(time.RFC3339Nano, bytesView(timePart), time.UTC)
+	if parsingErr != nil {
+		return 0, parsingErr
+	}
+	return t.Unix(), nil
+}
+
+/*
+Parses unix time in seconds with optional fraction, like `1525881639.123`. Fraction is truncated.
+*/
+func ParseEpochTime(timePart []byte) (int64, error) {
+	if fractionStart := bytes.IndexByte(timePart, '.'); fractionStart != -1 {
+		timePart = timePart[:fractionStart]
+	}
+	if len(timePart) == 0 {
+		return 0, fmt.Errorf("can't parse epoch time: empty seconds part")
+	}
+	return ParseInt(timePart)
+}
+
+/*
+Simplified int parser that is faster than `strconv.ParseInt` etc.
+We don't need to parse signs like `-` or `+` and we don't need any scientific notation.
+And our base is always 10.
+*/
+func ParseInt(intPart []byte) (int64, error) {
+	if len(intPart) == 0 {
+		return 0, fmt.Errorf("can't parse int: empty part")
+	}
+	number := int64(0)
+	for _, d := range intPart {
+		if d < '0' || d > '9' {
+			return 0, fmt.Errorf("can't parse int: `%s`", string(intPart))
+		}
+		number *= 10
+		number += int64(d - '0')
+	}
+	return number, nil
+}
+
+/*
+Parses int that is written as `-` when it is absent, like body size of response without body.
+*/
+func ParseIntOrDash(intPart []byte) (int64, error) {
+	if len(intPart) == 1 && intPart[0] == '-' {
+		return 0, nil
+	}
+	return ParseInt(intPart)
+}
+
+/*
+Parses duration written as number of `unit`s with optional fraction, like `0.005` seconds,
+or written with its own units, like `12ms` or `1m30s`. Absent duration written as `-` is parsed as zero.
+*/
+func ParseDuration(durationPart []byte, unit time.Duration) (time.Duration, error) {
+	if len(durationPart) == 0 {
+		return 0, fmt.Errorf("can't parse duration: empty part")
+	}
+	if len(durationPart) == 1 && durationPart[0] == '-' {
+		return 0, nil
+	}
+	lastChar := durationPart[len(durationPart)-1]
+	if lastChar < '0' || lastChar > '9' {
+		duration, parsingErr := time.ParseDuration(bytesView(durationPart))
+		if parsingErr != nil {
+			return 0, fmt.Errorf("can't parse duration: `%s`", durationPart)
+		}
+		return duration, nil
+	}
+	if bytes.IndexByte(durationPart, '.') == -1 {
+		units, parsingErr := ParseInt(durationPart)
+		if parsingErr != nil {
+			return 0, parsingErr
+		}
+		return time.Duration(units) * unit, nil
+	}
+	units, parsingErr := strconv.ParseFloat(bytesView(durationPart), 64)
+	if parsingErr != nil || units < 0 {
+		return 0, fmt.Errorf("can't parse duration: `%s`", durationPart)
+	}
+	return time.Duration(units * float64(unit)), nil
+}
+
+/*
+Splits request line, like `GET /api/user HTTP/1.1`, into method, path and protocol.
+Protocol is absent in HTTP/0.9 requests, so it can be empty.
+*/
+func SplitRequest(requestPart []byte) ([]byte, []byte, []byte, error) {
+	methodPartEnd := bytes.IndexByte(requestPart, ' ')
+	if methodPartEnd == -1 {
+		return nil, nil, nil, fmt.Errorf("enexpected format of request. can't parse method part end")
+	}
+	pathPart := requestPart[methodPartEnd+1:]
+	protocolPart := requestPart[len(requestPart):]
+	if protocolPartStart := bytes.LastIndexByte(pathPart, ' '); protocolPartStart != -1 {
+		protocolPart = pathPart[protocolPartStart+1:]
+		pathPart = pathPart[:protocolPartStart]
+	}
+	return requestPart[:methodPartEnd], pathPart, protocolPart, nil
+}
+
+var rootPath = []byte("/")
+
+/*
+Returns path of URL, like `/api/user?id=1` of `https://www.example.com:443/api/user?id=1`,
+that is written by proxies and load balancers instead of path. URL without scheme is returned as is.
+*/
+func PathOfURL(urlPart []byte) []byte {
+	schemeEnd := bytes.Index(urlPart, []byte("://"))
+	if schemeEnd == -1 {
+		return urlPart
+	}
+	hostPart := urlPart[schemeEnd+len("://"):]
+	pathStart := bytes.IndexByte(hostPart, '/')
+	if pathStart == -1 {
+		return rootPath
+	}
+	return hostPart[pathStart:]
+}
+
+/*
+Section is the first segment of the path, like `/api` for `/api/user`.
+*/
+func SectionOf(pathPart []byte) ([]byte, error) {
+	sectionPartStart := bytes.IndexByte(pathPart, '/')
+	if sectionPartStart == -1 {
+		return nil, fmt.Errorf("enexpected format of path. can't parse section part")
+	}
+	sectionPart := pathPart[sectionPartStart:]
+	subSectionEnd := bytes.IndexByte(sectionPart[1:], '/')
+	if subSectionEnd != -1 {
+		sectionPart = sectionPart[0 : subSectionEnd+1]
+	}
+	return sectionPart, nil
+}
+
+/*
+Finds quote that closes quoted part started at `partStart`, quotes escaped by `\` are skipped.
+*/
+func FindClosingQuote(line []byte, partStart int) int {
+	for idx := partStart; idx < len(line); {
+		quoteIdx := bytes.IndexByte(line[idx:], '"')
+		if quoteIdx == -1 {
+			return -1
+		}
+		quoteIdx = idx + quoteIdx // quoteIdx is relative to idx
+		backslashes := 0
+		for i := quoteIdx - 1; i >= partStart && line[i] == '\\'; i-- {
+			backslashes++
+		}
+		if backslashes%2 == 0 {
+			return quoteIdx
+		}
+		idx = quoteIdx + 1
+	}
+	return -1
+}
+
+/*
+Appends quoted part to `dst` with unescaped quotes and backslashes, other escape sequences are kept as is.
+*/
+func AppendUnescaped(dst []byte, quotedPart []byte) []byte {
+	for i := 0; i < len(quotedPart); i++ {
+		if quotedPart[i] == '\\' && i+1 < len(quotedPart) && (quotedPart[i+1] == '"' || quotedPart[i+1] == '\\') {
+			i++
+		}
+		dst = append(dst, quotedPart[i])
+	}
+	return dst
+}
+
+/*
+Appends quoted part to `dst` with all escape sequences of JSON unescaped, including `\uXXXX`.
+The same escape sequences are used by logfmt.
+*/
+func AppendUnescapedJSON(dst []byte, quotedPart []byte) ([]byte, error) {
+	for i := 0; i < len(quotedPart); i++ {
+		if quotedPart[i] != '\\' {
+			dst = append(dst, quotedPart[i])
+			continue
+		}
+		i++
+		if i >= len(quotedPart) {
+			return nil, fmt.Errorf("enexpected format of line. string ends with `\\`")
+		}
+		switch quotedPart[i] {
+		case '"', '\\', '/':
+			dst = append(dst, quotedPart[i])
+		case 'b':
+			dst = append(dst, '\b')
+		case 'f':
+			dst = append(dst, '\f')
+		case 'n':
+			dst = append(dst, '\n')
+		case 'r':
+			dst = append(dst, '\r')
+		case 't':
+			dst = append(dst, '\t')
+		case 'u':
+			r, runeEnd, runeErr := parseEscapedRune(quotedPart, i+1)
+			if runeErr != nil {
+				return nil, runeErr
+			}
+			dst = appendRune(dst, r)
+			i = runeEnd - 1
+		default:
+			return nil, fmt.Errorf("enexpected format of line. unknown escape sequence `\\%c`", quotedPart[i])
+		}
+	}
+	return dst, nil
+}
+
+/*
+Parses 4 hex digits of `\uXXXX` that start at `hexStart`, surrogate pairs are joined into one rune.
+*/
+func parseEscapedRune(quotedPart []byte, hexStart int) (rune, int, error) {
+	r, hexErr := parseHex4(quotedPart, hexStart)
+	if hexErr != nil {
+		return 0, 0, hexErr
+	}
+	runeEnd := hexStart + 4
+	if utf16.IsSurrogate(r) && runeEnd+6 <= len(quotedPart) && quotedPart[runeEnd] == '\\' && quotedPart[runeEnd+1] == 'u' {
+		low, lowErr := parseHex4(quotedPart, runeEnd+2)
+		if lowErr == nil {
+			if joined := utf16.DecodeRune(r, low); joined != utf8.RuneError {
+				return joined, runeEnd + 6, nil
+			}
+		}
+	}
+	return r, runeEnd, nil
+}
+
+func parseHex4(quotedPart []byte, hexStart int) (rune, error) {
+	if hexStart+4 > len(quotedPart) {
+		return 0, fmt.Errorf("enexpected format of line. `\\u` escape sequence is cropped")
+	}
+	r := rune(0)
+	for _, c := range quotedPart[hexStart : hexStart+4] {
+		r <<= 4
+		switch {
+		case c >= '0' && c <= '9':
+			r += rune(c - '0')
+		case c >= 'a' && c <= 'f':
+			r += rune(c - 'a' + 10)
+		case c >= 'A' && c <= 'F':
+			r += rune(c - 'A' + 10)
+		default:
+			return 0, fmt.Errorf("enexpected format of line. `\\u` escape sequence has non hex digit `%c`", c)
+		}
+	}
+	return r, nil
+}
+
+func appendRune(dst []byte, r rune) []byte {
+	var runeBuf [utf8.UTFMax]byte
+	n := utf8.EncodeRune(runeBuf[:], r)
+	return append(dst, runeBuf[:n]...)
+}
+
+/*
+Finds the end of value that starts at `valueStart` and is followed by `suffix` literal of log format,
+value runs till the end of line if there is no suffix. Quoted value can contain quotes escaped by `\`.
+Used by parsers compiled from format definitions, like nginx `log_format`.
+*/
+func FindValueEnd(line []byte, valueStart int, suffix []byte, quoted bool) (int, error) {
+	if valueStart > len(line) {
+		return 0, fmt.Errorf("enexpected format of line. line is cropped")
+	}
+	if quoted {
+		valueEnd := FindClosingQuote(line, valueStart)
+		if valueEnd == -1 || !bytes.HasPrefix(line[valueEnd:], suffix) {
+			return 0, fmt.Errorf("enexpected format of line. can't find closing `%s`", suffix)
+		}
+		return valueEnd, nil
+	}
+	valueEnd := len(line) - valueStart
+	switch {
+	case len(suffix) == 1:
+		valueEnd = bytes.IndexByte(line[valueStart:], suffix[0])
+	case len(suffix) > 1:
+		valueEnd = bytes.Index(line[valueStart:], suffix)
+	}
+	if valueEnd == -1 {
+		return 0, fmt.Errorf("enexpected format of line. can't find `%s`", suffix)
+	}
+	return valueStart + valueEnd, nil // valueEnd is relative to valueStart
+}
+
+/*
+Value of format is quoted if literal before it ends with quote and literal after it starts with quote.
+*/
+func IsQuoted(literalBefore []byte, literalAfter []byte) bool {
+	return len(literalBefore) > 0 && literalBefore[len(literalBefore)-1] == '"' &&
+		len(literalAfter) > 0 && literalAfter[0] == '"'
+}
+
+// bytes to string without potential allocation, string is valid only while bytes aren't changed
+func bytesView(part []byte) string {
+	return *(*string)(unsafe.Pointer(&part))
+}
@@ -0,0 +1,150 @@
+package fields
+
+import (
+	"github.com/storozhukBM/logstat/common/test"
+	"testing"
+	"time"
+)
+
+func TestCommonLogTimeParser(t *testing.T) {
+	t.Parallel()
+	parser := CommonLogTimeParser{}
+	cases := []struct {
+		timePart string
+		unixTime int64
+	}{
+		{timePart: "09/May/2018:16:00:39 +0000", unixTime: 1525881639},
+		// the same date is parsed from cache
+		{timePart: "09/May/2018:23:59:59 +0000", unixTime: 1525910399},
+		{timePart: "10/May/2018:01:15:59 +0000", unixTime: 1525914959},
+		{timePart: "10/May/2018:01:15:59 -0700", unixTime: 1525940159},
+		{timePart: "10/May/2018:01:16:00 -0700", unixTime: 1525940160},
+	}
+	for _, testCase := range cases {
+		unixTime, err := parser.Parse([]byte(testCase.timePart))
+		test.FailOnError(t, err)
+		test.Equals(t, testCase.unixTime, unixTime, "mismatch on: %v", testCase.timePart)
+	}
+	for _, timePart := range []string{"", "10/May/2018:01:15:59", "10/May/2018:01:1x:59 -0700", "10/Mai/2018:01:15:59 +0000"} {
+		_, err := parser.Parse([]byte(timePart))
+		test.Equals(t, true, err != nil, "time should be rejected: %v", timePart)
+	}
+}
+
+func TestOtherTimeFormats(t *testing.T) {
+	t.Parallel()
+	unixTime, isoErr := ParseISO8601Time([]byte("2018-05-09T16:00:39+00:00"))
+	test.FailOnError(t, isoErr)
+	test.Equals(t, int64(1525881639), unixTime, "unexpected `unixTime`")
+	unixTime, isoErr = ParseISO8601Time([]byte("2018-05-09T16:00:39.123456Z"))
+	test.FailOnError(t, isoErr)
+	test.Equals(t, int64(1525881639), unixTime, "unexpected `unixTime`")
+
+	unixTime, epochErr := ParseEpochTime([]byte("1525881639.123"))
+	test.FailOnError(t, epochErr)
+	test.Equals(t, int64(1525881639), unixTime, "unexpected `unixTime`")
+	unixTime, epochErr = ParseEpochTime([]byte("1525881639"))
+	test.FailOnError(t, epochErr)
+	test.Equals(t, int64(1525881639), unixTime, "unexpected `unixTime`")
+	_, epochErr = ParseEpochTime([]byte(".123"))
+	test.Equals(t, true, epochErr != nil, "input should be rejected")
+}
+
+func TestRequestSplitting(t *testing.T) {
+	t.Parallel()
+	method, path, protocol, err := SplitRequest([]byte("GET /api/user?id=1 HTTP/1.1"))
+	test.FailOnError(t, err)
+	test.Equals(t, "GET", string(method), "unexpected `method`")
+	test.Equals(t, "/api/user?id=1", string(path), "unexpected `path`")
+	test.Equals(t, "HTTP/1.1", string(protocol), "unexpected `protocol`")
+
+	method, path, protocol, err = SplitRequest([]byte("GET /old"))
+	test.FailOnError(t, err)
+	test.Equals(t, "GET", string(method), "unexpected `method`")
+	test.Equals(t, "/old", string(path), "unexpected `path`")
+	test.Equals(t, "", string(protocol), "unexpected `protocol`")
+
+	_, _, _, err = SplitRequest([]byte("GET"))
+	test.Equals(t, true, err != nil, "input should be rejected")
+
+	section, sectionErr := SectionOf([]byte("/api/user"))
+	test.FailOnError(t, sectionErr)
+	test.Equals(t, "/api", string(section), "unexpected `section`")
+	section, sectionErr = SectionOf([]byte("/"))
+	test.FailOnError(t, sectionErr)
+	test.Equals(t, "/", string(section), "unexpected `section`")
+	_, sectionErr = SectionOf([]byte("*"))
+	test.Equals(t, true, sectionErr != nil, "input should be rejected")
+
+	test.Equals(t, "/api/user?id=1", string(PathOfURL([]byte("https://example.com:443/api/user?id=1"))), "unexpected path")
+	test.Equals(t, "/", string(PathOfURL([]byte("http://example.com"))), "unexpected path of URL without path")
+	test.Equals(t, "/api", string(PathOfURL([]byte("/api"))), "path should be returned as is")
+}
+
+func TestQuotedParts(t *testing.T) {
+	t.Parallel()
+	line := []byte(`"a \"quoted\" \\" rest"`)
+	test.Equals(t, 16, FindClosingQuote(line, 1), "escaped quotes should be skipped")
+	test.Equals(t, -1, FindClosingQuote([]byte(`"no end \"`), 1), "escaped quote can't close part")
+	test.Equals(t, `a "quoted" \`, string(AppendUnescaped(nil, line[1:16])), "quotes and backslashes should be unescaped")
+}
+
+func TestInternCache(t *testing.T) {
+	t.Parallel()
+	cache := NewInternCache(2)
+	test.Equals(t, "/api", cache.Intern([]byte("/api")), "new part should be interned")
+	test.Equals(t, "/api", cache.Intern([]byte("/api")), "part should be taken from cache")
+	test.Equals(t, "/report", cache.Intern([]byte("/report")), "new part should be interned")
+	test.Equals(t, "/user", cache.Intern([]byte("/user")), "new part should be interned")
+	test.Equals(t, 1, len(cache.parts), "cache should be cleared when it is full")
+	test.Equals(t, "/api", NewInternCache(0).Intern([]byte("/api")), "zero size cache should allocate parts")
+}
+
+func TestValueEndSearch(t *testing.T) {
+	t.Parallel()
+	line := []byte(`10.0.0.1 [time] "a \" b" end`)
+	valueEnd, err := FindValueEnd(line, 0, []byte(" ["), false)
+	test.FailOnError(t, err)
+	test.Equals(t, 8, valueEnd, "value should end before multi byte suffix")
+	valueEnd, err = FindValueEnd(line, 10, []byte("]"), false)
+	test.FailOnError(t, err)
+	test.Equals(t, 14, valueEnd, "value should end before single byte suffix")
+	valueEnd, err = FindValueEnd(line, 17, []byte(`" `), true)
+	test.FailOnError(t, err)
+	test.Equals(t, 23, valueEnd, "quoted value should end at closing quote")
+	valueEnd, err = FindValueEnd(line, 25, nil, false)
+	test.FailOnError(t, err)
+	test.Equals(t, len(line), valueEnd, "the last value should end at the end of line")
+
+	_, err = FindValueEnd(line, 0, []byte("|"), false)
+	test.Equals(t, true, err != nil, "absent suffix should be rejected")
+	_, err = FindValueEnd(line, len(line)+1, nil, false)
+	test.Equals(t, true, err != nil, "cropped line should be rejected")
+	test.Equals(t, true, IsQuoted([]byte(` "`), []byte(`" `)), "value between quotes is quoted")
+	test.Equals(t, false, IsQuoted([]byte(` "`), []byte(` `)), "value without closing quote isn't quoted")
+}
+
+func TestDurationParsing(t *testing.T) {
+	t.Parallel()
+	cases := []struct {
+		durationPart string
+		unit         time.Duration
+		duration     time.Duration
+	}{
+		{durationPart: "0.005", unit: time.Second, duration: 5 * time.Millisecond},
+		{durationPart: "1520", unit: time.Microsecond, duration: 1520 * time.Microsecond},
+		{durationPart: "12.5", unit: time.Millisecond, duration: 12500 * time.Microsecond},
+		{durationPart: "12ms", unit: time.Second, duration: 12 * time.Millisecond},
+		{durationPart: "1m30s", unit: time.Second, duration: 90 * time.Second},
+		{durationPart: "-", unit: time.Second, duration: 0},
+	}
+	for _, testCase := range cases {
+		duration, err := ParseDuration([]byte(testCase.durationPart), testCase.unit)
+		test.FailOnError(t, err)
+		test.Equals(t, testCase.duration, duration, "mismatch on: %v", testCase.durationPart)
+	}
+	for _, durationPart := range []string{"", "12parsecs", "1.2.3", "-5", "-1.5"} {
+		_, err := ParseDuration([]byte(durationPart), time.Second)
+		test.Equals(t, true, err != nil, "duration should be rejected: %v", durationPart)
+	}
+}
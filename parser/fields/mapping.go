@@ -0,0 +1,283 @@
+package fields
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/storozhukBM/logstat/stat"
+	"strings"
+	"time"
+)
+
+type Field int
+
+const (
+	NoField Field = iota
+	TimeField
+	StatusField
+	PathField
+	MethodField
+	HostField
+	UserField
+	ProtocolField
+	BytesField
+	RefererField
+	UserAgentField
+	DurationField
+)
+
+/*
+Names of record fields that can be mapped onto keys of structured lines, like JSON objects or logfmt.
+*/
+var fieldNames = map[string]Field{
+	"time":       TimeField,
+	"status":     StatusField,
+	"path":       PathField,
+	"method":     MethodField,
+	"host":       HostField,
+	"user":       UserField,
+	"protocol":   ProtocolField,
+	"bytes":      BytesField,
+	"referer":    RefererField,
+	"user_agent": UserAgentField,
+	"duration":   DurationField,
+}
+
+var units = map[string]time.Duration{
+	"s":  time.Second,
+	"ms": time.Millisecond,
+	"us": time.Microsecond,
+	"ns": time.Nanosecond,
+}
+
+/*
+Mapping of record field onto key of structured line.
+*/
+type FieldMapping struct {
+	Field Field
+	Key   string
+	// unit of duration without its own units, or unit of epoch time, zero if time isn't epoch
+	Unit time.Duration
+	// Go layout of time written as string, empty for RFC 3339
+	TimeLayout string
+}
+
+/*
+Parses field mappings, like `time=ts:ms,status=status,path=path,bytes=size,duration=dur:s`.
+Each mapping is `field=key` with an optional option after `:`:
+	- time option is `s`, `ms`, `us` or `ns` for epoch time, `rfc3339` (default), `clf` or Go layout,
+	time written as number without option is parsed as epoch seconds
+	- duration option is `s` (default), `ms`, `us` or `ns` for numbers, durations with units, like `12ms`, are parsed as is
+*/
+func ParseFieldMappings(definition string) ([]FieldMapping, error) {
+	var result []FieldMapping
+	mappedFields := make(map[Field]bool)
+	mappedKeys := make(map[string]bool)
+	for _, mapping := range strings.Split(definition, ",") {
+		mapping = strings.TrimSpace(mapping)
+		if mapping == "" {
+			continue
+		}
+		nameEnd := strings.IndexByte(mapping, '=')
+		if nameEnd == -1 {
+			return nil, fmt.Errorf("mapping `%v` should be written as `field=key`", mapping)
+		}
+		f, ok := FieldByName(mapping[:nameEnd])
+		if !ok {
+			return nil, fmt.Errorf("unknown field `%v` in mapping `%v`", mapping[:nameEnd], mapping)
+		}
+		if mappedFields[f] {
+			return nil, fmt.Errorf("field `%v` is mapped several times", mapping[:nameEnd])
+		}
+		mappedFields[f] = true
+
+		key, option := mapping[nameEnd+1:], ""
+		if optionStart := strings.IndexByte(key, ':'); optionStart != -1 {
+			key, option = key[:optionStart], key[optionStart+1:]
+		}
+		if key == "" {
+			return nil, fmt.Errorf("key of `%v` can't be empty", mapping)
+		}
+		if mappedKeys[key] {
+			return nil, fmt.Errorf("key of `%v` is already mapped", mapping)
+		}
+		mappedKeys[key] = true
+
+		fieldMapping, optionErr := NewFieldMapping(f, key, option)
+		if optionErr != nil {
+			return nil, fmt.Errorf("can't apply option of `%v`: %v", mapping, optionErr)
+		}
+		result = append(result, fieldMapping)
+	}
+	if !mappedFields[TimeField] {
+		return nil, fmt.Errorf("`time` field should be mapped")
+	}
+	return result, nil
+}
+
+/*
+Returns field by its name, like `user_agent`.
+*/
+func FieldByName(name string) (Field, bool) {
+	f, ok := fieldNames[name]
+	return f, ok
+}
+
+/*
+Creates mapping of field onto key with option, see `ParseFieldMappings` for options of fields.
+*/
+func NewFieldMapping(f Field, key string, option string) (FieldMapping, error) {
+	result := FieldMapping{Field: f, Key: key}
+	optionErr := result.applyOption(option)
+	if optionErr != nil {
+		return FieldMapping{}, optionErr
+	}
+	return result, nil
+}
+
+func (m *FieldMapping) applyOption(option string) error {
+	switch m.Field {
+	case TimeField:
+		switch option {
+		case "", "rfc3339":
+		case "clf":
+			m.TimeLayout = CommonLogTimeLayout
+		default:
+			unit, ok := units[option]
+			if ok {
+				m.Unit = unit
+			} else {
+				m.TimeLayout = option
+			}
+		}
+	case DurationField:
+		m.Unit = time.Second
+		if option != "" {
+			unit, ok := units[option]
+			if !ok {
+				return fmt.Errorf("unknown duration unit `%v`", option)
+			}
+			m.Unit = unit
+		}
+	default:
+		if option != "" {
+			return fmt.Errorf("only time and duration have options")
+		}
+	}
+	return nil
+}
+
+/*
+Fills record fields with values of mapped keys, text values are interned the same way as in other parsers.
+*/
+type RecordBuilder struct {
+	timeParser CommonLogTimeParser
+
+	hostsInternCache      *InternCache
+	usersInternCache      *InternCache
+	methodsInternCache    *InternCache
+	pathsInternCache      *InternCache
+	protocolsInternCache  *InternCache
+	sectionsInternCache   *InternCache
+	referersInternCache   *InternCache
+	userAgentsInternCache *InternCache
+}
+
+/*
+Creates record builder, `internCacheSize` limits size of each cache of interned text parts.
+*/
+func NewRecordBuilder(internCacheSize uint) *RecordBuilder {
+	return &RecordBuilder{
+		hostsInternCache:      NewInternCache(internCacheSize),
+		usersInternCache:      NewInternCache(internCacheSize),
+		methodsInternCache:    NewInternCache(internCacheSize),
+		pathsInternCache:      NewInternCache(internCacheSize),
+		protocolsInternCache:  NewInternCache(internCacheSize),
+		sectionsInternCache:   NewInternCache(internCacheSize),
+		referersInternCache:   NewInternCache(internCacheSize),
+		userAgentsInternCache: NewInternCache(internCacheSize),
+	}
+}
+
+/*
+Sets `value` of mapped key to record field, `isNumber` tells that value was written as number rather than string.
+*/
+func (b *RecordBuilder) Set(record *stat.Record, mapping *FieldMapping, value []byte, isNumber bool) error {
+	switch mapping.Field {
+	case TimeField:
+		unixTime, timeErr := b.ParseTime(mapping, value, isNumber)
+		if timeErr != nil {
+			return timeErr
+		}
+		record.UnixTime = unixTime
+	case StatusField:
+		statusCode, statusCodeErr := ParseInt(value)
+		if statusCodeErr != nil {
+			return statusCodeErr
+		}
+		record.StatusCode = int32(statusCode)
+	case PathField:
+		sectionPart, sectionErr := SectionOf(value)
+		if sectionErr != nil {
+			return sectionErr
+		}
+		record.Path = b.pathsInternCache.Intern(value)
+		record.Section = b.sectionsInternCache.Intern(sectionPart)
+	case MethodField:
+		record.Method = b.methodsInternCache.Intern(value)
+	case HostField:
+		record.RemoteHost = b.hostsInternCache.Intern(value)
+	case UserField:
+		record.AuthUser = b.usersInternCache.Intern(value)
+	case ProtocolField:
+		record.Protocol = b.protocolsInternCache.Intern(value)
+	case BytesField:
+		bodySize, bodySizeErr := ParseIntOrDash(value)
+		if bodySizeErr != nil {
+			return bodySizeErr
+		}
+		record.ResponseSize = bodySize
+	case RefererField:
+		record.Referer = b.referersInternCache.Intern(value)
+	case UserAgentField:
+		record.UserAgent = b.userAgentsInternCache.Intern(value)
+	case DurationField:
+		latency, latencyErr := ParseDuration(value, mapping.Unit)
+		if latencyErr != nil {
+			return latencyErr
+		}
+		record.Latency = latency
+	}
+	return nil
+}
+
+/*
+Parses time of mapped key, numbers and times with epoch unit are parsed as epoch time, other strings by layout.
+*/
+func (b *RecordBuilder) ParseTime(mapping *FieldMapping, value []byte, isNumber bool) (int64, error) {
+	switch {
+	case isNumber || mapping.Unit != 0:
+		unit := mapping.Unit
+		if unit == 0 {
+			unit = time.Second
+		}
+		if fractionStart := bytes.IndexByte(value, '.'); fractionStart != -1 && unit != time.Second {
+			// fraction of smaller units is less than a second
+			value = value[:fractionStart]
+		}
+		epochTime, epochErr := ParseEpochTime(value)
+		if epochErr != nil {
+			return 0, epochErr
+		}
+		return epochTime / int64(time.Second/unit), nil
+	case mapping.TimeLayout == CommonLogTimeLayout:
+		return b.timeParser.Parse(value)
+	case mapping.TimeLayout != "":
+		t, parsingErr := time.ParseInLocation(mapping.TimeLayout, bytesView(value), time.UTC)
+		if parsingErr != nil {
+			return 0, parsingErr
+		}
+		return t.Unix(), nil
+	default:
+		return ParseISO8601Time(value)
+	}
+}
@@ -0,0 +1,85 @@
+package fields
+
+import (
+	"github.com/storozhukBM/logstat/common/test"
+	"github.com/storozhukBM/logstat/stat"
+	"testing"
+	"time"
+)
+
+func TestFieldMappingsParsing(t *testing.T) {
+	t.Parallel()
+	mappings, err := ParseFieldMappings("time=ts:2006-01-02 15:04:05, status=code,path=request.uri,duration=dur:ms,")
+	test.FailOnError(t, err)
+	test.Equals(t, []FieldMapping{
+		{Field: TimeField, Key: "ts", TimeLayout: "2006-01-02 15:04:05"},
+		{Field: StatusField, Key: "code"},
+		{Field: PathField, Key: "request.uri"},
+		{Field: DurationField, Key: "dur", Unit: time.Millisecond},
+	}, mappings, "mappings mismatch")
+
+	invalidMappings := []string{
+		``,
+		`status=status`,
+		`time`,
+		`time=ts,latency=dur`,
+		`time=ts,status=ts`,
+		`time=ts,time=timestamp`,
+		`time=ts,status=status:ms`,
+		`time=ts,duration=dur:hours`,
+		`time=`,
+	}
+	for _, mapping := range invalidMappings {
+		_, err := ParseFieldMappings(mapping)
+		test.Equals(t, true, err != nil, "mapping should be rejected: %v", mapping)
+	}
+}
+
+func TestFieldMappingCreation(t *testing.T) {
+	t.Parallel()
+	f, ok := FieldByName("user_agent")
+	test.Equals(t, true, ok, "field should be found")
+	test.Equals(t, UserAgentField, f, "field mismatch")
+	_, ok = FieldByName("latency")
+	test.Equals(t, false, ok, "unknown field shouldn't be found")
+
+	mapping, err := NewFieldMapping(TimeField, "ts", "clf")
+	test.FailOnError(t, err)
+	test.Equals(t, FieldMapping{Field: TimeField, Key: "ts", TimeLayout: CommonLogTimeLayout}, mapping, "mapping mismatch")
+	_, err = NewFieldMapping(BytesField, "size", "ms")
+	test.Equals(t, true, err != nil, "option of bytes should be rejected")
+}
+
+func TestRecordBuilder(t *testing.T) {
+	t.Parallel()
+	mappings, err := ParseFieldMappings("time=ts:ms,status=status,path=path,bytes=bytes,duration=dur,method=method")
+	test.FailOnError(t, err)
+	builder := NewRecordBuilder(10)
+	record := stat.Record{}
+	values := []struct {
+		value    string
+		isNumber bool
+	}{
+		{value: "1525914959123", isNumber: false},
+		{value: "200", isNumber: true},
+		{value: "/api/user", isNumber: false},
+		{value: "-", isNumber: false},
+		{value: "0.25", isNumber: true},
+		{value: "GET", isNumber: false},
+	}
+	for i, value := range values {
+		test.FailOnError(t, builder.Set(&record, &mappings[i], []byte(value.value), value.isNumber))
+	}
+	test.Equals(t, stat.Record{
+		UnixTime: 1525914959, StatusCode: 200, Path: "/api/user", Section: "/api", Latency: 250 * time.Millisecond, Method: "GET",
+	}, record, "record mismatch")
+
+	timeMappings, err := ParseFieldMappings("time=ts")
+	test.FailOnError(t, err)
+	unixTime, timeErr := builder.ParseTime(&timeMappings[0], []byte("1525914959.5"), true)
+	test.FailOnError(t, timeErr)
+	test.Equals(t, int64(1525914959), unixTime, "number should be parsed as epoch seconds")
+	unixTime, timeErr = builder.ParseTime(&timeMappings[0], []byte("2018-05-10T01:15:59Z"), false)
+	test.FailOnError(t, timeErr)
+	test.Equals(t, int64(1525914959), unixTime, "string should be parsed as RFC 3339")
+}
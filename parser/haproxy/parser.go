@@ -0,0 +1,269 @@
+package haproxy
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/storozhukBM/logstat/parser/fields"
+	"github.com/storozhukBM/logstat/stat"
+	"time"
+)
+
+const acceptDateLayout = "02/Jan/2006:15:04:05"
+
+/*
+Columns of HAProxy HTTP log format that follow accept date, columns after bytes read are skipped till request.
+*/
+const (
+	frontendColumn = iota
+	backendColumn
+	timersColumn
+	statusColumn
+	bytesReadColumn
+	columnsCount
+)
+
+/*
+Timers of HAProxy HTTP log format, like `10/0/30/69/109`, in milliseconds.
+*/
+const (
+	requestTimer = iota
+	queueTimer
+	connectTimer
+	responseTimer
+	activeTimer
+	timersCount
+)
+
+/*
+A component used to parse one line of HAProxy HTTP log format, enabled by `option httplog`, to storage req record.
+For example, `10.0.1.2:33317 [06/Feb/2009:12:14:14.655] http-in static/srv1 10/0/30/69/109 200 2750 - - ---- ...
+{1wt.eu} {} "GET /index.html HTTP/1.1"`. Lines can have syslog prefix, like `Feb  6 12:14:14 localhost haproxy[14389]: `,
+so line is parsed from the first accept date.
+
+Responsibilities:
+	- parse client address, accept date, status code, bytes read and request
+	- parse timers `TR/Tw/Tc/Tr/Ta`, total active time `Ta` is latency and server response time `Tr` is upstream latency
+	- strip scheme and host from absolute URL of request, written by HAProxy for HTTP/2 requests
+	- copy required parts of line bytes to separate strings, so line bytes can be recycled and reused afterward
+
+Attention:
+	- accept date has no time zone, so it is parsed in local time zone
+	- timers and status code written as `-1`, because connection was aborted, are parsed as zero
+	- values written with `+` prefix by `option logasap` are parsed without it
+	- requests that HAProxy couldn't parse, written as `<BADREQ>`, are rejected
+*/
+type LineToStoreRecordParser struct {
+	cachedDate     []byte
+	cachedUnixTime int64
+
+	hostsInternCache     *fields.InternCache
+	methodsInternCache   *fields.InternCache
+	pathsInternCache     *fields.InternCache
+	protocolsInternCache *fields.InternCache
+	sectionsInternCache  *fields.InternCache
+}
+
+/*
+Creates parser, `internCacheSize` limits size of each cache of interned text parts.
+*/
+func NewLineToStoreRecordParser(internCacheSize uint) (*LineToStoreRecordParser, error) {
+	result := &LineToStoreRecordParser{
+		hostsInternCache:     fields.NewInternCache(internCacheSize),
+		methodsInternCache:   fields.NewInternCache(internCacheSize),
+		pathsInternCache:     fields.NewInternCache(internCacheSize),
+		protocolsInternCache: fields.NewInternCache(internCacheSize),
+		sectionsInternCache:  fields.NewInternCache(internCacheSize),
+	}
+	return result, nil
+}
+
+func (p *LineToStoreRecordParser) Parse(line []byte) (stat.Record, error) {
+	clientPart, datePart, dateEnd, findErr := findClientAndDate(line)
+	if findErr != nil {
+		return stat.Record{}, findErr
+	}
+	record := stat.Record{}
+	unixTime, timeErr := p.parseAcceptDate(datePart)
+	if timeErr != nil {
+		return stat.Record{}, fmt.Errorf("can't parse accept date: %v", timeErr)
+	}
+	record.UnixTime = unixTime
+	if portStart := bytes.LastIndexByte(clientPart, ':'); portStart != -1 {
+		clientPart = clientPart[:portStart]
+	}
+	record.RemoteHost = p.hostsInternCache.Intern(clientPart)
+
+	var columns [columnsCount][]byte
+	idx := dateEnd
+	for i := range columns {
+		idx = skipSpaces(line, idx)
+		columnEnd := idx
+		for columnEnd < len(line) && line[columnEnd] != ' ' {
+			columnEnd++
+		}
+		if idx == columnEnd {
+			return stat.Record{}, fmt.Errorf("enexpected format of line. line has only %v of %v columns after date", i, len(columns))
+		}
+		columns[i] = line[idx:columnEnd]
+		idx = columnEnd
+	}
+
+	timersErr := parseTimers(&record, columns[timersColumn])
+	if timersErr != nil {
+		return stat.Record{}, fmt.Errorf("can't parse timers: %v", timersErr)
+	}
+	statusCode, statusCodeErr := parseLoggedInt(columns[statusColumn])
+	if statusCodeErr != nil {
+		return stat.Record{}, fmt.Errorf("can't parse status code: %v", statusCodeErr)
+	}
+	record.StatusCode = int32(statusCode)
+	bytesRead, bytesReadErr := parseLoggedInt(columns[bytesReadColumn])
+	if bytesReadErr != nil {
+		return stat.Record{}, fmt.Errorf("can't parse bytes read: %v", bytesReadErr)
+	}
+	record.ResponseSize = bytesRead
+
+	requestErr := p.parseRequest(&record, line, idx)
+	if requestErr != nil {
+		return stat.Record{}, fmt.Errorf("can't parse request: %v", requestErr)
+	}
+	return record, nil
+}
+
+/*
+Parses only accept date of the line, columns after it aren't even scanned.
+*/
+func (p *LineToStoreRecordParser) ParseTime(line []byte) (int64, error) {
+	_, datePart, _, findErr := findClientAndDate(line)
+	if findErr != nil {
+		return 0, findErr
+	}
+	unixTime, timeErr := p.parseAcceptDate(datePart)
+	if timeErr != nil {
+		return 0, fmt.Errorf("can't parse accept date: %v", timeErr)
+	}
+	return unixTime, nil
+}
+
+/*
+Finds client address and accept date, like `10.0.1.2:33317 [06/Feb/2009:12:14:14.655]`,
+that can be preceded by syslog prefix. Returns the end of accept date.
+*/
+func findClientAndDate(line []byte) ([]byte, []byte, int, error) {
+	dateStart := -1
+	for idx := 0; idx+2 < len(line); idx++ {
+		if line[idx] == ' ' && line[idx+1] == '[' && line[idx+2] >= '0' && line[idx+2] <= '9' {
+			dateStart = idx + 1
+			break
+		}
+	}
+	if dateStart == -1 {
+		return nil, nil, 0, fmt.Errorf("enexpected format of line. can't find accept date")
+	}
+	dateEnd := bytes.IndexByte(line[dateStart:], ']')
+	if dateEnd == -1 {
+		return nil, nil, 0, fmt.Errorf("enexpected format of line. accept date isn't closed")
+	}
+	dateEnd += dateStart // dateEnd is relative to dateStart
+	clientStart := bytes.LastIndexByte(line[:dateStart-1], ' ') + 1
+	if clientStart == dateStart-1 {
+		return nil, nil, 0, fmt.Errorf("enexpected format of line. can't find client address")
+	}
+	return line[clientStart : dateStart-1], line[dateStart+1 : dateEnd], dateEnd + 1, nil
+}
+
+/*
+Parses accept date, like `06/Feb/2009:12:14:14.655`, milliseconds are truncated.
+Lines of the same second share one parsed time.
+*/
+func (p *LineToStoreRecordParser) parseAcceptDate(datePart []byte) (int64, error) {
+	if fractionStart := bytes.IndexByte(datePart, '.'); fractionStart != -1 {
+		datePart = datePart[:fractionStart]
+	}
+	if bytes.Equal(datePart, p.cachedDate) {
+		return p.cachedUnixTime, nil
+	}
+	t, parsingErr := time.ParseInLocation(acceptDateLayout, string(datePart), time.Local)
+	if parsingErr != nil {
+		return 0, parsingErr
+	}
+	p.cachedDate = append(p.cachedDate[:0], datePart...)
+	p.cachedUnixTime = t.Unix()
+	return p.cachedUnixTime, nil
+}
+
+/*
+Finds the first quoted part after `columnsEnd`, that is request, like `"GET /index.html HTTP/1.1"`.
+Captured headers before request can't contain quotes, because HAProxy encodes them.
+*/
+func (p *LineToStoreRecordParser) parseRequest(record *stat.Record, line []byte, columnsEnd int) error {
+	requestStart := bytes.IndexByte(line[columnsEnd:], '"')
+	if requestStart == -1 {
+		return fmt.Errorf("enexpected format of line. can't find request")
+	}
+	requestStart += columnsEnd + 1 // requestStart is relative to columnsEnd
+	requestEnd := bytes.IndexByte(line[requestStart:], '"')
+	if requestEnd == -1 {
+		return fmt.Errorf("enexpected format of line. request isn't closed")
+	}
+	requestEnd += requestStart // requestEnd is relative to requestStart
+
+	methodPart, urlPart, protocolPart, splitErr := fields.SplitRequest(line[requestStart:requestEnd])
+	if splitErr != nil {
+		return splitErr
+	}
+	pathPart := fields.PathOfURL(urlPart)
+	sectionPart, sectionErr := fields.SectionOf(pathPart)
+	if sectionErr != nil {
+		return sectionErr
+	}
+	record.Method = p.methodsInternCache.Intern(methodPart)
+	record.Protocol = p.protocolsInternCache.Intern(protocolPart)
+	record.Path = p.pathsInternCache.Intern(pathPart)
+	record.Section = p.sectionsInternCache.Intern(sectionPart)
+	return nil
+}
+
+func parseTimers(record *stat.Record, timersPart []byte) error {
+	var timers [timersCount]int64
+	for i := range timers {
+		timerEnd := len(timersPart)
+		if i < timersCount-1 {
+			timerEnd = bytes.IndexByte(timersPart, '/')
+			if timerEnd == -1 {
+				return fmt.Errorf("enexpected format of timers. should be `TR/Tw/Tc/Tr/Ta`")
+			}
+		}
+		timer, timerErr := parseLoggedInt(timersPart[:timerEnd])
+		if timerErr != nil {
+			return timerErr
+		}
+		timers[i] = timer
+		if timerEnd < len(timersPart) {
+			timersPart = timersPart[timerEnd+1:]
+		}
+	}
+	record.Latency = time.Duration(timers[activeTimer]) * time.Millisecond
+	record.UpstreamLatency = time.Duration(timers[responseTimer]) * time.Millisecond
+	return nil
+}
+
+/*
+Parses int written by HAProxy, `-1` means that value is absent and `+` prefix is written by `option logasap`.
+*/
+func parseLoggedInt(intPart []byte) (int64, error) {
+	if bytes.Equal(intPart, []byte("-1")) {
+		return 0, nil
+	}
+	if len(intPart) > 0 && intPart[0] == '+' {
+		intPart = intPart[1:]
+	}
+	return fields.ParseInt(intPart)
+}
+
+func skipSpaces(line []byte, idx int) int {
+	for idx < len(line) && line[idx] == ' ' {
+		idx++
+	}
+	return idx
+}
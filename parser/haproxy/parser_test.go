@@ -0,0 +1,72 @@
+package haproxy
+
+import (
+	"github.com/storozhukBM/logstat/common/test"
+	"github.com/storozhukBM/logstat/stat"
+	"testing"
+	"time"
+)
+
+func TestParsing(t *testing.T) {
+	t.Parallel()
+	parser, parserErr := NewLineToStoreRecordParser(10)
+	test.FailOnError(t, parserErr)
+	acceptTime := time.Date(2009, time.February, 6, 12, 14, 14, 0, time.Local).Unix()
+
+	cases := []struct {
+		line   string
+		result stat.Record
+	}{
+		{
+			line: `Feb  6 12:14:14 localhost haproxy[14389]: 10.0.1.2:33317 [06/Feb/2009:12:14:14.655] http-in static/srv1 ` +
+				`10/0/30/69/109 200 2750 - - ---- 1/1/1/1/0 0/0 {1wt.eu} {} "GET /index.html HTTP/1.1"`,
+			result: stat.Record{
+				UnixTime: acceptTime, Section: "/index.html", StatusCode: 200, ResponseSize: 2750,
+				RemoteHost: "10.0.1.2", Method: "GET", Path: "/index.html", Protocol: "HTTP/1.1",
+				Latency: 109 * time.Millisecond, UpstreamLatency: 69 * time.Millisecond,
+			},
+		},
+		{
+			line: `10.0.1.2:33318 [06/Feb/2009:12:14:14.900] https-in~ api/srv2 0/0/-1/-1/+3001 -1 +188 - - CC-- ` +
+				`0/0/0/0/0 0/0 "POST https://example.com/api/user HTTP/2.0" 0/0000000000000000/0/0/0 example.com/TLSv1.3`,
+			result: stat.Record{
+				UnixTime: acceptTime, Section: "/api", ResponseSize: 188,
+				RemoteHost: "10.0.1.2", Method: "POST", Path: "/api/user", Protocol: "HTTP/2.0",
+				Latency: 3001 * time.Millisecond,
+			},
+		},
+	}
+	for _, c := range cases {
+		record, err := parser.Parse([]byte(c.line))
+		test.FailOnError(t, err)
+		test.Equals(t, c.result, record, "record mismatch of line: %v", c.line)
+
+		unixTime, timeErr := parser.ParseTime([]byte(c.line))
+		test.FailOnError(t, timeErr)
+		test.Equals(t, c.result.UnixTime, unixTime, "time mismatch of line: %v", c.line)
+	}
+}
+
+func TestParsingErrors(t *testing.T) {
+	t.Parallel()
+	parser, parserErr := NewLineToStoreRecordParser(10)
+	test.FailOnError(t, parserErr)
+	lines := []string{
+		``,
+		`10.0.1.2:33317 06/Feb/2009:12:14:14.655 http-in static/srv1 10/0/30/69/109 200 2750 "GET / HTTP/1.1"`,
+		`[06/Feb/2009:12:14:14.655] http-in static/srv1 10/0/30/69/109 200 2750 "GET / HTTP/1.1"`,
+		`10.0.1.2:33317 [06/Feb/2009:12:14:14.655 http-in static/srv1 10/0/30/69/109 200 2750 "GET / HTTP/1.1"`,
+		`10.0.1.2:33317 [06/Feb/2009] http-in static/srv1 10/0/30/69/109 200 2750 "GET / HTTP/1.1"`,
+		`10.0.1.2:33317 [06/Feb/2009:12:14:14.655] http-in static/srv1 10/0/30/69/109`,
+		`10.0.1.2:33317 [06/Feb/2009:12:14:14.655] http-in static/srv1 10/0/30/69 200 2750 "GET / HTTP/1.1"`,
+		`10.0.1.2:33317 [06/Feb/2009:12:14:14.655] http-in static/srv1 10/0/30/69/109/1 200 2750 "GET / HTTP/1.1"`,
+		`10.0.1.2:33317 [06/Feb/2009:12:14:14.655] http-in static/srv1 10/0/30/69/109 x 2750 "GET / HTTP/1.1"`,
+		`10.0.1.2:33317 [06/Feb/2009:12:14:14.655] http-in static/srv1 10/0/30/69/109 200 2750 - - ----`,
+		`10.0.1.2:33317 [06/Feb/2009:12:14:14.655] http-in static/srv1 10/0/30/69/109 200 2750 "GET / HTTP/1.1`,
+		`10.0.1.2:33317 [06/Feb/2009:12:14:14.655] http-in <NOSRV> -1/-1/-1/-1/0 400 187 - - PR-- "<BADREQ>"`,
+	}
+	for _, line := range lines {
+		_, err := parser.Parse([]byte(line))
+		test.Equals(t, true, err != nil, "line should be rejected: %v", line)
+	}
+}
@@ -0,0 +1,57 @@
+package json
+
+import (
+	"fmt"
+	"github.com/storozhukBM/logstat/parser/fields"
+	"strings"
+)
+
+/*
+Node of the tree of mapped keys, nested objects are mapped by dotted keys, like `request.uri`.
+*/
+type keyNode struct {
+	mapping  *fields.FieldMapping
+	children map[string]*keyNode
+}
+
+/*
+Compiles field mapping, like `time=ts:ms,status=status,path=request.uri,bytes=size,duration=dur:s`,
+into the tree of keys.
+*/
+func compileMapping(definition string) (*keyNode, error) {
+	mappings, mappingsErr := fields.ParseFieldMappings(definition)
+	if mappingsErr != nil {
+		return nil, mappingsErr
+	}
+	root := &keyNode{children: make(map[string]*keyNode)}
+	for i := range mappings {
+		node, nodeErr := root.insert(mappings[i].Key)
+		if nodeErr != nil {
+			return nil, nodeErr
+		}
+		node.mapping = &mappings[i]
+	}
+	return root, nil
+}
+
+func (n *keyNode) insert(key string) (*keyNode, error) {
+	node := n
+	for _, name := range strings.Split(key, ".") {
+		if name == "" {
+			return nil, fmt.Errorf("key `%v` has empty part", key)
+		}
+		if node.mapping != nil {
+			return nil, fmt.Errorf("key `%v` is inside of already mapped key", key)
+		}
+		child, ok := node.children[name]
+		if !ok {
+			child = &keyNode{children: make(map[string]*keyNode)}
+			node.children[name] = child
+		}
+		node = child
+	}
+	if len(node.children) > 0 {
+		return nil, fmt.Errorf("key `%v` has already mapped keys inside", key)
+	}
+	return node, nil
+}
@@ -0,0 +1,320 @@
+package json
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/storozhukBM/logstat/parser/fields"
+	"github.com/storozhukBM/logstat/stat"
+)
+
+type valueKind int
+
+const (
+	stringValue valueKind = iota
+	numberValue
+	literalValue
+	objectValue
+	arrayValue
+)
+
+/*
+A component used to parse one line of log written as JSON object to storage req record.
+Line is scanned in place, without `encoding/json` unmarshal, so keys that aren't mapped are skipped
+without allocations, and values of mapped keys are interned the same way as in other parsers.
+
+Responsibilities:
+	- map configured keys of JSON object, including keys of nested objects, onto record fields
+	- unescape string values and keys, including `\uXXXX` sequences
+	- parse time written as string with layout or as epoch number, and duration as number or string like `12ms`
+	- copy required parts of line bytes to separate strings, so line bytes can be recycled and reused afterward
+
+Attention:
+	- mapped time key is required in every line, other mapped keys can be absent or `null`
+	- mapped arrays are parsed by their first element, like headers written by Caddy
+	- line should contain exactly one JSON object, but its values aren't fully validated if they are skipped
+*/
+type LineToStoreRecordParser struct {
+	root     *keyNode
+	builder  *fields.RecordBuilder
+	keyBuf   []byte
+	valueBuf []byte
+}
+
+/*
+Creates parser with `fieldMapping` of record fields onto keys of JSON object, see `fields.ParseFieldMappings` for details.
+`internCacheSize` limits size of each cache of interned text parts.
+*/
+func NewLineToStoreRecordParser(fieldMapping string, internCacheSize uint) (*LineToStoreRecordParser, error) {
+	root, mappingErr := compileMapping(fieldMapping)
+	if mappingErr != nil {
+		return nil, fmt.Errorf("can't compile field mapping `%v`: %v", fieldMapping, mappingErr)
+	}
+	result := &LineToStoreRecordParser{
+		root:    root,
+		builder: fields.NewRecordBuilder(internCacheSize),
+	}
+	return result, nil
+}
+
+func (p *LineToStoreRecordParser) Parse(line []byte) (stat.Record, error) {
+	record := stat.Record{}
+	timeFound, scanErr := p.scanLine(line, &record, false)
+	if scanErr != nil {
+		return stat.Record{}, scanErr
+	}
+	if !timeFound {
+		return stat.Record{}, fmt.Errorf("enexpected format of line. time key is absent")
+	}
+	return record, nil
+}
+
+/*
+Parses only time of the line, other mapped keys are skipped the same way as keys that aren't mapped.
+*/
+func (p *LineToStoreRecordParser) ParseTime(line []byte) (int64, error) {
+	record := stat.Record{}
+	timeFound, scanErr := p.scanLine(line, &record, true)
+	if scanErr != nil {
+		return 0, scanErr
+	}
+	if !timeFound {
+		return 0, fmt.Errorf("enexpected format of line. time key is absent")
+	}
+	return record.UnixTime, nil
+}
+
+func (p *LineToStoreRecordParser) scanLine(line []byte, record *stat.Record, onlyTime bool) (bool, error) {
+	objectStart := skipSpaces(line, 0)
+	objectEnd, timeFound, scanErr := p.scanObject(line, objectStart, p.root, record, onlyTime)
+	if scanErr != nil {
+		return false, scanErr
+	}
+	if skipSpaces(line, objectEnd) != len(line) {
+		return false, fmt.Errorf("enexpected format of line. unexpected data after JSON object")
+	}
+	return timeFound, nil
+}
+
+/*
+Scans object that starts at `objectStart` and parses values of keys mapped by `node`, returns the end of object.
+*/
+func (p *LineToStoreRecordParser) scanObject(
+	line []byte, objectStart int, node *keyNode, record *stat.Record, onlyTime bool,
+) (int, bool, error) {
+	if objectStart >= len(line) || line[objectStart] != '{' {
+		return 0, false, fmt.Errorf("enexpected format of line. JSON object should start with `{`")
+	}
+	timeFound := false
+	idx := skipSpaces(line, objectStart+1)
+	if idx < len(line) && line[idx] == '}' {
+		return idx + 1, false, nil
+	}
+	for {
+		key, keyEnd, keyErr := p.scanString(line, idx, &p.keyBuf)
+		if keyErr != nil {
+			return 0, false, fmt.Errorf("can't parse key: %v", keyErr)
+		}
+		idx = skipSpaces(line, keyEnd)
+		if idx >= len(line) || line[idx] != ':' {
+			return 0, false, fmt.Errorf("enexpected format of line. missed `:` after key `%s`", key)
+		}
+		idx = skipSpaces(line, idx+1)
+
+		child := node.children[string(key)] // conversion doesn't allocate in map lookup
+		switch {
+		case child != nil && len(child.children) > 0 && idx < len(line) && line[idx] == '{':
+			objectEnd, childTimeFound, objectErr := p.scanObject(line, idx, child, record, onlyTime)
+			if objectErr != nil {
+				return 0, false, objectErr
+			}
+			timeFound = timeFound || childTimeFound
+			idx = objectEnd
+		case child != nil && child.mapping != nil && (!onlyTime || child.mapping.Field == fields.TimeField):
+			value, kind, valueEnd, valueErr := p.scanMappedValue(line, idx)
+			if valueErr != nil {
+				return 0, false, fmt.Errorf("can't parse value of `%s`: %v", key, valueErr)
+			}
+			if kind != literalValue || !bytes.Equal(value, []byte("null")) {
+				if kind == objectValue || kind == arrayValue {
+					return 0, false, fmt.Errorf("value of `%s` can't be mapped: objects and arrays aren't supported", key)
+				}
+				parseErr := p.builder.Set(record, child.mapping, value, kind == numberValue)
+				if parseErr != nil {
+					return 0, false, fmt.Errorf("can't parse value of `%s`: %v", key, parseErr)
+				}
+				timeFound = timeFound || child.mapping.Field == fields.TimeField
+			}
+			idx = valueEnd
+		default:
+			valueEnd, skipErr := skipValue(line, idx)
+			if skipErr != nil {
+				return 0, false, fmt.Errorf("can't skip value of `%s`: %v", key, skipErr)
+			}
+			idx = valueEnd
+		}
+
+		idx = skipSpaces(line, idx)
+		if idx >= len(line) {
+			return 0, false, fmt.Errorf("enexpected format of line. JSON object isn't closed")
+		}
+		switch line[idx] {
+		case '}':
+			return idx + 1, timeFound, nil
+		case ',':
+			idx = skipSpaces(line, idx+1)
+		default:
+			return 0, false, fmt.Errorf("enexpected format of line. missed `,` or `}` after value of `%s`", key)
+		}
+	}
+}
+
+/*
+Scans string that starts at `stringStart`, returns its unescaped content,
+that is valid only till the next use of `buf`, and the end of string.
+*/
+func (p *LineToStoreRecordParser) scanString(line []byte, stringStart int, buf *[]byte) ([]byte, int, error) {
+	if stringStart >= len(line) || line[stringStart] != '"' {
+		return nil, 0, fmt.Errorf("enexpected format of line. string should start with `\"`")
+	}
+	stringEnd := fields.FindClosingQuote(line, stringStart+1)
+	if stringEnd == -1 {
+		return nil, 0, fmt.Errorf("enexpected format of line. string isn't closed")
+	}
+	content := line[stringStart+1 : stringEnd]
+	if bytes.IndexByte(content, '\\') == -1 {
+		return content, stringEnd + 1, nil
+	}
+	unescaped, unescapeErr := fields.AppendUnescapedJSON((*buf)[:0], content)
+	if unescapeErr != nil {
+		return nil, 0, unescapeErr
+	}
+	*buf = unescaped
+	return unescaped, stringEnd + 1, nil
+}
+
+/*
+Scans value of mapped key, array is mapped by its first element, like headers written by Caddy as `["curl/7.58.0"]`.
+Empty array is mapped as `null`.
+*/
+func (p *LineToStoreRecordParser) scanMappedValue(line []byte, valueStart int) ([]byte, valueKind, int, error) {
+	if valueStart >= len(line) || line[valueStart] != '[' {
+		return p.scanValue(line, valueStart)
+	}
+	arrayEnd, skipErr := skipValue(line, valueStart)
+	if skipErr != nil {
+		return nil, 0, 0, skipErr
+	}
+	elementStart := skipSpaces(line, valueStart+1)
+	if line[elementStart] == ']' {
+		return []byte("null"), literalValue, arrayEnd, nil
+	}
+	value, kind, _, valueErr := p.scanValue(line, elementStart)
+	return value, kind, arrayEnd, valueErr
+}
+
+/*
+Scans value that starts at `valueStart`, returns unescaped content of string or raw bytes of other values.
+*/
+func (p *LineToStoreRecordParser) scanValue(line []byte, valueStart int) ([]byte, valueKind, int, error) {
+	if valueStart >= len(line) {
+		return nil, 0, 0, fmt.Errorf("enexpected format of line. value is absent")
+	}
+	switch c := line[valueStart]; {
+	case c == '"':
+		value, valueEnd, stringErr := p.scanString(line, valueStart, &p.valueBuf)
+		return value, stringValue, valueEnd, stringErr
+	case c == '{' || c == '[':
+		valueEnd, skipErr := skipValue(line, valueStart)
+		if skipErr != nil {
+			return nil, 0, 0, skipErr
+		}
+		kind := objectValue
+		if c == '[' {
+			kind = arrayValue
+		}
+		return line[valueStart:valueEnd], kind, valueEnd, nil
+	case isNumberStart(c):
+		valueEnd := scanToken(line, valueStart)
+		return line[valueStart:valueEnd], numberValue, valueEnd, nil
+	default:
+		valueEnd := scanToken(line, valueStart)
+		value := line[valueStart:valueEnd]
+		if !isLiteral(value) {
+			return nil, 0, 0, fmt.Errorf("enexpected format of line. unknown value `%s`", value)
+		}
+		return value, literalValue, valueEnd, nil
+	}
+}
+
+/*
+Skips value that starts at `valueStart`, objects and arrays are skipped with all nested values.
+*/
+func skipValue(line []byte, valueStart int) (int, error) {
+	if valueStart >= len(line) {
+		return 0, fmt.Errorf("enexpected format of line. value is absent")
+	}
+	switch line[valueStart] {
+	case '"':
+		stringEnd := fields.FindClosingQuote(line, valueStart+1)
+		if stringEnd == -1 {
+			return 0, fmt.Errorf("enexpected format of line. string isn't closed")
+		}
+		return stringEnd + 1, nil
+	case '{', '[':
+		depth := 0
+		for idx := valueStart; idx < len(line); idx++ {
+			switch line[idx] {
+			case '{', '[':
+				depth++
+			case '}', ']':
+				depth--
+				if depth == 0 {
+					return idx + 1, nil
+				}
+			case '"':
+				stringEnd := fields.FindClosingQuote(line, idx+1)
+				if stringEnd == -1 {
+					return 0, fmt.Errorf("enexpected format of line. string isn't closed")
+				}
+				idx = stringEnd
+			}
+		}
+		return 0, fmt.Errorf("enexpected format of line. nested value isn't closed")
+	default:
+		valueEnd := scanToken(line, valueStart)
+		if !isNumberStart(line[valueStart]) && !isLiteral(line[valueStart:valueEnd]) {
+			return 0, fmt.Errorf("enexpected format of line. unknown value `%s`", line[valueStart:valueEnd])
+		}
+		return valueEnd, nil
+	}
+}
+
+/*
+Scans number or literal, like `true` or `null`, till the next separator.
+*/
+func scanToken(line []byte, tokenStart int) int {
+	idx := tokenStart
+	for idx < len(line) {
+		switch line[idx] {
+		case ',', '}', ']', ' ', '\t', '\r', '\n':
+			return idx
+		}
+		idx++
+	}
+	return idx
+}
+
+func isNumberStart(c byte) bool {
+	return c == '-' || (c >= '0' && c <= '9')
+}
+
+func isLiteral(token []byte) bool {
+	return bytes.Equal(token, []byte("null")) || bytes.Equal(token, []byte("true")) || bytes.Equal(token, []byte("false"))
+}
+
+func skipSpaces(line []byte, idx int) int {
+	for idx < len(line) && (line[idx] == ' ' || line[idx] == '\t' || line[idx] == '\r' || line[idx] == '\n') {
+		idx++
+	}
+	return idx
+}
@@ -0,0 +1,115 @@
+package json
+
+import (
+	"github.com/storozhukBM/logstat/common/test"
+	"github.com/storozhukBM/logstat/stat"
+	"testing"
+	"time"
+)
+
+func TestJSONParsing(t *testing.T) {
+	t.Parallel()
+	cases := []struct {
+		mapping string
+		line    string
+		result  stat.Record
+	}{
+		{
+			mapping: "time=ts:ms, status=status, path=path, method=method, bytes=bytes, duration=dur:ms",
+			line:    `{"ts": 1525914959123, "level": "info", "method": "GET", "path": "/api/user?id=1", "status": 200, "bytes": 34, "dur": 12.5}`,
+			result: stat.Record{
+				UnixTime: 1525914959, Section: "/api", StatusCode: 200, ResponseSize: 34, Latency: 12500 * time.Microsecond,
+				Method: "GET", Path: "/api/user?id=1",
+			},
+		},
+		{
+			// Caddy writes request in nested object
+			mapping: "time=ts,status=status,path=request.uri,method=request.method,host=request.remote_ip," +
+				"protocol=request.proto,user_agent=request.headers.User-Agent,bytes=size,duration=duration",
+			line: `{"level":"info","ts":1525914959.5,"logger":"http.log.access","msg":"handled request",` +
+				`"request":{"remote_ip":"10.0.0.1","proto":"HTTP/2.0","method":"POST","uri":"/report",` +
+				`"headers":{"Accept":["*/*"],"User-Agent":["curl/7.58.0"]},"tls":{"resumed":false}},` +
+				`"bytes_read":0,"duration":0.000521,"size":5,"status":201,"resp_headers":{"Server":["Caddy"]}}`,
+			result: stat.Record{
+				UnixTime: 1525914959, Section: "/report", StatusCode: 201, ResponseSize: 5, Latency: 521 * time.Microsecond,
+				RemoteHost: "10.0.0.1", Method: "POST", Path: "/report", Protocol: "HTTP/2.0", UserAgent: "curl/7.58.0",
+			},
+		},
+		{
+			mapping: "time=start_time,status=response_code,path=path,user_agent=user_agent,referer=referer,duration=duration:ms",
+			line: ` { "start_time" : "2018-05-10T01:15:59.123Z", "response_code" : "404", "path" : "\/search?q=\"a\"",` +
+				` "user_agent" : "agent 😀", "referer" : null, "duration" : "12ms" } `,
+			result: stat.Record{
+				UnixTime: 1525914959, Section: `/search?q="a"`, StatusCode: 404, Latency: 12 * time.Millisecond,
+				Path: `/search?q="a"`, UserAgent: "agent \U0001F600",
+			},
+		},
+		{
+			mapping: "time=time:clf,status=status",
+			line:    `{"time":"10/May/2018:01:15:59 -0700","status":500,"extra":[1,{"a":"]"},"}"]}`,
+			result:  stat.Record{UnixTime: 1525940159, StatusCode: 500},
+		},
+		{
+			mapping: "time=time:2006-01-02 15:04:05,status=status",
+			line:    `{"time":"2018-05-10 01:15:59","status":200}`,
+			result:  stat.Record{UnixTime: 1525914959, StatusCode: 200},
+		},
+	}
+	for _, testCase := range cases {
+		for _, cacheSize := range []uint{0, 10} {
+			parser, parserErr := NewLineToStoreRecordParser(testCase.mapping, cacheSize)
+			test.FailOnError(t, parserErr)
+			actual, err := parser.Parse([]byte(testCase.line))
+			test.FailOnError(t, err)
+			test.Equals(t, testCase.result, actual, "mismatch on: %s", testCase.line)
+			unixTime, timeErr := parser.ParseTime([]byte(testCase.line))
+			test.FailOnError(t, timeErr)
+			test.Equals(t, testCase.result.UnixTime, unixTime, "time mismatch on: %s", testCase.line)
+		}
+	}
+}
+
+func TestJSONInvalidLines(t *testing.T) {
+	t.Parallel()
+	parser, parserErr := NewLineToStoreRecordParser("time=ts,status=status,path=path", 10)
+	test.FailOnError(t, parserErr)
+	invalidLines := []string{
+		``,
+		`[]`,
+		`{}`,
+		`{"status":200}`,
+		`{"ts":"yesterday"}`,
+		`{"ts":1525914959,"status":"ok"}`,
+		`{"ts":1525914959,"path":"no-slash"}`,
+		`{"ts":1525914959,"path":{"nested":"/api"}}`,
+		`{"ts":1525914959`,
+		`{"ts":1525914959,}`,
+		`{"ts":1525914959 "status":200}`,
+		`{"ts":1525914959,"extra":nope}`,
+		`{"ts":1525914959,"extra":[1,2}`,
+		`{"ts":1525914959,"path":"/api\x"}`,
+		`{"ts":1525914959,"path":"/api\u00"}`,
+		`{"ts":1525914959} trailing`,
+		`{ts:1525914959}`,
+	}
+	for _, line := range invalidLines {
+		_, err := parser.Parse([]byte(line))
+		test.Equals(t, true, err != nil, "line should be rejected: %v", line)
+	}
+}
+
+func TestJSONInvalidMappings(t *testing.T) {
+	t.Parallel()
+	invalidMappings := []string{
+		``,
+		`status=status`,
+		`time`,
+		`time=ts,path=request,method=request.method`,
+		`time=ts,method=request.method,path=request`,
+		`time=ts,path=request..uri`,
+	}
+	for _, mapping := range invalidMappings {
+		_, err := NewLineToStoreRecordParser(mapping, 10)
+		test.Equals(t, true, err != nil, "mapping should be rejected: %v", mapping)
+	}
+}
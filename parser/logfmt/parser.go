@@ -0,0 +1,168 @@
+package logfmt
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/storozhukBM/logstat/parser/fields"
+	"github.com/storozhukBM/logstat/stat"
+)
+
+/*
+A component used to parse one line of log in logfmt, like `ts=... method=GET path=/api/x status=200 dur=12ms`,
+to storage req record. Line is scanned by `bytes.IndexByte` search of separators, so keys that aren't mapped
+are skipped without allocations.
+
+Responsibilities:
+	- map configured keys onto record fields, see `fields.ParseFieldMappings` for details
+	- unescape quoted values, like `msg="user \"frank\" logged in"`
+	- parse durations with units, like `12ms`, or numbers of configured unit into latency
+	- copy required parts of line bytes to separate strings, so line bytes can be recycled and reused afterward
+
+Attention:
+	- mapped time key is required in every line, other mapped keys can be absent
+	- keys without values, like `debug` in `debug ts=...`, are skipped
+	- if key is written several times the last value is used
+*/
+type LineToStoreRecordParser struct {
+	mappings map[string]*fields.FieldMapping
+	builder  *fields.RecordBuilder
+	valueBuf []byte
+}
+
+/*
+Creates parser with `fieldMapping` of record fields onto keys of logfmt line,
+like `time=ts,method=method,path=path,status=status,bytes=bytes,duration=dur`.
+`internCacheSize` limits size of each cache of interned text parts.
+*/
+func NewLineToStoreRecordParser(fieldMapping string, internCacheSize uint) (*LineToStoreRecordParser, error) {
+	mappings, mappingErr := fields.ParseFieldMappings(fieldMapping)
+	if mappingErr != nil {
+		return nil, fmt.Errorf("can't parse field mapping `%v`: %v", fieldMapping, mappingErr)
+	}
+	result := &LineToStoreRecordParser{
+		mappings: make(map[string]*fields.FieldMapping, len(mappings)),
+		builder:  fields.NewRecordBuilder(internCacheSize),
+	}
+	for i := range mappings {
+		result.mappings[mappings[i].Key] = &mappings[i]
+	}
+	return result, nil
+}
+
+func (p *LineToStoreRecordParser) Parse(line []byte) (stat.Record, error) {
+	record := stat.Record{}
+	timeFound, scanErr := p.scanLine(line, &record, false)
+	if scanErr != nil {
+		return stat.Record{}, scanErr
+	}
+	if !timeFound {
+		return stat.Record{}, fmt.Errorf("enexpected format of line. time key is absent")
+	}
+	return record, nil
+}
+
+/*
+Parses only time of the line, other mapped keys are skipped the same way as keys that aren't mapped.
+*/
+func (p *LineToStoreRecordParser) ParseTime(line []byte) (int64, error) {
+	record := stat.Record{}
+	timeFound, scanErr := p.scanLine(line, &record, true)
+	if scanErr != nil {
+		return 0, scanErr
+	}
+	if !timeFound {
+		return 0, fmt.Errorf("enexpected format of line. time key is absent")
+	}
+	return record.UnixTime, nil
+}
+
+func (p *LineToStoreRecordParser) scanLine(line []byte, record *stat.Record, onlyTime bool) (bool, error) {
+	timeFound := false
+	idx := 0
+	for {
+		idx = skipSpaces(line, idx)
+		if idx >= len(line) {
+			return timeFound, nil
+		}
+		keyEnd := idx
+		for keyEnd < len(line) && line[keyEnd] != '=' && line[keyEnd] != ' ' {
+			keyEnd++
+		}
+		key := line[idx:keyEnd]
+		if keyEnd == len(line) || line[keyEnd] == ' ' {
+			// key without value
+			idx = keyEnd
+			continue
+		}
+		if len(key) == 0 {
+			return false, fmt.Errorf("enexpected format of line. value at %v has no key", idx)
+		}
+
+		value, quoted, valueEnd, valueErr := p.scanValue(line, keyEnd+1)
+		if valueErr != nil {
+			return false, fmt.Errorf("can't parse value of `%s`: %v", key, valueErr)
+		}
+		mapping := p.mappings[string(key)] // conversion doesn't allocate in map lookup
+		if mapping != nil && (!onlyTime || mapping.Field == fields.TimeField) {
+			setErr := p.builder.Set(record, mapping, value, !quoted && isNumber(value))
+			if setErr != nil {
+				return false, fmt.Errorf("can't parse value of `%s`: %v", key, setErr)
+			}
+			timeFound = timeFound || mapping.Field == fields.TimeField
+		}
+		idx = valueEnd
+	}
+}
+
+/*
+Scans value that starts at `valueStart`, returns unescaped content of quoted value,
+that is valid only till the next scan, and the end of value.
+*/
+func (p *LineToStoreRecordParser) scanValue(line []byte, valueStart int) ([]byte, bool, int, error) {
+	if valueStart >= len(line) || line[valueStart] != '"' {
+		valueEnd := len(line)
+		if spaceIdx := bytes.IndexByte(line[valueStart:], ' '); spaceIdx != -1 {
+			valueEnd = valueStart + spaceIdx // spaceIdx is relative to valueStart
+		}
+		return line[valueStart:valueEnd], false, valueEnd, nil
+	}
+	quoteEnd := fields.FindClosingQuote(line, valueStart+1)
+	if quoteEnd == -1 {
+		return nil, false, 0, fmt.Errorf("enexpected format of line. quoted value isn't closed")
+	}
+	if quoteEnd+1 < len(line) && line[quoteEnd+1] != ' ' {
+		return nil, false, 0, fmt.Errorf("enexpected format of line. quoted value should be followed by space")
+	}
+	value := line[valueStart+1 : quoteEnd]
+	if bytes.IndexByte(value, '\\') != -1 {
+		unescaped, unescapeErr := fields.AppendUnescapedJSON(p.valueBuf[:0], value)
+		if unescapeErr != nil {
+			return nil, false, 0, unescapeErr
+		}
+		p.valueBuf = unescaped
+		value = unescaped
+	}
+	return value, true, quoteEnd + 1, nil
+}
+
+/*
+Numbers aren't typed in logfmt, so value is a number if it has only digits and an optional fraction.
+*/
+func isNumber(value []byte) bool {
+	if len(value) == 0 {
+		return false
+	}
+	for _, c := range value {
+		if (c < '0' || c > '9') && c != '.' {
+			return false
+		}
+	}
+	return true
+}
+
+func skipSpaces(line []byte, idx int) int {
+	for idx < len(line) && line[idx] == ' ' {
+		idx++
+	}
+	return idx
+}
@@ -0,0 +1,76 @@
+package logfmt
+
+import (
+	"github.com/storozhukBM/logstat/common/test"
+	"github.com/storozhukBM/logstat/stat"
+	"testing"
+	"time"
+)
+
+func TestLogfmtParsing(t *testing.T) {
+	t.Parallel()
+	cases := []struct {
+		mapping string
+		line    string
+		result  stat.Record
+	}{
+		{
+			mapping: "time=ts,method=method,path=path,status=status,bytes=bytes,duration=dur",
+			line:    `ts=2018-05-10T01:15:59Z method=GET path=/api/x status=200 bytes=123 dur=12ms`,
+			result: stat.Record{
+				UnixTime: 1525914959, Section: "/api", StatusCode: 200, ResponseSize: 123, Latency: 12 * time.Millisecond,
+				Method: "GET", Path: "/api/x",
+			},
+		},
+		{
+			mapping: "time=time:ms,path=uri,status=code,user_agent=ua,host=remote,duration=took:ms",
+			line: `level=info debug time=1525914959123 msg="request \"handled\"" uri="/search?q=a b" ` +
+				`ua="curl/7.58.0 ☺" code=404 remote=10.0.0.1 took=0.5 empty= code=500`,
+			result: stat.Record{
+				UnixTime: 1525914959, Section: "/search?q=a b", StatusCode: 500, Latency: 500 * time.Microsecond,
+				RemoteHost: "10.0.0.1", Path: "/search?q=a b", UserAgent: "curl/7.58.0 ☺",
+			},
+		},
+		{
+			mapping: "time=ts",
+			line:    `ts=1525914959.5`,
+			result:  stat.Record{UnixTime: 1525914959},
+		},
+	}
+	for _, testCase := range cases {
+		for _, cacheSize := range []uint{0, 10} {
+			parser, parserErr := NewLineToStoreRecordParser(testCase.mapping, cacheSize)
+			test.FailOnError(t, parserErr)
+			actual, err := parser.Parse([]byte(testCase.line))
+			test.FailOnError(t, err)
+			test.Equals(t, testCase.result, actual, "mismatch on: %s", testCase.line)
+			unixTime, timeErr := parser.ParseTime([]byte(testCase.line))
+			test.FailOnError(t, timeErr)
+			test.Equals(t, testCase.result.UnixTime, unixTime, "time mismatch on: %s", testCase.line)
+		}
+	}
+}
+
+func TestLogfmtInvalidLines(t *testing.T) {
+	t.Parallel()
+	parser, parserErr := NewLineToStoreRecordParser("time=ts,path=path,status=status,duration=dur", 10)
+	test.FailOnError(t, parserErr)
+	invalidLines := []string{
+		``,
+		`status=200 path=/api`,
+		`ts=yesterday`,
+		`ts=1525914959 status=ok`,
+		`ts=1525914959 path=api`,
+		`ts=1525914959 dur=12parsecs`,
+		`ts=1525914959 msg="not closed`,
+		`ts=1525914959 msg="closed"too early`,
+		`ts=1525914959 msg="bad \x escape"`,
+		`ts=1525914959 =value`,
+	}
+	for _, line := range invalidLines {
+		_, err := parser.Parse([]byte(line))
+		test.Equals(t, true, err != nil, "line should be rejected: %v", line)
+	}
+	_, mappingErr := NewLineToStoreRecordParser("status=status", 10)
+	test.Equals(t, true, mappingErr != nil, "mapping without time should be rejected")
+}
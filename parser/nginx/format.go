@@ -0,0 +1,193 @@
+package nginx
+
+import (
+	"fmt"
+	"github.com/storozhukBM/logstat/parser/fields"
+)
+
+type variable int
+
+const (
+	ignoredVariable variable = iota
+	remoteAddrVariable
+	remoteUserVariable
+	timeLocalVariable
+	timeISO8601Variable
+	msecVariable
+	requestVariable
+	requestMethodVariable
+	requestURIVariable
+	uriVariable
+	serverProtocolVariable
+	statusVariable
+	bodyBytesSentVariable
+	bytesSentVariable
+	httpRefererVariable
+	httpUserAgentVariable
+	requestTimeVariable
+	upstreamStatusVariable
+	upstreamResponseTimeVariable
+)
+
+/*
+Well-known nginx variables that are mapped onto record fields, all other variables are skipped.
+*/
+var knownVariables = map[string]variable{
+	"remote_addr":     remoteAddrVariable,
+	"remote_user":     remoteUserVariable,
+	"time_local":      timeLocalVariable,
+	"time_iso8601":    timeISO8601Variable,
+	"msec":            msecVariable,
+	"request":         requestVariable,
+	"request_method":  requestMethodVariable,
+	"request_uri":     requestURIVariable,
+	"uri":             uriVariable,
+	"server_protocol": serverProtocolVariable,
+	"status":          statusVariable,
+	"body_bytes_sent": bodyBytesSentVariable,
+	"bytes_sent":      bytesSentVariable,
+	"http_referer":    httpRefererVariable,
+	"http_user_agent": httpUserAgentVariable,
+	"request_time":    requestTimeVariable,
+
+	"upstream_status":        upstreamStatusVariable,
+	"upstream_response_time": upstreamResponseTimeVariable,
+}
+
+/*
+Variables that are ignored when another variable of format provides the same record fields.
+*/
+var overriddenBy = map[variable][]variable{
+	requestMethodVariable:  {requestVariable},
+	requestURIVariable:     {requestVariable},
+	uriVariable:            {requestVariable, requestURIVariable},
+	serverProtocolVariable: {requestVariable},
+	bytesSentVariable:      {bodyBytesSentVariable},
+}
+
+/*
+Variable of format and literal that follows it till the next variable or the end of line.
+*/
+type formatPart struct {
+	name     string
+	variable variable
+	suffix   []byte
+	// variable is surrounded by quotes, so its value can contain escaped quotes
+	quoted bool
+}
+
+func (v variable) isTime() bool {
+	return v == timeLocalVariable || v == timeISO8601Variable || v == msecVariable
+}
+
+/*
+Compiles `log_format` into the literal prefix of line and parts for each variable.
+Variables are written as `$name` or `${name}`, they should be separated by some literal,
+otherwise the end of one value can't be found.
+*/
+func compileFormat(logFormat string) ([]byte, []formatPart, error) {
+	var prefix []byte
+	var parts []formatPart
+	literal := make([]byte, 0, len(logFormat))
+	for i := 0; i < len(logFormat); i++ {
+		if logFormat[i] != '$' {
+			literal = append(literal, logFormat[i])
+			continue
+		}
+		name, nameEnd, nameErr := parseVariableName(logFormat, i+1)
+		if nameErr != nil {
+			return nil, nil, nameErr
+		}
+		if name == "" {
+			// `$` without name is just a literal
+			literal = append(literal, logFormat[i])
+			continue
+		}
+		if len(parts) == 0 {
+			prefix = literal
+		} else {
+			if len(literal) == 0 {
+				return nil, nil, fmt.Errorf(
+					"variables `$%v` and `$%v` aren't separated by any literal", parts[len(parts)-1].name, name,
+				)
+			}
+			parts[len(parts)-1].suffix = literal
+		}
+		parts = append(parts, formatPart{name: name, variable: knownVariables[name]})
+		literal = make([]byte, 0, len(logFormat))
+		i = nameEnd - 1
+	}
+	if len(parts) == 0 {
+		return nil, nil, fmt.Errorf("log format has no variables")
+	}
+	parts[len(parts)-1].suffix = literal
+
+	previousLiteral := prefix
+	for i := range parts {
+		parts[i].quoted = fields.IsQuoted(previousLiteral, parts[i].suffix)
+		previousLiteral = parts[i].suffix
+	}
+	resolveVariables(parts)
+
+	hasTime := false
+	for _, part := range parts {
+		hasTime = hasTime || part.variable.isTime()
+	}
+	if !hasTime {
+		return nil, nil, fmt.Errorf("log format should have `$time_local`, `$time_iso8601` or `$msec` variable")
+	}
+	return prefix, parts, nil
+}
+
+/*
+Parses variable name that starts at `nameStart`, returns its end in format.
+*/
+func parseVariableName(logFormat string, nameStart int) (string, int, error) {
+	if nameStart < len(logFormat) && logFormat[nameStart] == '{' {
+		nameEnd := nameStart + 1
+		for nameEnd < len(logFormat) && logFormat[nameEnd] != '}' {
+			nameEnd++
+		}
+		if nameEnd == len(logFormat) {
+			return "", 0, fmt.Errorf("variable name at %v isn't closed by `}`", nameStart)
+		}
+		if nameEnd == nameStart+1 {
+			return "", 0, fmt.Errorf("variable name at %v is empty", nameStart)
+		}
+		return logFormat[nameStart+1 : nameEnd], nameEnd + 1, nil
+	}
+	nameEnd := nameStart
+	for nameEnd < len(logFormat) && isVariableNameChar(logFormat[nameEnd]) {
+		nameEnd++
+	}
+	return logFormat[nameStart:nameEnd], nameEnd, nil
+}
+
+func isVariableNameChar(c byte) bool {
+	return (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9') || c == '_'
+}
+
+/*
+Leaves only one variable for each record field: the first time variable, the first occurrence of each variable
+and variables that aren't overridden by more complete ones, like `$request` over `$request_uri`.
+*/
+func resolveVariables(parts []formatPart) {
+	present := make(map[variable]bool)
+	for _, part := range parts {
+		present[part.variable] = true
+	}
+	seen := make(map[variable]bool)
+	seenTime := false
+	for i := range parts {
+		v := parts[i].variable
+		overridden := seen[v] || (v.isTime() && seenTime)
+		for _, preferred := range overriddenBy[v] {
+			overridden = overridden || present[preferred]
+		}
+		seen[v] = true
+		seenTime = seenTime || v.isTime()
+		if overridden {
+			parts[i].variable = ignoredVariable
+		}
+	}
+}
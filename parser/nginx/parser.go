@@ -0,0 +1,232 @@
+package nginx
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/storozhukBM/logstat/parser/fields"
+	"github.com/storozhukBM/logstat/stat"
+	"time"
+)
+
+/*
+A component used to parse one line of log written by nginx with custom `log_format` to storage req record.
+Format is compiled once into literals that separate variables, so line is scanned
+by `bytes.IndexByte` search of these literals, the same way as in `w3c.LineToStoreRecordParser`.
+
+Responsibilities:
+	- map well-known nginx variables onto record fields:
+		`$remote_addr`, `$remote_user`, `$time_local`, `$time_iso8601`, `$msec`,
+		`$request` or `$request_method`, `$request_uri`, `$uri`, `$server_protocol`,
+		`$status`, `$body_bytes_sent` or `$bytes_sent`, `$http_referer`, `$http_user_agent`,
+		`$request_time`, `$upstream_status`, `$upstream_response_time`
+	- skip all other variables, like `$host`
+	- copy required parts of line bytes to separate strings, so line bytes can be recycled and reused afterward
+
+Attention:
+	- format should have at least one time variable, the first one is used as time of record
+	- value of variable ends at the first occurrence of the literal that follows it in format,
+	so variables that can contain spaces, like `$request` or `$time_local`, should be followed by something else
+	- value of quoted variable can contain quotes escaped by `\`, as nginx writes them with `escape=json`
+	- empty values written by nginx as `-` are stored as is, but numbers are parsed as zero
+	- upstream variables can have several values, like `0.004, 0.002 : 0.001`, if several servers were tried,
+	only the last value, that belongs to the server that sent response, is parsed,
+	such variables contain spaces, so they should be quoted or followed by something else
+*/
+type LineToStoreRecordParser struct {
+	prefix     []byte
+	parts      []formatPart
+	timeParser fields.CommonLogTimeParser
+
+	hostsInternCache      *fields.InternCache
+	usersInternCache      *fields.InternCache
+	methodsInternCache    *fields.InternCache
+	pathsInternCache      *fields.InternCache
+	protocolsInternCache  *fields.InternCache
+	sectionsInternCache   *fields.InternCache
+	referersInternCache   *fields.InternCache
+	userAgentsInternCache *fields.InternCache
+	unescapeBuf           []byte
+}
+
+/*
+Creates parser of lines written with `logFormat`, the same string as in nginx `log_format` directive
+without its name and escape parameter. `internCacheSize` limits size of each cache of interned text parts.
+*/
+func NewLineToStoreRecordParser(logFormat string, internCacheSize uint) (*LineToStoreRecordParser, error) {
+	prefix, parts, formatErr := compileFormat(logFormat)
+	if formatErr != nil {
+		return nil, fmt.Errorf("can't compile log format `%v`: %v", logFormat, formatErr)
+	}
+	result := &LineToStoreRecordParser{
+		prefix:                prefix,
+		parts:                 parts,
+		hostsInternCache:      fields.NewInternCache(internCacheSize),
+		usersInternCache:      fields.NewInternCache(internCacheSize),
+		methodsInternCache:    fields.NewInternCache(internCacheSize),
+		pathsInternCache:      fields.NewInternCache(internCacheSize),
+		protocolsInternCache:  fields.NewInternCache(internCacheSize),
+		sectionsInternCache:   fields.NewInternCache(internCacheSize),
+		referersInternCache:   fields.NewInternCache(internCacheSize),
+		userAgentsInternCache: fields.NewInternCache(internCacheSize),
+	}
+	return result, nil
+}
+
+func (p *LineToStoreRecordParser) Parse(line []byte) (stat.Record, error) {
+	if !bytes.HasPrefix(line, p.prefix) {
+		return stat.Record{}, fmt.Errorf("enexpected format of line. line doesn't start with `%s`", p.prefix)
+	}
+	record := stat.Record{}
+	partStart := len(p.prefix)
+	for i := range p.parts {
+		part := &p.parts[i]
+		valuePart, partEnd, findErr := p.findValuePart(line, partStart, part)
+		if findErr != nil {
+			return stat.Record{}, fmt.Errorf("can't find `$%v`: %v", part.name, findErr)
+		}
+		parseErr := p.parseValuePart(&record, part.variable, valuePart)
+		if parseErr != nil {
+			return stat.Record{}, fmt.Errorf("can't parse `$%v`: %v", part.name, parseErr)
+		}
+		partStart = partEnd
+	}
+	return record, nil
+}
+
+/*
+Parses only time of the line, parts after time variable aren't even scanned.
+*/
+func (p *LineToStoreRecordParser) ParseTime(line []byte) (int64, error) {
+	if !bytes.HasPrefix(line, p.prefix) {
+		return 0, fmt.Errorf("enexpected format of line. line doesn't start with `%s`", p.prefix)
+	}
+	partStart := len(p.prefix)
+	for i := range p.parts {
+		part := &p.parts[i]
+		valuePart, partEnd, findErr := p.findValuePart(line, partStart, part)
+		if findErr != nil {
+			return 0, fmt.Errorf("can't find `$%v`: %v", part.name, findErr)
+		}
+		if part.variable.isTime() {
+			unixTime, timeErr := p.parseTime(part.variable, valuePart)
+			if timeErr != nil {
+				return 0, fmt.Errorf("can't parse `$%v`: %v", part.name, timeErr)
+			}
+			return unixTime, nil
+		}
+		partStart = partEnd
+	}
+	return 0, fmt.Errorf("log format has no time variable")
+}
+
+/*
+Finds value of variable that starts at `partStart`, returns the start of the next value.
+*/
+func (p *LineToStoreRecordParser) findValuePart(line []byte, partStart int, part *formatPart) ([]byte, int, error) {
+	valuePartEnd, findErr := fields.FindValueEnd(line, partStart, part.suffix, part.quoted)
+	if findErr != nil {
+		return nil, 0, findErr
+	}
+	valuePart := line[partStart:valuePartEnd]
+	if part.quoted && part.variable != ignoredVariable && bytes.IndexByte(valuePart, '\\') != -1 {
+		p.unescapeBuf = fields.AppendUnescaped(p.unescapeBuf[:0], valuePart)
+		valuePart = p.unescapeBuf
+	}
+	return valuePart, valuePartEnd + len(part.suffix), nil
+}
+
+func (p *LineToStoreRecordParser) parseValuePart(record *stat.Record, v variable, valuePart []byte) error {
+	switch v {
+	case remoteAddrVariable:
+		record.RemoteHost = p.hostsInternCache.Intern(valuePart)
+	case remoteUserVariable:
+		record.AuthUser = p.usersInternCache.Intern(valuePart)
+	case timeLocalVariable, timeISO8601Variable, msecVariable:
+		unixTime, timeErr := p.parseTime(v, valuePart)
+		if timeErr != nil {
+			return timeErr
+		}
+		record.UnixTime = unixTime
+	case requestVariable:
+		methodPart, pathPart, protocolPart, splitErr := fields.SplitRequest(valuePart)
+		if splitErr != nil {
+			return splitErr
+		}
+		record.Method = p.methodsInternCache.Intern(methodPart)
+		record.Protocol = p.protocolsInternCache.Intern(protocolPart)
+		return p.parsePath(record, pathPart)
+	case requestMethodVariable:
+		record.Method = p.methodsInternCache.Intern(valuePart)
+	case requestURIVariable, uriVariable:
+		return p.parsePath(record, valuePart)
+	case serverProtocolVariable:
+		record.Protocol = p.protocolsInternCache.Intern(valuePart)
+	case statusVariable:
+		statusCode, statusCodeErr := fields.ParseInt(valuePart)
+		if statusCodeErr != nil {
+			return statusCodeErr
+		}
+		record.StatusCode = int32(statusCode)
+	case bodyBytesSentVariable, bytesSentVariable:
+		bodySize, bodySizeErr := fields.ParseIntOrDash(valuePart)
+		if bodySizeErr != nil {
+			return bodySizeErr
+		}
+		record.ResponseSize = bodySize
+	case httpRefererVariable:
+		record.Referer = p.referersInternCache.Intern(valuePart)
+	case httpUserAgentVariable:
+		record.UserAgent = p.userAgentsInternCache.Intern(valuePart)
+	case requestTimeVariable:
+		latency, latencyErr := fields.ParseDuration(valuePart, time.Second)
+		if latencyErr != nil {
+			return latencyErr
+		}
+		record.Latency = latency
+	case upstreamStatusVariable:
+		statusCode, statusCodeErr := fields.ParseIntOrDash(lastUpstreamValue(valuePart))
+		if statusCodeErr != nil {
+			return statusCodeErr
+		}
+		record.UpstreamStatusCode = int32(statusCode)
+	case upstreamResponseTimeVariable:
+		latency, latencyErr := fields.ParseDuration(lastUpstreamValue(valuePart), time.Second)
+		if latencyErr != nil {
+			return latencyErr
+		}
+		record.UpstreamLatency = latency
+	}
+	return nil
+}
+
+/*
+Returns the last value of upstream variable, values of servers are separated by `, ` and values of redirects by ` : `.
+*/
+func lastUpstreamValue(valuePart []byte) []byte {
+	valueStart := bytes.LastIndexAny(valuePart, ",:") + 1
+	for valueStart < len(valuePart) && valuePart[valueStart] == ' ' {
+		valueStart++
+	}
+	return valuePart[valueStart:]
+}
+
+func (p *LineToStoreRecordParser) parsePath(record *stat.Record, pathPart []byte) error {
+	sectionPart, sectionErr := fields.SectionOf(pathPart)
+	if sectionErr != nil {
+		return sectionErr
+	}
+	record.Path = p.pathsInternCache.Intern(pathPart)
+	record.Section = p.sectionsInternCache.Intern(sectionPart)
+	return nil
+}
+
+func (p *LineToStoreRecordParser) parseTime(v variable, timePart []byte) (int64, error) {
+	switch v {
+	case timeISO8601Variable:
+		return fields.ParseISO8601Time(timePart)
+	case msecVariable:
+		return fields.ParseEpochTime(timePart)
+	default:
+		return p.timeParser.Parse(timePart)
+	}
+}
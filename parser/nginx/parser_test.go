@@ -0,0 +1,143 @@
+package nginx
+
+import (
+	"github.com/storozhukBM/logstat/common/test"
+	"github.com/storozhukBM/logstat/stat"
+	"testing"
+	"time"
+)
+
+const combinedFormat = `$remote_addr - $remote_user [$time_local] "$request" $status $body_bytes_sent ` +
+	`"$http_referer" "$http_user_agent"`
+
+type parsingCase struct {
+	line   string
+	result stat.Record
+}
+
+func TestNginxCombinedFormatParsing(t *testing.T) {
+	t.Parallel()
+	parserWithCache, parserWithCacheErr := NewLineToStoreRecordParser(combinedFormat, 10)
+	test.FailOnError(t, parserWithCacheErr)
+	parserNoCache, parserNoCacheErr := NewLineToStoreRecordParser(combinedFormat, 0)
+	test.FailOnError(t, parserNoCacheErr)
+
+	cases := []parsingCase{
+		{
+			line: `127.0.0.1 - frank [10/May/2018:01:15:59 +0000] "GET /api/user HTTP/1.1" 200 34 ` +
+				`"http://example.com/start.html" "Mozilla/5.0 (X11; Linux x86_64)"`,
+			result: stat.Record{
+				UnixTime: 1525914959, Section: "/api", StatusCode: 200, ResponseSize: 34,
+				RemoteHost: "127.0.0.1", AuthUser: "frank", Method: "GET", Path: "/api/user", Protocol: "HTTP/1.1",
+				Referer: "http://example.com/start.html", UserAgent: "Mozilla/5.0 (X11; Linux x86_64)",
+			},
+		},
+		{
+			line: `10.0.0.1 - - [10/May/2018:01:16:00 +0000] "GET /search?q=\x22quoted\x22 HTTP/1.1" 404 - ` +
+				`"-" "agent with \"quotes\""`,
+			result: stat.Record{
+				UnixTime: 1525914960, Section: `/search?q=\x22quoted\x22`, StatusCode: 404, ResponseSize: 0,
+				RemoteHost: "10.0.0.1", AuthUser: "-", Method: "GET", Path: `/search?q=\x22quoted\x22`, Protocol: "HTTP/1.1",
+				Referer: "-", UserAgent: `agent with "quotes"`,
+			},
+		},
+	}
+	for _, parser := range []*LineToStoreRecordParser{parserWithCache, parserNoCache} {
+		for _, testCase := range cases {
+			actual, err := parser.Parse([]byte(testCase.line))
+			test.FailOnError(t, err)
+			test.Equals(t, testCase.result, actual, "mismatch on: %s", testCase.line)
+			unixTime, timeErr := parser.ParseTime([]byte(testCase.line))
+			test.FailOnError(t, timeErr)
+			test.Equals(t, testCase.result.UnixTime, unixTime, "time mismatch on: %s", testCase.line)
+		}
+	}
+
+	invalidLines := []string{
+		``,
+		`127.0.0.1 - frank [10/May/2018:01:15:59 +0000] "GET /api/user HTTP/1.1" 200 34`,
+		`127.0.0.1 - frank [10/May/2018:01:15:59 +0000] "GET /api/user HTTP/1.1" 200 34 "referer" "agent`,
+		`127.0.0.1 - frank [10/May/2018:01:15:59] "GET /api/user HTTP/1.1" 200 34 "-" "-"`,
+		`127.0.0.1 - frank [10/May/2018:01:15:59 +0000] "GET /api/user HTTP/1.1" 2x0 34 "-" "-"`,
+		`127.0.0.1 - frank [10/May/2018:01:15:59 +0000] "GET" 200 34 "-" "-"`,
+		`127.0.0.1 frank [10/May/2018:01:15:59 +0000] "GET /api/user HTTP/1.1" 200 34 "-" "-"`,
+	}
+	for _, line := range invalidLines {
+		_, err := parserWithCache.Parse([]byte(line))
+		test.Equals(t, true, err != nil, "line should be rejected: %v", line)
+	}
+}
+
+func TestNginxCustomFormatParsing(t *testing.T) {
+	t.Parallel()
+	cases := []struct {
+		format string
+		line   string
+		result stat.Record
+	}{
+		{
+			format: `$host $remote_addr [$time_local] "$request_method ${request_uri} $server_protocol" ` +
+				`$status $bytes_sent $request_time $upstream_response_time`,
+			line: `example.com 10.0.0.1 [10/May/2018:01:15:59 +0000] "POST /api/user?id=1 HTTP/2.0" 201 512 0.005 0.004`,
+			result: stat.Record{
+				UnixTime: 1525914959, Section: "/api", StatusCode: 201, ResponseSize: 512,
+				RemoteHost: "10.0.0.1", Method: "POST", Path: "/api/user?id=1", Protocol: "HTTP/2.0",
+				Latency: 5 * time.Millisecond, UpstreamLatency: 4 * time.Millisecond,
+			},
+		},
+		{
+			format: `$time_iso8601|$status|$uri|$request_uri|$body_bytes_sent|$bytes_sent`,
+			line:   `2018-05-10T01:15:59+00:00|200|/api/user|/api/user?id=1|10|250`,
+			result: stat.Record{
+				UnixTime: 1525914959, Section: "/api", StatusCode: 200, ResponseSize: 10, Path: "/api/user?id=1",
+			},
+		},
+		{
+			format: `$msec $request_time "$request" $status $time_local`,
+			line:   `1525914959.123 0.001 "GET /health HTTP/1.1" 200 10/May/2018:01:16:30 +0000`,
+			result: stat.Record{
+				UnixTime: 1525914959, Section: "/health", StatusCode: 200,
+				Method: "GET", Path: "/health", Protocol: "HTTP/1.1", Latency: time.Millisecond,
+			},
+		},
+		{
+			format: `[$time_local] $status "$upstream_status" $request_time "$upstream_response_time"`,
+			line:   `[10/May/2018:01:15:59 +0000] 200 "502, 200 : 200" 1.250 "0.500, 0.700 : 0.020"`,
+			result: stat.Record{
+				UnixTime: 1525914959, StatusCode: 200, UpstreamStatusCode: 200,
+				Latency: 1250 * time.Millisecond, UpstreamLatency: 20 * time.Millisecond,
+			},
+		},
+		{
+			format: `[$time_local] $status "$upstream_status" $request_time "$upstream_response_time"`,
+			line:   `[10/May/2018:01:15:59 +0000] 404 "-" 0.000 "-"`,
+			result: stat.Record{UnixTime: 1525914959, StatusCode: 404},
+		},
+	}
+	for _, testCase := range cases {
+		parser, parserErr := NewLineToStoreRecordParser(testCase.format, 10)
+		test.FailOnError(t, parserErr)
+		actual, err := parser.Parse([]byte(testCase.line))
+		test.FailOnError(t, err)
+		test.Equals(t, testCase.result, actual, "mismatch on: %s", testCase.line)
+		unixTime, timeErr := parser.ParseTime([]byte(testCase.line))
+		test.FailOnError(t, timeErr)
+		test.Equals(t, testCase.result.UnixTime, unixTime, "time mismatch on: %s", testCase.line)
+	}
+}
+
+func TestNginxInvalidFormats(t *testing.T) {
+	t.Parallel()
+	invalidFormats := []string{
+		``,
+		`just literal`,
+		`$remote_addr $status`,
+		`$time_local$status`,
+		`${time_local`,
+		`${} $time_local`,
+	}
+	for _, format := range invalidFormats {
+		_, err := NewLineToStoreRecordParser(format, 10)
+		test.Equals(t, true, err != nil, "format should be rejected: %v", format)
+	}
+}
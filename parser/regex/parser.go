@@ -0,0 +1,194 @@
+package regex
+
+import (
+	"fmt"
+	"github.com/storozhukBM/logstat/parser/fields"
+	"github.com/storozhukBM/logstat/stat"
+	"regexp"
+)
+
+const (
+	clientGroup  = "client"
+	requestGroup = "request"
+)
+
+var (
+	methodMapping   = fields.FieldMapping{Field: fields.MethodField, Key: requestGroup}
+	pathMapping     = fields.FieldMapping{Field: fields.PathField, Key: requestGroup}
+	protocolMapping = fields.FieldMapping{Field: fields.ProtocolField, Key: requestGroup}
+)
+
+/*
+Named group of pattern mapped onto record field, `request` group has no mapping, because it is split into several fields.
+*/
+type group struct {
+	name    string
+	index   int
+	mapping *fields.FieldMapping
+}
+
+/*
+A component used to parse one line of log in arbitrary format, described by regular expression with named groups,
+to storage req record. It is an escape hatch for formats that have no dedicated parser,
+so it is several times slower than them.
+
+Responsibilities:
+	- map named groups onto record fields, group names are the same as fields of `fields.ParseFieldMappings`,
+	like `time`, `status`, `path`, `method`, `bytes` or `duration`, and `client` is an alias of `host`
+	- split `request` group, like `GET /api/user HTTP/1.1`, into method, path and protocol
+	- parse time by configured layout and duration numbers by configured unit
+	- copy required parts of line bytes to separate strings, so line bytes can be recycled and reused afterward
+
+Attention:
+	- `time` group is required, groups that didn't participate in match or matched empty string are skipped
+	- unnamed groups are skipped, but unknown named groups are rejected, so typos in names aren't missed
+	- line is matched without conversion to string and values are interned, but each match allocates its indexes
+*/
+type LineToStoreRecordParser struct {
+	pattern   *regexp.Regexp
+	groups    []group
+	timeGroup group
+	builder   *fields.RecordBuilder
+}
+
+/*
+Creates parser of lines matched by `pattern`, like `^(?P<client>\S+) \[(?P<time>[^\]]+)\] "(?P<request>[^"]*)"`.
+`timeLayout` is epoch unit `s`, `ms`, `us`, `ns`, or `rfc3339`, `clf` or Go layout of time.
+`durationUnit` is unit of duration numbers `s`, `ms`, `us` or `ns`, durations with units, like `12ms`, are parsed as is.
+`internCacheSize` limits size of each cache of interned text parts.
+*/
+func NewLineToStoreRecordParser(
+	pattern string, timeLayout string, durationUnit string, internCacheSize uint,
+) (*LineToStoreRecordParser, error) {
+	compiledPattern, compileErr := regexp.Compile(pattern)
+	if compileErr != nil {
+		return nil, fmt.Errorf("can't compile pattern `%v`: %v", pattern, compileErr)
+	}
+	result := &LineToStoreRecordParser{
+		pattern:   compiledPattern,
+		timeGroup: group{index: -1},
+		builder:   fields.NewRecordBuilder(internCacheSize),
+	}
+	mappedFields := make(map[fields.Field]bool)
+	hasRequest := false
+	for i, name := range compiledPattern.SubexpNames() {
+		if name == "" {
+			continue
+		}
+		if name == requestGroup {
+			hasRequest = true
+			result.groups = append(result.groups, group{name: name, index: i})
+			continue
+		}
+		fieldName := name
+		if name == clientGroup {
+			fieldName = "host"
+		}
+		f, ok := fields.FieldByName(fieldName)
+		if !ok {
+			return nil, fmt.Errorf("unknown group `%v` in pattern `%v`", name, pattern)
+		}
+		if mappedFields[f] {
+			return nil, fmt.Errorf("field of group `%v` is already mapped in pattern `%v`", name, pattern)
+		}
+		mappedFields[f] = true
+
+		option := ""
+		switch f {
+		case fields.TimeField:
+			option = timeLayout
+		case fields.DurationField:
+			option = durationUnit
+		}
+		mapping, mappingErr := fields.NewFieldMapping(f, name, option)
+		if mappingErr != nil {
+			return nil, fmt.Errorf("can't map group `%v`: %v", name, mappingErr)
+		}
+		g := group{name: name, index: i, mapping: &mapping}
+		if f == fields.TimeField {
+			result.timeGroup = g
+		}
+		result.groups = append(result.groups, g)
+	}
+	if hasRequest && (mappedFields[fields.MethodField] || mappedFields[fields.PathField] || mappedFields[fields.ProtocolField]) {
+		return nil, fmt.Errorf("`request` group can't be used with `method`, `path` or `protocol` groups in pattern `%v`", pattern)
+	}
+	if result.timeGroup.index == -1 {
+		return nil, fmt.Errorf("pattern `%v` should have `time` group", pattern)
+	}
+	return result, nil
+}
+
+func (p *LineToStoreRecordParser) Parse(line []byte) (stat.Record, error) {
+	match := p.pattern.FindSubmatchIndex(line)
+	if match == nil {
+		return stat.Record{}, fmt.Errorf("enexpected format of line. line doesn't match pattern")
+	}
+	record := stat.Record{}
+	for i := range p.groups {
+		g := &p.groups[i]
+		value, ok := groupValue(line, match, g.index)
+		if !ok {
+			if g.index == p.timeGroup.index {
+				return stat.Record{}, fmt.Errorf("enexpected format of line. time group is empty")
+			}
+			continue
+		}
+		var setErr error
+		if g.mapping == nil {
+			setErr = p.setRequest(&record, value)
+		} else {
+			setErr = p.builder.Set(&record, g.mapping, value, false)
+		}
+		if setErr != nil {
+			return stat.Record{}, fmt.Errorf("can't parse group `%v`: %v", g.name, setErr)
+		}
+	}
+	return record, nil
+}
+
+/*
+Parses only time group of the line, but the whole line is still matched by pattern.
+*/
+func (p *LineToStoreRecordParser) ParseTime(line []byte) (int64, error) {
+	match := p.pattern.FindSubmatchIndex(line)
+	if match == nil {
+		return 0, fmt.Errorf("enexpected format of line. line doesn't match pattern")
+	}
+	value, ok := groupValue(line, match, p.timeGroup.index)
+	if !ok {
+		return 0, fmt.Errorf("enexpected format of line. time group is empty")
+	}
+	unixTime, timeErr := p.builder.ParseTime(p.timeGroup.mapping, value, false)
+	if timeErr != nil {
+		return 0, fmt.Errorf("can't parse group `%v`: %v", p.timeGroup.name, timeErr)
+	}
+	return unixTime, nil
+}
+
+func (p *LineToStoreRecordParser) setRequest(record *stat.Record, requestPart []byte) error {
+	methodPart, pathPart, protocolPart, splitErr := fields.SplitRequest(requestPart)
+	if splitErr != nil {
+		return splitErr
+	}
+	pathErr := p.builder.Set(record, &pathMapping, pathPart, false)
+	if pathErr != nil {
+		return pathErr
+	}
+	_ = p.builder.Set(record, &methodMapping, methodPart, false)
+	if len(protocolPart) > 0 {
+		_ = p.builder.Set(record, &protocolMapping, protocolPart, false)
+	}
+	return nil
+}
+
+/*
+Returns value of group with `index`, groups that didn't participate in match or matched empty string have no value.
+*/
+func groupValue(line []byte, match []int, index int) ([]byte, bool) {
+	start, end := match[2*index], match[2*index+1]
+	if start == -1 || start == end {
+		return nil, false
+	}
+	return line[start:end], true
+}
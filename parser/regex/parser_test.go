@@ -0,0 +1,81 @@
+package regex
+
+import (
+	"github.com/storozhukBM/logstat/common/test"
+	"github.com/storozhukBM/logstat/stat"
+	"testing"
+	"time"
+)
+
+const commonLogPattern = `^(?P<client>\S+) \S+ (?P<user>\S+) \[(?P<time>[^\]]+)\] "(?P<request>[^"]*)" (?P<status>\d{3}) (?P<bytes>\S+)`
+
+func TestParsing(t *testing.T) {
+	t.Parallel()
+	parser, parserErr := NewLineToStoreRecordParser(commonLogPattern, "clf", "s", 10)
+	test.FailOnError(t, parserErr)
+
+	line := []byte(`127.0.0.1 - james [09/May/2018:16:00:39 +0000] "GET /report HTTP/1.0" 200 123`)
+	record, err := parser.Parse(line)
+	test.FailOnError(t, err)
+	expected := stat.Record{
+		UnixTime: 1525881639, Section: "/report", StatusCode: 200, ResponseSize: 123,
+		RemoteHost: "127.0.0.1", AuthUser: "james", Method: "GET", Path: "/report", Protocol: "HTTP/1.0",
+	}
+	test.Equals(t, expected, record, "record mismatch")
+
+	unixTime, timeErr := parser.ParseTime(line)
+	test.FailOnError(t, timeErr)
+	test.Equals(t, int64(1525881639), unixTime, "time mismatch")
+}
+
+func TestParsingWithLayoutAndDuration(t *testing.T) {
+	t.Parallel()
+	pattern := `^(?P<time>\S+ \S+) (?P<method>[A-Z]+) (?P<path>/\S*)(?: (?P<status>\d+))? took (?P<duration>\S+)$`
+	parser, parserErr := NewLineToStoreRecordParser(pattern, "2006-01-02 15:04:05", "ms", 10)
+	test.FailOnError(t, parserErr)
+
+	record, err := parser.Parse([]byte(`2018-05-09 16:00:39 POST /api/user 201 took 12`))
+	test.FailOnError(t, err)
+	expected := stat.Record{
+		UnixTime: 1525881639, Section: "/api", StatusCode: 201, Method: "POST", Path: "/api/user", Latency: 12 * time.Millisecond,
+	}
+	test.Equals(t, expected, record, "record mismatch")
+
+	record, err = parser.Parse([]byte(`2018-05-09 16:00:40 GET /health took 1.5s`))
+	test.FailOnError(t, err)
+	expected = stat.Record{
+		UnixTime: 1525881640, Section: "/health", Method: "GET", Path: "/health", Latency: 1500 * time.Millisecond,
+	}
+	test.Equals(t, expected, record, "optional group that didn't participate in match should be skipped")
+}
+
+func TestParsingErrors(t *testing.T) {
+	t.Parallel()
+	parser, parserErr := NewLineToStoreRecordParser(commonLogPattern, "clf", "s", 10)
+	test.FailOnError(t, parserErr)
+	lines := []string{
+		``,
+		`127.0.0.1 - james [09/May/2018:16:00:39 +0000] "GET /report HTTP/1.0" 20 123`,
+		`127.0.0.1 - james [09/May/2018:16:00:39] "GET /report HTTP/1.0" 200 123`,
+		`127.0.0.1 - james [09/May/2018:16:00:39 +0000] "GET" 200 123`,
+		`127.0.0.1 - james [09/May/2018:16:00:39 +0000] "GET /report HTTP/1.0" 200 x`,
+	}
+	for _, line := range lines {
+		_, err := parser.Parse([]byte(line))
+		test.Equals(t, true, err != nil, "line should be rejected: %v", line)
+	}
+
+	patterns := []string{
+		`(?P<time>\S+`,
+		`(?P<status>\d+)`,
+		`(?P<time>\S+) (?P<unknown>\S+)`,
+		`(?P<time>\S+) (?P<client>\S+) (?P<host>\S+)`,
+		`(?P<time>\S+) (?P<request>[^"]+) (?P<path>\S+)`,
+	}
+	for _, pattern := range patterns {
+		_, err := NewLineToStoreRecordParser(pattern, "clf", "s", 10)
+		test.Equals(t, true, err != nil, "pattern should be rejected: %v", pattern)
+	}
+	_, unitErr := NewLineToStoreRecordParser(`(?P<time>\S+) (?P<duration>\S+)`, "clf", "h", 10)
+	test.Equals(t, true, unitErr != nil, "unknown duration unit should be rejected")
+}
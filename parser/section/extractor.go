@@ -0,0 +1,228 @@
+package section
+
+import (
+	"fmt"
+	"github.com/storozhukBM/logstat/parser/fields"
+	"strings"
+)
+
+const (
+	idPlaceholder   = ":id"
+	uuidPlaceholder = ":uuid"
+	hexPlaceholder  = ":hex"
+	// shorter hex segments are more likely words, like `/cafe` or `/add`, than identifiers
+	minHexSegmentLength = 8
+)
+
+/*
+Route template, like `/api/user/:id`, split into segments. Segments that start with `:` match any segment of path.
+*/
+type template struct {
+	route    string
+	segments []string
+}
+
+/*
+A component used to extract sections of request paths with configurable granularity,
+so `/api/user/123` and `/api/order/9` can be different sections without a separate section for each ID.
+
+Responsibilities:
+	- keep the first `depth` segments of path, like `/api/user` of `/api/user/123/photos` for depth 2
+	- map paths matched by route templates, like `/api/user/:id`, onto the template itself,
+	template matches path if path starts with segments of template
+	- replace numeric, UUID and long hex segments with `:id`, `:uuid` and `:hex` placeholders if enabled,
+	like `/api/user/:id` of `/api/user/123`
+	- intern extracted sections the same way as parsers intern them
+
+Attention:
+	- templates are matched in configured order, so more specific templates should go before more general ones
+	- query string isn't a part of section, unlike section of `fields.SectionOf`
+	- this component reuses its buffer and isn't safe for concurrent use
+*/
+type Extractor struct {
+	depth        int
+	templates    []template
+	placeholders bool
+
+	sectionBuf          []byte
+	sectionsInternCache *fields.InternCache
+}
+
+/*
+Creates extractor of sections that keeps `depth` segments of paths not matched by `templates`.
+`placeholders` enables replacement of ID segments, `internCacheSize` limits size of cache of interned sections.
+*/
+func NewExtractor(depth uint, templates []string, placeholders bool, internCacheSize uint) (*Extractor, error) {
+	if depth < 1 {
+		return nil, fmt.Errorf("depth should be at least 1")
+	}
+	result := &Extractor{
+		depth:               int(depth),
+		placeholders:        placeholders,
+		sectionsInternCache: fields.NewInternCache(internCacheSize),
+	}
+	for _, route := range templates {
+		t, templateErr := parseTemplate(route)
+		if templateErr != nil {
+			return nil, templateErr
+		}
+		result.templates = append(result.templates, t)
+	}
+	return result, nil
+}
+
+func parseTemplate(route string) (template, error) {
+	if !strings.HasPrefix(route, "/") || len(route) < 2 {
+		return template{}, fmt.Errorf("route template should start with `/` and have segments: `%v`", route)
+	}
+	if strings.ContainsAny(route, "?#") {
+		return template{}, fmt.Errorf("route template can't have query string: `%v`", route)
+	}
+	segments := strings.Split(strings.TrimSuffix(route[1:], "/"), "/")
+	for _, segment := range segments {
+		if segment == "" || segment == ":" {
+			return template{}, fmt.Errorf("route template has empty segment: `%v`", route)
+		}
+	}
+	return template{route: strings.TrimSuffix(route, "/"), segments: segments}, nil
+}
+
+/*
+Returns section of `path`, or `false` if path has no `/` to start section from.
+Path can be URL, like `http://example.com/api/user`, that is written for requests to proxies.
+*/
+func (e *Extractor) Section(path string) (string, bool) {
+	if schemeEnd := strings.Index(path, "://"); schemeEnd != -1 {
+		path = path[schemeEnd+len("://"):]
+		hostEnd := strings.IndexByte(path, '/')
+		if hostEnd == -1 {
+			return "/", true
+		}
+		path = path[hostEnd:]
+	}
+	pathStart := strings.IndexByte(path, '/')
+	if pathStart == -1 {
+		return "", false
+	}
+	path = path[pathStart:]
+	if queryStart := strings.IndexAny(path, "?#"); queryStart != -1 {
+		path = path[:queryStart]
+	}
+
+	for i := range e.templates {
+		if e.matches(&e.templates[i], path) {
+			return e.templates[i].route, true
+		}
+	}
+
+	e.sectionBuf = e.sectionBuf[:0]
+	rest := path[1:]
+	for segmentIdx := 0; segmentIdx < e.depth && rest != ""; segmentIdx++ {
+		segment := rest
+		segmentEnd := strings.IndexByte(rest, '/')
+		if segmentEnd == -1 {
+			rest = ""
+		} else {
+			segment, rest = rest[:segmentEnd], rest[segmentEnd+1:]
+		}
+		e.sectionBuf = append(e.sectionBuf, '/')
+		e.sectionBuf = append(e.sectionBuf, e.placeholderOf(segment)...)
+	}
+	if len(e.sectionBuf) == 0 {
+		return "/", true
+	}
+	return e.sectionsInternCache.Intern(e.sectionBuf), true
+}
+
+/*
+Path matches template if path starts with segments of template, segments after template are ignored.
+*/
+func (e *Extractor) matches(t *template, path string) bool {
+	rest := path[1:]
+	for _, templateSegment := range t.segments {
+		if rest == "" {
+			return false
+		}
+		segment := rest
+		segmentEnd := strings.IndexByte(rest, '/')
+		if segmentEnd == -1 {
+			rest = ""
+		} else {
+			segment, rest = rest[:segmentEnd], rest[segmentEnd+1:]
+		}
+		if segment == "" || (templateSegment[0] != ':' && templateSegment != segment) {
+			return false
+		}
+	}
+	return true
+}
+
+/*
+Returns placeholder of segment that looks like an ID, or the segment itself.
+*/
+func (e *Extractor) placeholderOf(segment string) string {
+	if !e.placeholders || segment == "" {
+		return segment
+	}
+	switch {
+	case isNumeric(segment):
+		return idPlaceholder
+	case isUUID(segment):
+		return uuidPlaceholder
+	case isHexID(segment):
+		return hexPlaceholder
+	default:
+		return segment
+	}
+}
+
+func isNumeric(segment string) bool {
+	for i := 0; i < len(segment); i++ {
+		if segment[i] < '0' || segment[i] > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+/*
+UUID is 32 hex digits in groups of 8-4-4-4-12, like `123e4567-e89b-12d3-a456-426614174000`.
+*/
+func isUUID(segment string) bool {
+	if len(segment) != 36 {
+		return false
+	}
+	for i := 0; i < len(segment); i++ {
+		if i == 8 || i == 13 || i == 18 || i == 23 {
+			if segment[i] != '-' {
+				return false
+			}
+			continue
+		}
+		if !isHexDigit(segment[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+/*
+Hex ID is a long hex number with at least one decimal digit, like object ID or hash, so words like `deadbeef` are kept.
+*/
+func isHexID(segment string) bool {
+	if len(segment) < minHexSegmentLength {
+		return false
+	}
+	hasDigit := false
+	for i := 0; i < len(segment); i++ {
+		if !isHexDigit(segment[i]) {
+			return false
+		}
+		hasDigit = hasDigit || (segment[i] >= '0' && segment[i] <= '9')
+	}
+	return hasDigit
+}
+
+func isHexDigit(c byte) bool {
+	return (c >= '0' && c <= '9') || (c >= 'a' && c <= 'f') || (c >= 'A' && c <= 'F')
+}
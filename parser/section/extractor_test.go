@@ -0,0 +1,77 @@
+package section
+
+import (
+	"github.com/storozhukBM/logstat/common/test"
+	"testing"
+)
+
+func TestSectionDepth(t *testing.T) {
+	t.Parallel()
+	extractor, extractorErr := NewExtractor(2, nil, false, 10)
+	test.FailOnError(t, extractorErr)
+	cases := map[string]string{
+		"/api/user/123/photos": "/api/user",
+		"/api/user/123":        "/api/user",
+		"/api/user/":           "/api/user",
+		"/api/order?id=9":      "/api/order",
+		"/api?id=9":            "/api",
+		"/":                    "/",
+		"/?id=1":               "/",
+		"http://host/api/user": "/api/user",
+		"https://host:443":     "/",
+	}
+	for path, expected := range cases {
+		section, ok := extractor.Section(path)
+		test.Equals(t, true, ok, "section should be found: %v", path)
+		test.Equals(t, expected, section, "section mismatch of: %v", path)
+	}
+	_, ok := extractor.Section("*")
+	test.Equals(t, false, ok, "path without `/` should have no section")
+}
+
+func TestSectionPlaceholders(t *testing.T) {
+	t.Parallel()
+	extractor, extractorErr := NewExtractor(3, nil, true, 10)
+	test.FailOnError(t, extractorErr)
+	cases := map[string]string{
+		"/api/user/123":                                       "/api/user/:id",
+		"/api/9/orders":                                       "/api/:id/orders",
+		"/api/user/123e4567-e89b-12d3-a456-426614174000/info": "/api/user/:uuid",
+		"/api/object/5f2b6c1e9a8d7e0012ab34cd":                "/api/object/:hex",
+		"/api/object/deadbeef":                                "/api/object/deadbeef",
+		"/api/tag/cafe42":                                     "/api/tag/cafe42",
+		"/api/user/me":                                        "/api/user/me",
+	}
+	for path, expected := range cases {
+		section, _ := extractor.Section(path)
+		test.Equals(t, expected, section, "section mismatch of: %v", path)
+	}
+}
+
+func TestSectionTemplates(t *testing.T) {
+	t.Parallel()
+	templates := []string{"/api/user/:id/photos", "/api/user/:id", "/api/order/:orderID/"}
+	extractor, extractorErr := NewExtractor(1, templates, false, 10)
+	test.FailOnError(t, extractorErr)
+	cases := map[string]string{
+		"/api/user/123/photos/1": "/api/user/:id/photos",
+		"/api/user/123":          "/api/user/:id",
+		"/api/user/me?full=1":    "/api/user/:id",
+		"/api/order/9/items":     "/api/order/:orderID",
+		"/api/user":              "/api",
+		"/api/user//photos":      "/api",
+		"/report/2018":           "/report",
+	}
+	for path, expected := range cases {
+		section, _ := extractor.Section(path)
+		test.Equals(t, expected, section, "section mismatch of: %v", path)
+	}
+
+	invalid := [][]string{{"api/user"}, {"/"}, {"/api//user"}, {"/api/:"}, {"/api?id=:id"}}
+	for _, templates := range invalid {
+		_, err := NewExtractor(1, templates, false, 10)
+		test.Equals(t, true, err != nil, "template should be rejected: %v", templates)
+	}
+	_, depthErr := NewExtractor(0, nil, false, 10)
+	test.Equals(t, true, depthErr != nil, "zero depth should be rejected")
+}
@@ -0,0 +1,51 @@
+package section
+
+import (
+	"fmt"
+	"github.com/storozhukBM/logstat/stat"
+)
+
+type LineParser interface {
+	Parse(line []byte) (stat.Record, error)
+	ParseTime(line []byte) (int64, error)
+}
+
+/*
+A component used to parse lines by another parser and replace sections of its records by sections of `Extractor`.
+
+Responsibilities:
+	- extract section from path of parsed record, records without path keep their section
+	- parse time of line by another parser as is
+
+Attention:
+	- section is extracted after parser already found its own, so configured sections cost a bit more than default ones
+*/
+type LineToStoreRecordParser struct {
+	parser    LineParser
+	extractor *Extractor
+}
+
+func NewLineToStoreRecordParser(parser LineParser, extractor *Extractor) (*LineToStoreRecordParser, error) {
+	if parser == nil {
+		return nil, fmt.Errorf("parser can't be nil")
+	}
+	if extractor == nil {
+		return nil, fmt.Errorf("extractor can't be nil")
+	}
+	return &LineToStoreRecordParser{parser: parser, extractor: extractor}, nil
+}
+
+func (p *LineToStoreRecordParser) Parse(line []byte) (stat.Record, error) {
+	record, err := p.parser.Parse(line)
+	if err != nil {
+		return record, err
+	}
+	if section, ok := p.extractor.Section(record.Path); ok {
+		record.Section = section
+	}
+	return record, nil
+}
+
+func (p *LineToStoreRecordParser) ParseTime(line []byte) (int64, error) {
+	return p.parser.ParseTime(line)
+}
@@ -0,0 +1,57 @@
+package section
+
+import (
+	"fmt"
+	"github.com/storozhukBM/logstat/common/test"
+	"github.com/storozhukBM/logstat/stat"
+	"testing"
+)
+
+func TestParsing(t *testing.T) {
+	t.Parallel()
+	extractor, extractorErr := NewExtractor(2, nil, true, 10)
+	test.FailOnError(t, extractorErr)
+	parser, parserErr := NewLineToStoreRecordParser(pathParser{}, extractor)
+	test.FailOnError(t, parserErr)
+
+	record, err := parser.Parse([]byte("/api/user/123"))
+	test.FailOnError(t, err)
+	test.Equals(t, stat.Record{UnixTime: 1, Path: "/api/user/123", Section: "/api/user"}, record, "record mismatch")
+
+	record, err = parser.Parse([]byte("/123/photos"))
+	test.FailOnError(t, err)
+	test.Equals(t, "/:id/photos", record.Section, "section mismatch")
+
+	record, err = parser.Parse([]byte("-"))
+	test.FailOnError(t, err)
+	test.Equals(t, "-", record.Section, "record without path should keep its section")
+
+	_, err = parser.Parse([]byte(""))
+	test.Equals(t, true, err != nil, "parse error should be returned")
+
+	unixTime, timeErr := parser.ParseTime([]byte("/api"))
+	test.FailOnError(t, timeErr)
+	test.Equals(t, int64(1), unixTime, "time mismatch")
+
+	_, nilErr := NewLineToStoreRecordParser(nil, extractor)
+	test.Equals(t, true, nilErr != nil, "nil parser should be rejected")
+}
+
+/*
+Parses line as path, with section of the whole line, like parser of format that has no path field.
+*/
+type pathParser struct{}
+
+func (pathParser) Parse(line []byte) (stat.Record, error) {
+	if len(line) == 0 {
+		return stat.Record{}, fmt.Errorf("empty line")
+	}
+	if line[0] != '/' {
+		return stat.Record{UnixTime: 1, Section: string(line)}, nil
+	}
+	return stat.Record{UnixTime: 1, Path: string(line), Section: string(line)}, nil
+}
+
+func (pathParser) ParseTime(line []byte) (int64, error) {
+	return 1, nil
+}
@@ -0,0 +1,44 @@
+package w3c
+
+import (
+	"github.com/storozhukBM/logstat/parser/fields"
+	"time"
+)
+
+/*
+Fields of CloudFront standard logs, used till the first `#Fields` directive.
+*/
+const cloudFrontDefaultFields = "date time x-edge-location sc-bytes c-ip cs-method cs(Host) cs-uri-stem sc-status " +
+	"cs(Referer) cs(User-Agent) cs-uri-query cs(Cookie) x-edge-result-type x-edge-request-id x-host-header " +
+	"cs-protocol cs-bytes time-taken x-forwarded-for ssl-protocol ssl-cipher x-edge-response-result-type " +
+	"cs-protocol-version fle-status fle-encrypted-fields c-port time-to-first-byte x-edge-detailed-result-type " +
+	"sc-content-type sc-content-len sc-range-start sc-range-end"
+
+/*
+Fields of CloudFront standard logs mapped onto record fields, CloudFront writes `time-taken` in seconds.
+*/
+var cloudFrontFieldMappings = map[string]fields.FieldMapping{
+	"c-ip":                {Field: fields.HostField},
+	"cs-method":           {Field: fields.MethodField},
+	"cs-uri-stem":         {Field: fields.PathField},
+	"cs-protocol-version": {Field: fields.ProtocolField},
+	"sc-status":           {Field: fields.StatusField},
+	"sc-bytes":            {Field: fields.BytesField},
+	"time-taken":          {Field: fields.DurationField, Unit: time.Second},
+	"cs(referer)":         {Field: fields.RefererField},
+	"cs(user-agent)":      {Field: fields.UserAgentField},
+}
+
+/*
+Creates parser of CloudFront standard logs, that are tab-separated W3C Extended Log File Format with `#Fields` header.
+Parser is the same as `ExtendedLineToStoreRecordParser`, but `time-taken` is parsed in seconds,
+lines before the first `#Fields` directive are parsed with CloudFront standard fields,
+and `#Fields` directive without `x-edge-location`, like the one written by IIS, is rejected.
+
+Attention:
+	- CloudFront URL-encodes values, like `Mozilla/5.0%20(Windows)`, such values are stored as is
+	- `cs-uri-query` is skipped, so path of record has no query string
+*/
+func NewCloudFrontLineToStoreRecordParser(internCacheSize uint) (*ExtendedLineToStoreRecordParser, error) {
+	return newExtendedLineToStoreRecordParser(cloudFrontFieldMappings, "x-edge-location", cloudFrontDefaultFields, internCacheSize)
+}
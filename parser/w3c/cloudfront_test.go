@@ -0,0 +1,43 @@
+package w3c
+
+import (
+	"github.com/storozhukBM/logstat/common/test"
+	"github.com/storozhukBM/logstat/stat"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCloudFrontParsing(t *testing.T) {
+	t.Parallel()
+	parser, parserErr := NewCloudFrontLineToStoreRecordParser(10)
+	test.FailOnError(t, parserErr)
+
+	line := strings.Join([]string{
+		"2019-12-04", "21:02:31", "LAX1", "392", "192.0.2.100", "GET", "d111111abcdef8.cloudfront.net", "/index.html", "200",
+		"-", "Mozilla/5.0%20(Windows%20NT%2010.0)", "-", "-", "Hit", "SOX4xwn4XV6Q4rgb7XiVGOHms_BGlTAC4KyHmureZmBNrjGdRLiNIQ==",
+		"d111111abcdef8.cloudfront.net", "https", "23", "0.001", "-", "TLSv1.2", "ECDHE-RSA-AES128-GCM-SHA256", "Hit",
+		"HTTP/2.0", "-", "-", "11040", "0.001", "Hit", "text/html", "78", "-", "-",
+	}, "\t")
+	expected := stat.Record{
+		UnixTime: 1575493351, Section: "/index.html", StatusCode: 200, ResponseSize: 392, Latency: time.Millisecond,
+		RemoteHost: "192.0.2.100", Method: "GET", Path: "/index.html", Protocol: "HTTP/2.0",
+		Referer: "-", UserAgent: "Mozilla/5.0%20(Windows%20NT%2010.0)",
+	}
+	record, err := parser.Parse([]byte(line))
+	test.FailOnError(t, err)
+	test.Equals(t, expected, record, "record of line with default fields mismatch")
+
+	_, iisFieldsErr := parser.Parse([]byte("#Fields: date time cs-method cs-uri-stem sc-status time-taken"))
+	test.Equals(t, true, iisFieldsErr != nil && iisFieldsErr != stat.ErrNoRecord, "fields without `x-edge-location` should be rejected")
+
+	_, fieldsErr := parser.Parse([]byte("#Fields: date time x-edge-location sc-bytes c-ip cs-method cs-uri-stem sc-status time-taken"))
+	test.Equals(t, stat.ErrNoRecord, fieldsErr, "directive should have no record")
+	record, err = parser.Parse([]byte("2019-12-04\t21:02:32\tLAX1\t100\t192.0.2.100\tPOST\t/api/user\t502\t1.5"))
+	test.FailOnError(t, err)
+	expected = stat.Record{
+		UnixTime: 1575493352, Section: "/api", StatusCode: 502, ResponseSize: 100, Latency: 1500 * time.Millisecond,
+		RemoteHost: "192.0.2.100", Method: "POST", Path: "/api/user",
+	}
+	test.Equals(t, expected, record, "record of line with declared fields mismatch")
+}
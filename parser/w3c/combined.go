@@ -0,0 +1,89 @@
+package w3c
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/storozhukBM/logstat/parser/fields"
+	"github.com/storozhukBM/logstat/stat"
+)
+
+/*
+A component used to parse one line of log in Combined Log Format to storage req record.
+This is Common Log Format with quoted referer and user agent after the body size,
+it is the default format of nginx and a common one for Apache.
+
+Responsibilities:
+	- parse Common Log Format parts the same way as `LineToStoreRecordParser`
+	- parse quoted referer and user agent, quotes and backslashes escaped by `\` are unescaped
+
+Attention:
+	- other escape sequences, like `\x22` written by nginx, are kept as is
+	- referer and user agent are always parsed, `SkipTextParts` skips only text parts of Common Log Format
+*/
+type CombinedLineToStoreRecordParser struct {
+	common                *LineToStoreRecordParser
+	referersInternCache   *fields.InternCache
+	userAgentsInternCache *fields.InternCache
+	unescapeBuf           []byte
+}
+
+func NewCombinedLineToStoreRecordParser(internCacheSize uint) (*CombinedLineToStoreRecordParser, error) {
+	common, commonErr := NewLineToStoreRecordParser(internCacheSize)
+	if commonErr != nil {
+		return nil, commonErr
+	}
+	result := &CombinedLineToStoreRecordParser{
+		common:                common,
+		referersInternCache:   fields.NewInternCache(internCacheSize),
+		userAgentsInternCache: fields.NewInternCache(internCacheSize),
+	}
+	return result, nil
+}
+
+/*
+Makes parser skip host, ident, user, method, path and protocol of records, referer and user agent are still filled.
+*/
+func (p *CombinedLineToStoreRecordParser) SkipTextParts() {
+	p.common.SkipTextParts()
+}
+
+func (p *CombinedLineToStoreRecordParser) Parse(line []byte) (stat.Record, error) {
+	record, bodySizePartEnd, commonErr := p.common.parseCommonParts(line)
+	if commonErr != nil {
+		return stat.Record{}, commonErr
+	}
+	refererPartEnd, referer, refererErr := p.findAndParseQuotedPart(line, bodySizePartEnd, p.referersInternCache)
+	if refererErr != nil {
+		return stat.Record{}, fmt.Errorf("can't parse referer: %v", refererErr)
+	}
+	_, userAgent, userAgentErr := p.findAndParseQuotedPart(line, refererPartEnd, p.userAgentsInternCache)
+	if userAgentErr != nil {
+		return stat.Record{}, fmt.Errorf("can't parse user agent: %v", userAgentErr)
+	}
+	record.Referer = referer
+	record.UserAgent = userAgent
+	return record, nil
+}
+
+func (p *CombinedLineToStoreRecordParser) ParseTime(line []byte) (int64, error) {
+	return p.common.ParseTime(line)
+}
+
+func (p *CombinedLineToStoreRecordParser) findAndParseQuotedPart(
+	line []byte, prevPartEnd int, internCache *fields.InternCache,
+) (int, string, error) {
+	quotedPartStart := prevPartEnd + 2 // skip ` "` before quoted part
+	if quotedPartStart > len(line) || line[quotedPartStart-2] != ' ' || line[quotedPartStart-1] != '"' {
+		return 0, "", fmt.Errorf("enexpected format of line. missed ` \"` before quoted part")
+	}
+	quotedPartEnd := fields.FindClosingQuote(line, quotedPartStart)
+	if quotedPartEnd == -1 {
+		return 0, "", fmt.Errorf("enexpected format of line. can't parse quoted part end")
+	}
+	quotedPart := line[quotedPartStart:quotedPartEnd]
+	if bytes.IndexByte(quotedPart, '\\') != -1 {
+		p.unescapeBuf = fields.AppendUnescaped(p.unescapeBuf[:0], quotedPart)
+		quotedPart = p.unescapeBuf
+	}
+	return quotedPartEnd + 1, internCache.Intern(quotedPart), nil
+}
@@ -0,0 +1,72 @@
+package w3c
+
+import (
+	"github.com/storozhukBM/logstat/common/test"
+	"github.com/storozhukBM/logstat/stat"
+	"testing"
+)
+
+func TestCombinedParsing(t *testing.T) {
+	parserWithCache, parserWithCacheErr := NewCombinedLineToStoreRecordParser(10)
+	test.FailOnError(t, parserWithCacheErr)
+	parserNoCache, parserNoCacheErr := NewCombinedLineToStoreRecordParser(0)
+	test.FailOnError(t, parserNoCacheErr)
+	parserOfSections, parserOfSectionsErr := NewCombinedLineToStoreRecordParser(10)
+	test.FailOnError(t, parserOfSectionsErr)
+	parserOfSections.SkipTextParts()
+
+	cases := []parsingCase{
+		{
+			line: `127.0.0.1 - frank [10/May/2018:01:15:59 +0000] "GET /api/user HTTP/1.1" 200 34 ` +
+				`"http://example.com/start.html" "Mozilla/5.0 (X11; Linux x86_64)"`,
+			result: stat.Record{
+				UnixTime: 1525914959, Section: "/api", StatusCode: 200, ResponseSize: 34,
+				RemoteHost: "127.0.0.1", Ident: "-", AuthUser: "frank", Method: "GET", Path: "/api/user", Protocol: "HTTP/1.1",
+				Referer: "http://example.com/start.html", UserAgent: "Mozilla/5.0 (X11; Linux x86_64)",
+			},
+		},
+		{
+			line: `10.0.0.1 - - [10/May/2018:01:15:59 +0000] "GET /search?q=\"quoted\" HTTP/1.1" 404 - ` +
+				`"-" "agent with \"quotes\" and \\ backslash"`,
+			result: stat.Record{
+				UnixTime: 1525914959, Section: "/search?q=\\\"quoted\\\"", StatusCode: 404, ResponseSize: 0,
+				RemoteHost: "10.0.0.1", Ident: "-", AuthUser: "-", Method: "GET", Path: `/search?q=\"quoted\"`, Protocol: "HTTP/1.1",
+				Referer: "-", UserAgent: `agent with "quotes" and \ backslash`,
+			},
+		},
+		{
+			line: `10.0.0.1 - - [10/May/2018:01:15:59 +0000] "GET / HTTP/1.1" 200 5 "" "curl/7.58.0" "extra"`,
+			result: stat.Record{
+				UnixTime: 1525914959, Section: "/", StatusCode: 200, ResponseSize: 5,
+				RemoteHost: "10.0.0.1", Ident: "-", AuthUser: "-", Method: "GET", Path: "/", Protocol: "HTTP/1.1",
+				Referer: "", UserAgent: "curl/7.58.0",
+			},
+		},
+	}
+
+	for _, parser := range []*CombinedLineToStoreRecordParser{parserWithCache, parserNoCache} {
+		for _, testCase := range cases {
+			actual, err := parser.Parse([]byte(testCase.line))
+			test.FailOnError(t, err)
+			test.Equals(t, testCase.result, actual, "mismatch on: %s", testCase.line)
+		}
+	}
+	for _, testCase := range cases {
+		actual, err := parserOfSections.Parse([]byte(testCase.line))
+		test.FailOnError(t, err)
+		test.Equals(t, withoutTextParts(testCase.result), actual, "mismatch on: %s", testCase.line)
+	}
+
+	invalidLines := []string{
+		`127.0.0.1 - frank [10/May/2018:01:15:59 +0000] "GET /api/user HTTP/1.1" 200 34`,
+		`127.0.0.1 - frank [10/May/2018:01:15:59 +0000] "GET /api/user HTTP/1.1" 200 34 "referer"`,
+		`127.0.0.1 - frank [10/May/2018:01:15:59 +0000] "GET /api/user HTTP/1.1" 200 34 "referer" "agent`,
+		`127.0.0.1 - frank [10/May/2018:01:15:59 +0000] "GET /api/user HTTP/1.1" 200 34 "agent \"`,
+	}
+	for _, line := range invalidLines {
+		_, err := parserWithCache.Parse([]byte(line))
+		test.Equals(t, true, err != nil, "line should be rejected: %v", line)
+		_, err = parserOfSections.Parse([]byte(line))
+		test.Equals(t, true, err != nil, "line should be rejected without text parts: %v", line)
+	}
+}
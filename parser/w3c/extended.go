@@ -0,0 +1,311 @@
+package w3c
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/storozhukBM/logstat/parser/fields"
+	"github.com/storozhukBM/logstat/stat"
+	"strings"
+	"time"
+)
+
+const extendedDateLayout = "2006-01-02"
+
+/*
+Well-known fields of W3C Extended Log File Format mapped onto record fields.
+Names are lower-cased, because IIS writes prefixed headers like `cs(User-Agent)`.
+*/
+var extendedFieldMappings = map[string]fields.FieldMapping{
+	"c-ip":           {Field: fields.HostField},
+	"cs-username":    {Field: fields.UserField},
+	"cs-method":      {Field: fields.MethodField},
+	"cs-uri-stem":    {Field: fields.PathField},
+	"cs-uri":         {Field: fields.PathField},
+	"cs-version":     {Field: fields.ProtocolField},
+	"sc-status":      {Field: fields.StatusField},
+	"sc-bytes":       {Field: fields.BytesField},
+	"time-taken":     {Field: fields.DurationField, Unit: time.Millisecond},
+	"cs(referer)":    {Field: fields.RefererField},
+	"cs(user-agent)": {Field: fields.UserAgentField},
+}
+
+type extendedColumnKind int
+
+const (
+	ignoredColumn extendedColumnKind = iota
+	dateColumn
+	timeColumn
+	mappedColumn
+)
+
+type extendedColumn struct {
+	name    string
+	kind    extendedColumnKind
+	mapping fields.FieldMapping
+}
+
+/*
+A component used to parse one line of log written in W3C Extended Log File Format, like IIS logs,
+to storage req record. Columns of lines are declared by `#Fields` directive, that can be repeated
+in the middle of file, so parser rebuilds its column mapping every time it sees this directive.
+
+Responsibilities:
+	- read `#Fields` and `#Date` directives and skip all other directives, like `#Software` or `#Version`
+	- map well-known columns onto record fields:
+		`date`, `time`, `c-ip`, `cs-username`, `cs-method`, `cs-uri-stem` or `cs-uri`, `cs-version`,
+		`sc-status`, `sc-bytes`, `time-taken`, `cs(Referer)`, `cs(User-Agent)`
+	- skip all other columns, like `s-ip` or `cs-uri-query`
+	- copy required parts of line bytes to separate strings, so line bytes can be recycled and reused afterward
+
+Attention:
+	- directive lines return `stat.ErrNoRecord`, so they are skipped without errors
+	- lines before the first `#Fields` directive are parsed with default fields passed to constructor
+	- `time` column is required, date is taken from `#Date` directive if there is no `date` column
+	- times are in UTC, as required by the format, `time-taken` is in milliseconds, as written by IIS
+	- `-` marks empty value, it is stored as is, but numbers are parsed as zero
+	- IIS replaces spaces in values with `+`, like in `Mozilla/5.0+(Windows+NT+10.0)`, such values are stored as is
+*/
+type ExtendedLineToStoreRecordParser struct {
+	fieldMappings map[string]fields.FieldMapping
+	requiredField string
+	columns       []extendedColumn
+	columnsErr    error
+	directiveDate []byte
+	builder       *fields.RecordBuilder
+
+	cachedDate     []byte
+	cachedDayStart int64
+}
+
+/*
+Creates parser with `defaultFields` used till the first `#Fields` directive, like `date time cs-method cs-uri-stem`,
+they can be empty, so lines before the first directive are rejected.
+`internCacheSize` limits size of each cache of interned text parts.
+*/
+func NewExtendedLineToStoreRecordParser(defaultFields string, internCacheSize uint) (*ExtendedLineToStoreRecordParser, error) {
+	return newExtendedLineToStoreRecordParser(extendedFieldMappings, "", defaultFields, internCacheSize)
+}
+
+func newExtendedLineToStoreRecordParser(
+	fieldMappings map[string]fields.FieldMapping, requiredField string, defaultFields string, internCacheSize uint,
+) (*ExtendedLineToStoreRecordParser, error) {
+	result := &ExtendedLineToStoreRecordParser{
+		fieldMappings: fieldMappings,
+		requiredField: requiredField,
+		columnsErr:    fmt.Errorf("fields aren't declared by `#Fields` directive"),
+		builder:       fields.NewRecordBuilder(internCacheSize),
+	}
+	if strings.TrimSpace(defaultFields) != "" {
+		columns, columnsErr := compileColumns(fieldMappings, requiredField, defaultFields)
+		if columnsErr != nil {
+			return nil, fmt.Errorf("can't compile default fields `%v`: %v", defaultFields, columnsErr)
+		}
+		result.columns, result.columnsErr = columns, nil
+	}
+	return result, nil
+}
+
+func (p *ExtendedLineToStoreRecordParser) Parse(line []byte) (stat.Record, error) {
+	if len(line) > 0 && line[0] == '#' {
+		return stat.Record{}, p.readDirective(line)
+	}
+	if p.columnsErr != nil {
+		return stat.Record{}, p.columnsErr
+	}
+	record := stat.Record{}
+	scanErr := p.scanLine(line, &record, false)
+	if scanErr != nil {
+		return stat.Record{}, scanErr
+	}
+	return record, nil
+}
+
+/*
+Parses only time of the line, other columns are skipped. Directives are read the same way as by `Parse`.
+*/
+func (p *ExtendedLineToStoreRecordParser) ParseTime(line []byte) (int64, error) {
+	if len(line) > 0 && line[0] == '#' {
+		return 0, p.readDirective(line)
+	}
+	if p.columnsErr != nil {
+		return 0, p.columnsErr
+	}
+	record := stat.Record{}
+	scanErr := p.scanLine(line, &record, true)
+	if scanErr != nil {
+		return 0, scanErr
+	}
+	return record.UnixTime, nil
+}
+
+/*
+Reads directive line, returns `stat.ErrNoRecord` if directive is valid.
+Invalid `#Fields` directive makes parser reject lines till the next valid one,
+because columns of these lines are unknown.
+*/
+func (p *ExtendedLineToStoreRecordParser) readDirective(line []byte) error {
+	nameEnd := bytes.IndexByte(line, ':')
+	if nameEnd == -1 {
+		return stat.ErrNoRecord
+	}
+	value := bytes.TrimSpace(line[nameEnd+1:])
+	switch string(line[1:nameEnd]) {
+	case "Fields":
+		columns, columnsErr := compileColumns(p.fieldMappings, p.requiredField, string(value))
+		if columnsErr != nil {
+			p.columns = nil
+			p.columnsErr = fmt.Errorf("fields of `%s` directive are invalid: %v", line, columnsErr)
+			return p.columnsErr
+		}
+		p.columns, p.columnsErr = columns, nil
+	case "Date":
+		if len(value) < len(extendedDateLayout) {
+			return fmt.Errorf("enexpected format of line. can't find date in `%s` directive", line)
+		}
+		p.directiveDate = append(p.directiveDate[:0], value[:len(extendedDateLayout)]...)
+	}
+	return stat.ErrNoRecord
+}
+
+/*
+Compiles columns of `#Fields` directive, `requiredField`, if any, should be declared by directive.
+*/
+func compileColumns(
+	fieldMappings map[string]fields.FieldMapping, requiredField string, fieldsDirective string,
+) ([]extendedColumn, error) {
+	names := strings.Fields(fieldsDirective)
+	var result []extendedColumn
+	hasTime := false
+	hasFullURI := false
+	hasRequiredField := requiredField == ""
+	for _, name := range names {
+		lowerName := strings.ToLower(name)
+		hasRequiredField = hasRequiredField || lowerName == requiredField
+		column := extendedColumn{name: name}
+		switch lowerName {
+		case "date":
+			column.kind = dateColumn
+		case "time":
+			column.kind = timeColumn
+			hasTime = true
+		default:
+			mapping, ok := fieldMappings[lowerName]
+			if ok {
+				column.kind = mappedColumn
+				column.mapping = mapping
+				column.mapping.Key = name
+			}
+			hasFullURI = hasFullURI || lowerName == "cs-uri"
+		}
+		result = append(result, column)
+	}
+	if !hasTime {
+		return nil, fmt.Errorf("`time` field is required")
+	}
+	if !hasRequiredField {
+		return nil, fmt.Errorf("`%v` field is required", requiredField)
+	}
+	if hasFullURI {
+		// `cs-uri` already contains stem, so stem would only override it without query
+		for i := range result {
+			if strings.ToLower(result[i].name) == "cs-uri-stem" {
+				result[i].kind = ignoredColumn
+			}
+		}
+	}
+	return result, nil
+}
+
+func (p *ExtendedLineToStoreRecordParser) scanLine(line []byte, record *stat.Record, onlyTime bool) error {
+	var datePart, timePart []byte
+	idx := 0
+	for i := range p.columns {
+		column := &p.columns[i]
+		idx = skipExtendedSeparators(line, idx)
+		if idx >= len(line) {
+			return fmt.Errorf("enexpected format of line. can't find value of `%v`", column.name)
+		}
+		valuePart, valueEnd, valueErr := scanExtendedValue(line, idx)
+		if valueErr != nil {
+			return fmt.Errorf("can't find value of `%v`: %v", column.name, valueErr)
+		}
+		switch {
+		case column.kind == dateColumn:
+			datePart = valuePart
+		case column.kind == timeColumn:
+			timePart = valuePart
+		case column.kind == mappedColumn && !onlyTime:
+			setErr := p.builder.Set(record, &column.mapping, valuePart, false)
+			if setErr != nil {
+				return fmt.Errorf("can't parse `%v`: %v", column.name, setErr)
+			}
+		}
+		idx = valueEnd
+	}
+	if skipExtendedSeparators(line, idx) != len(line) {
+		return fmt.Errorf("enexpected format of line. line has more values than declared fields")
+	}
+	if datePart == nil {
+		if len(p.directiveDate) == 0 {
+			return fmt.Errorf("enexpected format of line. date is absent in fields and `#Date` directive")
+		}
+		datePart = p.directiveDate
+	}
+	unixTime, timeErr := p.parseTime(datePart, timePart)
+	if timeErr != nil {
+		return fmt.Errorf("can't parse time: %v", timeErr)
+	}
+	record.UnixTime = unixTime
+	return nil
+}
+
+/*
+Parses date, like `2018-05-10`, and time, like `01:15:59` or `01:15:59.123`.
+Start of the day is cached, so only time is parsed for lines of the same day.
+*/
+func (p *ExtendedLineToStoreRecordParser) parseTime(datePart []byte, timePart []byte) (int64, error) {
+	if !bytes.Equal(datePart, p.cachedDate) {
+		day, parsingErr := time.ParseInLocation(extendedDateLayout, string(datePart), time.UTC)
+		if parsingErr != nil {
+			return 0, parsingErr
+		}
+		p.cachedDate = append(p.cachedDate[:0], datePart...)
+		p.cachedDayStart = day.Unix()
+	}
+	if len(timePart) < 8 || timePart[2] != ':' || timePart[5] != ':' || (len(timePart) > 8 && timePart[8] != '.') {
+		return 0, fmt.Errorf("enexpected format of time: `%s`", timePart)
+	}
+	hours, hoursErr := fields.ParseInt(timePart[0:2])
+	minutes, minutesErr := fields.ParseInt(timePart[3:5])
+	seconds, secondsErr := fields.ParseInt(timePart[6:8])
+	if hoursErr != nil || minutesErr != nil || secondsErr != nil || hours > 23 || minutes > 59 || seconds > 60 {
+		return 0, fmt.Errorf("enexpected format of time: `%s`", timePart)
+	}
+	return p.cachedDayStart + hours*3600 + minutes*60 + seconds, nil
+}
+
+/*
+Scans value that starts at `valueStart`, quoted values are returned without quotes.
+*/
+func scanExtendedValue(line []byte, valueStart int) ([]byte, int, error) {
+	if line[valueStart] != '"' {
+		valueEnd := valueStart
+		for valueEnd < len(line) && line[valueEnd] != ' ' && line[valueEnd] != '\t' {
+			valueEnd++
+		}
+		return line[valueStart:valueEnd], valueEnd, nil
+	}
+	quoteEnd := bytes.IndexByte(line[valueStart+1:], '"')
+	if quoteEnd == -1 {
+		return nil, 0, fmt.Errorf("enexpected format of line. quoted value isn't closed")
+	}
+	quoteEnd += valueStart + 1 // quoteEnd is relative to the start of quoted content
+	return line[valueStart+1 : quoteEnd], quoteEnd + 1, nil
+}
+
+func skipExtendedSeparators(line []byte, idx int) int {
+	for idx < len(line) && (line[idx] == ' ' || line[idx] == '\t') {
+		idx++
+	}
+	return idx
+}
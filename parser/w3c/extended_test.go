@@ -0,0 +1,113 @@
+package w3c
+
+import (
+	"github.com/storozhukBM/logstat/common/test"
+	"github.com/storozhukBM/logstat/stat"
+	"testing"
+	"time"
+)
+
+func TestExtendedParsing(t *testing.T) {
+	t.Parallel()
+	parser, parserErr := NewExtendedLineToStoreRecordParser("", 10)
+	test.FailOnError(t, parserErr)
+
+	lines := []string{
+		`#Software: Microsoft Internet Information Services 10.0`,
+		`#Version: 1.0`,
+		`#Date: 2018-05-10 01:00:00`,
+		`#Fields: date time s-ip cs-method cs-uri-stem cs-uri-query s-port cs-username c-ip cs(User-Agent) cs(Referer) sc-status sc-substatus sc-win32-status time-taken`,
+		`2018-05-10 01:15:59 10.0.0.1 GET /api/user id=1 443 - 192.168.1.5 Mozilla/5.0+(Windows+NT+10.0) - 200 0 0 15`,
+		`#Fields: time cs-method cs-uri sc-status sc-bytes time-taken`,
+		`01:16:00 POST /report/daily?x=1 500 1024 7`,
+	}
+	expected := []stat.Record{
+		{
+			UnixTime: 1525914959, Section: "/api", StatusCode: 200, Latency: 15 * time.Millisecond,
+			RemoteHost: "192.168.1.5", AuthUser: "-", Method: "GET", Path: "/api/user",
+			Referer: "-", UserAgent: "Mozilla/5.0+(Windows+NT+10.0)",
+		},
+		{
+			UnixTime: 1525914960, Section: "/report", StatusCode: 500, ResponseSize: 1024, Latency: 7 * time.Millisecond,
+			Method: "POST", Path: "/report/daily?x=1",
+		},
+	}
+	var records []stat.Record
+	for _, line := range lines {
+		record, err := parser.Parse([]byte(line))
+		if err == stat.ErrNoRecord {
+			continue
+		}
+		test.FailOnError(t, err)
+		records = append(records, record)
+	}
+	test.Equals(t, expected, records, "records mismatch")
+}
+
+func TestExtendedParsingWithDefaultFields(t *testing.T) {
+	t.Parallel()
+	parser, parserErr := NewExtendedLineToStoreRecordParser("date time cs-method cs-uri-stem sc-status", 0)
+	test.FailOnError(t, parserErr)
+
+	record, err := parser.Parse([]byte(`2018-05-10 01:15:59 GET /api/user 200`))
+	test.FailOnError(t, err)
+	test.Equals(t, stat.Record{UnixTime: 1525914959, Section: "/api", Method: "GET", Path: "/api/user", StatusCode: 200}, record, "record mismatch")
+
+	_, noTimeErr := NewExtendedLineToStoreRecordParser("date cs-method", 0)
+	test.Equals(t, true, noTimeErr != nil, "default fields without time should be rejected")
+}
+
+func TestExtendedParsingErrors(t *testing.T) {
+	t.Parallel()
+	parser, parserErr := NewExtendedLineToStoreRecordParser("", 10)
+	test.FailOnError(t, parserErr)
+
+	_, noFieldsErr := parser.Parse([]byte(`2018-05-10 01:15:59 GET /api/user 200`))
+	test.Equals(t, true, noFieldsErr != nil && noFieldsErr != stat.ErrNoRecord, "line before `#Fields` should be rejected")
+
+	_, fieldsErr := parser.Parse([]byte(`#Fields: time cs-method cs-uri-stem sc-status`))
+	test.Equals(t, stat.ErrNoRecord, fieldsErr, "directive should have no record")
+	lines := []string{
+		``,
+		`01:15:59 GET /api/user 200`,
+	}
+	for _, line := range lines {
+		_, err := parser.Parse([]byte(line))
+		test.Equals(t, true, err != nil, "line without date should be rejected: %v", line)
+	}
+
+	_, dateErr := parser.Parse([]byte(`#Date: 2018-05-10 01:00:00`))
+	test.Equals(t, stat.ErrNoRecord, dateErr, "directive should have no record")
+	lines = []string{
+		``,
+		`01:15:59 GET /api/user`,
+		`01:15:59 GET /api/user 200 extra`,
+		`01:15 GET /api/user 200`,
+		`01:15:59 GET /api/user x`,
+		`01:15:59 GET api 200`,
+	}
+	for _, line := range lines {
+		_, err := parser.Parse([]byte(line))
+		test.Equals(t, true, err != nil, "line should be rejected: %v", line)
+	}
+
+	_, invalidFieldsErr := parser.Parse([]byte(`#Fields: date cs-method`))
+	test.Equals(t, true, invalidFieldsErr != nil && invalidFieldsErr != stat.ErrNoRecord, "fields without time should be rejected")
+	_, err := parser.Parse([]byte(`01:15:59 GET /api/user 200`))
+	test.Equals(t, true, err != nil, "line after invalid `#Fields` should be rejected")
+}
+
+func TestExtendedTimeParsing(t *testing.T) {
+	t.Parallel()
+	parser, parserErr := NewExtendedLineToStoreRecordParser("date time cs-uri-stem", 0)
+	test.FailOnError(t, parserErr)
+
+	unixTime, timeErr := parser.ParseTime([]byte(`2018-05-10 01:15:59.123 not-a-path`))
+	test.FailOnError(t, timeErr)
+	test.Equals(t, int64(1525914959), unixTime, "time mismatch")
+
+	_, fieldsErr := parser.ParseTime([]byte(`#Fields: time cs-uri-stem`))
+	test.Equals(t, stat.ErrNoRecord, fieldsErr, "directive should have no record")
+	_, noDateErr := parser.ParseTime([]byte(`01:15:59 /api`))
+	test.Equals(t, true, noDateErr != nil, "line without date should be rejected")
+}
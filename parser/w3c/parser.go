@@ -3,11 +3,8 @@ package w3c
 import (
 	"bytes"
 	"fmt"
+	"github.com/storozhukBM/logstat/parser/fields"
 	"github.com/storozhukBM/logstat/stat"
-	"hash"
-	"hash/fnv"
-	"time"
-	"unsafe"
 )
 
 /*
@@ -17,14 +14,17 @@ that is accelerated using vectorized instructions.
 Under load in hot path this parser should work with almost zero allocations.
 
 Responsibilities:
-	- parse logline to req record
+	- parse logline in Common Log Format to req record with all its parts
 	- copy required parts of line bytes to separate storage or structure,
 	so line bytes can be recycled and reused afterward
 
 Attention:
-	- sections string are cached in `sectionPartsInternCache` to avoid allocations,
+	- sections are interned by `fields.InternCache` to avoid allocations,
 	but we enforce certain cache size as protection from memory leaks. This should work OK,
 	because in typical server log there is a fixed amount of sections
+	- host, ident, user, method, path and protocol are interned the same way, but paths with IDs or query strings
+	and hosts can have too many distinct values, so their caches are often cleared. If these parts aren't needed,
+	they can be skipped by `SkipTextParts` to keep the hot path fast
 
 Future:
 	- this implementation require fuzz testing in future
@@ -32,51 +32,119 @@ Future:
 	elimination of unnecessary bounds checks. Use `go build -gcflags '-m -m -d=ssa/check_bce/debug=1' ./...` for details.
 */
 type LineToStoreRecordParser struct {
-	sectionInternCacheSize  int
-	stringInternHash        hash.Hash32
-	sectionPartsInternCache map[uint32]string
+	sectionInternCacheSize int
+	sectionsInternCache    *fields.InternCache
+	skipTextParts          bool
+	// other text parts have their own caches, so parts with many distinct values, like paths, don't evict the rest
+	hostsInternCache     *fields.InternCache
+	usersInternCache     *fields.InternCache
+	methodsInternCache   *fields.InternCache
+	pathsInternCache     *fields.InternCache
+	protocolsInternCache *fields.InternCache
 
-	lastFullyParsedTimePart                  []byte
-	lastFullyParsedTimeStartOfTheDayUnixTime int64
+	timeParser fields.CommonLogTimeParser
 }
 
+/*
+Creates parser, `sectionInternCacheSize` limits size of each cache of interned text parts, like sections or paths.
+*/
 func NewLineToStoreRecordParser(sectionInternCacheSize uint) (*LineToStoreRecordParser, error) {
 	result := &LineToStoreRecordParser{
-		sectionInternCacheSize:  int(sectionInternCacheSize),
-		stringInternHash:        fnv.New32a(),
-		sectionPartsInternCache: make(map[uint32]string),
+		sectionInternCacheSize: int(sectionInternCacheSize),
+		sectionsInternCache:    fields.NewInternCache(sectionInternCacheSize),
+		hostsInternCache:       fields.NewInternCache(sectionInternCacheSize),
+		usersInternCache:       fields.NewInternCache(sectionInternCacheSize),
+		methodsInternCache:     fields.NewInternCache(sectionInternCacheSize),
+		pathsInternCache:       fields.NewInternCache(sectionInternCacheSize),
+		protocolsInternCache:   fields.NewInternCache(sectionInternCacheSize),
 	}
 	return result, nil
 }
 
+/*
+Makes parser fill only section of records, host, ident, user, method, path and protocol are left empty.
+Useful when these parts aren't needed after parsing, because their interning is the most costly part of parsing.
+*/
+func (p *LineToStoreRecordParser) SkipTextParts() {
+	p.skipTextParts = true
+}
+
+/*
+Parses Common Log Format record: `host ident authuser [date] "method path protocol" status bytes`.
+Absent parts, like `-` ident or user, are stored as is, but `-` bytes are parsed as zero.
+*/
 func (p *LineToStoreRecordParser) Parse(line []byte) (stat.Record, error) {
-	timePartStart, prefixErr := p.skipPrefix(line)
+	record, bodySizePartEnd, err := p.parseCommonParts(line)
+	if err != nil {
+		return stat.Record{}, err
+	}
+	if bodySizePartEnd != len(line) {
+		return stat.Record{}, fmt.Errorf("enexpected format of line. unexpected parts after body size")
+	}
+	return record, nil
+}
+
+/*
+Parses parts of Common Log Format, returns the end of body size part, so other formats can parse the rest of line.
+Body size ends at the first space, so the end of line isn't checked here.
+*/
+func (p *LineToStoreRecordParser) parseCommonParts(line []byte) (stat.Record, int, error) {
+	timePartStart, host, ident, authUser, prefixErr := p.findAndParsePrefixParts(line)
 	if prefixErr != nil {
-		return stat.Record{}, fmt.Errorf("can't skip prefix: %v", prefixErr)
+		return stat.Record{}, 0, fmt.Errorf("can't parse prefix: %v", prefixErr)
 	}
 	timePartEnd, unixTime, timeParsingErr := p.findAndParseTimePart(line, timePartStart)
 	if timeParsingErr != nil {
-		return stat.Record{}, fmt.Errorf("can't parse time: %v", timeParsingErr)
+		return stat.Record{}, 0, fmt.Errorf("can't parse time: %v", timeParsingErr)
 	}
-	sectionPartEnd, sectionPartStr, sectionParsingErr := p.findAndParseSectionPart(line, timePartEnd)
-	if sectionParsingErr != nil {
-		return stat.Record{}, fmt.Errorf("can't parse section: %v", sectionParsingErr)
+	requestPartEnd, request, requestParsingErr := p.findAndParseRequestPart(line, timePartEnd)
+	if requestParsingErr != nil {
+		return stat.Record{}, 0, fmt.Errorf("can't parse request: %v", requestParsingErr)
 	}
-	statusCodePartEnd, statusCode, statusCodeParsingErr := p.findAndParseStatusCodePart(line, sectionPartEnd)
+	statusCodePartEnd, statusCode, statusCodeParsingErr := p.findAndParseStatusCodePart(line, requestPartEnd)
 	if statusCodeParsingErr != nil {
-		return stat.Record{}, fmt.Errorf("can't parse status code: %v", statusCodeParsingErr)
+		return stat.Record{}, 0, fmt.Errorf("can't parse status code: %v", statusCodeParsingErr)
 	}
-	bodySize, bodySizeParsingErr := p.findAndParseBodySize(line, statusCodePartEnd)
+	bodySizePartEnd, bodySize, bodySizeParsingErr := p.findAndParseBodySize(line, statusCodePartEnd)
 	if bodySizeParsingErr != nil {
-		return stat.Record{}, fmt.Errorf("can't parse body size: %v", bodySizeParsingErr)
+		return stat.Record{}, 0, fmt.Errorf("can't parse body size: %v", bodySizeParsingErr)
 	}
 
 	return stat.Record{
 		UnixTime:     unixTime,
-		Section:      sectionPartStr,
+		RemoteHost:   host,
+		Ident:        ident,
+		AuthUser:     authUser,
+		Method:       request.method,
+		Path:         request.path,
+		Protocol:     request.protocol,
+		Section:      request.section,
 		StatusCode:   statusCode,
 		ResponseSize: bodySize,
-	}, nil
+	}, bodySizePartEnd, nil
+}
+
+type requestParts struct {
+	method   string
+	path     string
+	protocol string
+	section  string
+}
+
+/*
+Parses only time of the line, that is much cheaper than the whole line parsing.
+Can be used to find lines by their time.
+*/
+func (p *LineToStoreRecordParser) ParseTime(line []byte) (int64, error) {
+	timePartStart, prefixErr := p.skipPrefix(line)
+	if prefixErr != nil {
+		return 0, fmt.Errorf("can't skip prefix: %v", prefixErr)
+	}
+	_, unixTime, timeParsingErr := p.findAndParseTimePart(line, timePartStart)
+	if timeParsingErr != nil {
+		return 0, fmt.Errorf("can't parse time: %v", timeParsingErr)
+	}
+	return unixTime, nil
 }
 
 func (p *LineToStoreRecordParser) skipPrefix(line []byte) (int, error) {
@@ -97,72 +165,101 @@ func (p *LineToStoreRecordParser) findAndParseTimePart(line []byte, timePartStar
 		return 0, 0, fmt.Errorf("enexpected format of line. can't parse time part end")
 	}
 	timePartEnd = timePartStart + timePartEnd // timePartEnd is relative to timePartStart
-	timePart := line[timePartStart:timePartEnd]
-
-	unixTime, timeParseErr := p.parseTimePart(timePart)
+	unixTime, timeParseErr := p.timeParser.Parse(line[timePartStart:timePartEnd])
 	if timeParseErr != nil {
 		return 0, 0, timeParseErr
 	}
 	return timePartEnd, unixTime, nil
 }
 
-func (p *LineToStoreRecordParser) findAndParseSectionPart(line []byte, timePartEnd int) (int, string, error) {
-	sectionPartStart := bytes.IndexByte(line[timePartEnd:], '/')
-	if sectionPartStart == -1 {
-		return 0, "", fmt.Errorf("enexpected format of line. can't parse section part")
+func (p *LineToStoreRecordParser) findAndParsePrefixParts(line []byte) (int, string, string, string, error) {
+	hostPartEnd := bytes.IndexByte(line, ' ')
+	if hostPartEnd == -1 {
+		return 0, "", "", "", fmt.Errorf("enexpected format of line. can't parse host part end")
 	}
-	sectionPartStart = timePartEnd + sectionPartStart // sectionPartStart is relative to timePartEnd
-
-	sectionPartEnd := bytes.IndexByte(line[sectionPartStart:], ' ')
-	if sectionPartEnd == -1 {
-		return 0, "", fmt.Errorf("enexpected format of line. can't parse section part end")
+	identPartStart := hostPartEnd + 1
+	identPartEnd := bytes.IndexByte(line[identPartStart:], ' ')
+	if identPartEnd == -1 {
+		return 0, "", "", "", fmt.Errorf("enexpected format of line. can't parse ident part end")
 	}
-	sectionPartEnd = sectionPartStart + sectionPartEnd // sectionPartEnd is relative to sectionPartStart
-
-	sectionPart := line[sectionPartStart:sectionPartEnd]
-	subSectionEnd := bytes.IndexByte(sectionPart[1:], '/')
-	if subSectionEnd != -1 {
-		sectionPart = sectionPart[0 : subSectionEnd+1]
+	identPartEnd = identPartStart + identPartEnd // identPartEnd is relative to identPartStart
+	authUserPartStart := identPartEnd + 1
+	authUserPartEnd := bytes.IndexByte(line[authUserPartStart:], ' ')
+	if authUserPartEnd == -1 || authUserPartStart+authUserPartEnd+1 == len(line) {
+		return 0, "", "", "", fmt.Errorf("enexpected format of line. can't parse auth user part end")
+	}
+	authUserPartEnd = authUserPartStart + authUserPartEnd // authUserPartEnd is relative to authUserPartStart
+	if p.skipTextParts {
+		return authUserPartEnd + 1, "", "", "", nil
 	}
-	sectionPartStr := p.internSectionString(sectionPart)
-	return sectionPartEnd, sectionPartStr, nil
+
+	host := p.hostsInternCache.Intern(line[:hostPartEnd])
+	ident := p.usersInternCache.Intern(line[identPartStart:identPartEnd])
+	authUser := p.usersInternCache.Intern(line[authUserPartStart:authUserPartEnd])
+	return authUserPartEnd + 1, host, ident, authUser, nil
 }
 
-func (p *LineToStoreRecordParser) findAndParseStatusCodePart(line []byte, sectionPartEnd int) (int, int32, error) {
-	sectionPartEnd = sectionPartEnd + 1 // skip ` ` from time protocol part
-	if sectionPartEnd >= len(line) {
-		return 0, 0, fmt.Errorf("enexpected format of line. missed ` ` in protocol part")
+func (p *LineToStoreRecordParser) findAndParseRequestPart(line []byte, timePartEnd int) (int, requestParts, error) {
+	requestPartStart := bytes.IndexByte(line[timePartEnd:], '"')
+	if requestPartStart == -1 {
+		return 0, requestParts{}, fmt.Errorf("enexpected format of line. can't parse request part start")
 	}
-	statusCodePartStart := bytes.IndexByte(line[sectionPartEnd:], ' ')
-	if statusCodePartStart == -1 {
-		return 0, 0, fmt.Errorf("enexpected format of line. can't parse status code start")
+	requestPartStart = timePartEnd + requestPartStart + 1 // skip `"` and make it relative to line
+	requestPartEnd := fields.FindClosingQuote(line, requestPartStart)
+	if requestPartEnd == -1 {
+		return 0, requestParts{}, fmt.Errorf("enexpected format of line. can't parse request part end")
 	}
-	statusCodePartStart = sectionPartEnd + statusCodePartStart // statusCodePartStart is relative to sectionPartEnd
+	requestPart := line[requestPartStart:requestPartEnd]
 
-	statusCodePartStart = statusCodePartStart + 1 // skip ` ` from time protocol part
+	methodPart, pathPart, protocolPart, splitErr := fields.SplitRequest(requestPart)
+	if splitErr != nil {
+		return 0, requestParts{}, splitErr
+	}
+	sectionPart, sectionErr := fields.SectionOf(pathPart)
+	if sectionErr != nil {
+		return 0, requestParts{}, sectionErr
+	}
+
+	if p.skipTextParts {
+		return requestPartEnd, requestParts{section: p.sectionsInternCache.Intern(sectionPart)}, nil
+	}
+	return requestPartEnd, requestParts{
+		method:   p.methodsInternCache.Intern(methodPart),
+		path:     p.pathsInternCache.Intern(pathPart),
+		protocol: p.protocolsInternCache.Intern(protocolPart),
+		section:  p.sectionsInternCache.Intern(sectionPart),
+	}, nil
+}
+
+func (p *LineToStoreRecordParser) findAndParseStatusCodePart(line []byte, requestPartEnd int) (int, int32, error) {
+	statusCodePartStart := requestPartEnd + 2 // skip `" ` after request part
 	statusCodePartEnd := statusCodePartStart + 3  // status code should take 3 chars
 	if statusCodePartEnd >= len(line) {
 		return 0, 0, fmt.Errorf("enexpected format of line. staus code part is cropped")
 	}
 	statusCodePart := line[statusCodePartStart:statusCodePartEnd]
-	statusCode, statusCodeParsingErr := p.parseInt64(statusCodePart)
+	statusCode, statusCodeParsingErr := fields.ParseInt(statusCodePart)
 	if statusCodeParsingErr != nil {
 		return 0, 0, statusCodeParsingErr
 	}
 	return statusCodePartEnd, int32(statusCode), nil
 }
 
-func (p *LineToStoreRecordParser) findAndParseBodySize(line []byte, statusCodePartEnd int) (int64, error) {
+func (p *LineToStoreRecordParser) findAndParseBodySize(line []byte, statusCodePartEnd int) (int, int64, error) {
 	bodySizePartStart := statusCodePartEnd + 1 // skip ` ` from time body size part
 	if bodySizePartStart >= len(line) {
-		return 0, fmt.Errorf("enexpected format of line. missed ` ` in body size part")
+		return 0, 0, fmt.Errorf("enexpected format of line. missed ` ` in body size part")
+	}
+	bodySizePartEnd := len(line)
+	if spaceIdx := bytes.IndexByte(line[bodySizePartStart:], ' '); spaceIdx != -1 {
+		bodySizePartEnd = bodySizePartStart + spaceIdx // spaceIdx is relative to bodySizePartStart
 	}
-	bodySizePart := line[bodySizePartStart:]
-	bodySize, bodySizeParsingErr := p.parseInt64(bodySizePart)
+	// `-` means that nothing was sent
+	bodySize, bodySizeParsingErr := fields.ParseIntOrDash(line[bodySizePartStart:bodySizePartEnd])
 	if bodySizeParsingErr != nil {
-		return 0, bodySizeParsingErr
+		return 0, 0, bodySizeParsingErr
 	}
-	return bodySize, nil
+	return bodySizePartEnd, bodySize, nil
 }
 
 func (p *LineToStoreRecordParser) skip(line []byte, separator byte, n int) int {
@@ -178,104 +275,3 @@ func (p *LineToStoreRecordParser) skip(line []byte, separator byte, n int) int {
 	}
 	return len(line) - len(target)
 }
-
-/*
-Time parser with cache to avoid parsing date and timezone.
-*/
-func (p *LineToStoreRecordParser) parseTimePart(timePart []byte) (int64, error) {
-	if p.lastFullyParsedTimePart == nil {
-		return p.regularTimeParse(timePart)
-	}
-
-	{
-		cacheZonePart := p.lastFullyParsedTimePart[len(p.lastFullyParsedTimePart)-5:]
-		targetZonePart := timePart[len(timePart)-5:]
-		if !bytes.Equal(cacheZonePart, targetZonePart) {
-			return p.regularTimeParse(timePart)
-		}
-	}
-
-	{
-		cacheDatePart := p.lastFullyParsedTimePart[:len(p.lastFullyParsedTimePart)-15]
-		targetDatePart := timePart[:len(timePart)-15]
-		if !bytes.Equal(cacheDatePart, targetDatePart) {
-			return p.regularTimeParse(timePart)
-		}
-	}
-	targetHourPart := timePart[len(timePart)-14 : len(timePart)-12]
-	targetMinutePart := timePart[len(timePart)-11 : len(timePart)-9]
-	targetSecondPart := timePart[len(timePart)-8 : len(timePart)-6]
-
-	hour, hourErr := p.parseInt64(targetHourPart)
-	if hourErr != nil {
-		return 0, hourErr
-	}
-	minute, minuteErr := p.parseInt64(targetMinutePart)
-	if minuteErr != nil {
-		return 0, minuteErr
-	}
-	second, secondErr := p.parseInt64(targetSecondPart)
-	if secondErr != nil {
-		return 0, secondErr
-	}
-
-	secondOfDayUnixTime := (hour * 3600) + (minute * 60) + second
-	return p.lastFullyParsedTimeStartOfTheDayUnixTime + secondOfDayUnixTime, nil
-}
-
-/*
-This parser is really slow (due to generalized layout) [determined by profiling via pprof].
-So we use it only to parse date and timezone and cache results.
-We parse using time.UTC zone to avoid allocations of *time.Location
-*/
-func (p *LineToStoreRecordParser) regularTimeParse(timePart []byte) (int64, error) {
-	timePartStr := *(*string)(unsafe.Pointer(&timePart)) // bytes to string without potential allocation
-	t, parsingErr := time.ParseInLocation("02/Jan/2006:15:04:05 -0700", timePartStr, time.UTC)
-	if parsingErr != nil {
-		return 0, parsingErr
-	}
-	p.lastFullyParsedTimeStartOfTheDayUnixTime = time.Date(
-		t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC,
-	).Unix()
-	p.lastFullyParsedTimePart = make([]byte, len(timePart))
-	copy(p.lastFullyParsedTimePart, timePart)
-	return t.Unix(), nil
-}
-
-/*
-Simplified int parser that is faster than `strconv.ParseInt` etc.
-We don't need to parse signs like `-` or `+` and we don't need any scientific notation.
-And our base is always 10.
-*/
-func (p *LineToStoreRecordParser) parseInt64(intPart []byte) (int64, error) {
-	number := int64(0)
-	for _, d := range intPart {
-		if d < '0' || d > '9' {
-			return 0, fmt.Errorf("can't parse int: `%s`", string(intPart))
-		}
-		number *= 10
-		number += int64(d - '0')
-	}
-	return number, nil
-}
-
-func (p *LineToStoreRecordParser) internSectionString(sectionPart []byte) string {
-	if p.sectionInternCacheSize == 0 {
-		return string(sectionPart)
-	}
-	if len(p.sectionPartsInternCache) > p.sectionInternCacheSize {
-		p.sectionPartsInternCache = nil
-	}
-
-	sectionPartStr := *(*string)(unsafe.Pointer(&sectionPart)) // bytes to string without potential allocation
-	p.stringInternHash.Reset()
-	_, _ = p.stringInternHash.Write(sectionPart)
-	sectionHash := p.stringInternHash.Sum32()
-	partFromCache, ok := p.sectionPartsInternCache[sectionHash]
-	if ok && sectionPartStr == partFromCache {
-		return partFromCache
-	}
-	sectionString := string(sectionPart)
-	p.sectionPartsInternCache[sectionHash] = sectionString
-	return sectionString
-}
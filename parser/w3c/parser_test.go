@@ -19,35 +19,73 @@ func TestW3CParsing(t *testing.T) {
 	test.FailOnError(t, parserWithCacheErr)
 	parserNoCache, parserNoCacheErr := NewLineToStoreRecordParser(0)
 	test.FailOnError(t, parserNoCacheErr)
+	parserOfSections, parserOfSectionsErr := NewLineToStoreRecordParser(10)
+	test.FailOnError(t, parserOfSectionsErr)
+	parserOfSections.SkipTextParts()
 
 	cases := []parsingCase{
 		{
-			line:   `127.0.0.1 - james [09/May/2018:16:00:39 +0000] "GET /report HTTP/1.0" 200 123`,
-			result: stat.Record{UnixTime: 1525881639, Section: "/report", StatusCode: 200, ResponseSize: 123},
+			line: `127.0.0.1 - james [09/May/2018:16:00:39 +0000] "GET /report HTTP/1.0" 200 123`,
+			result: stat.Record{
+				UnixTime: 1525881639, Section: "/report", StatusCode: 200, ResponseSize: 123,
+				RemoteHost: "127.0.0.1", Ident: "-", AuthUser: "james", Method: "GET", Path: "/report", Protocol: "HTTP/1.0",
+			},
 		},
 		{
-			line:   `127.0.0.1 - jill [09/May/2018:16:00:41 +0000] "GET /api/user HTTP/1.0" 200 234`,
-			result: stat.Record{UnixTime: 1525881641, Section: "/api", StatusCode: 200, ResponseSize: 234},
+			line: `127.0.0.1 - jill [09/May/2018:16:00:41 +0000] "GET /api/user HTTP/1.0" 200 234`,
+			result: stat.Record{
+				UnixTime: 1525881641, Section: "/api", StatusCode: 200, ResponseSize: 234,
+				RemoteHost: "127.0.0.1", Ident: "-", AuthUser: "jill", Method: "GET", Path: "/api/user", Protocol: "HTTP/1.0",
+			},
 		},
 		{
-			line:   `127.0.0.1 - frank [09/May/2018:16:00:42 +0000] "POST /api/user HTTP/1.0" 200 34`,
-			result: stat.Record{UnixTime: 1525881642, Section: "/api", StatusCode: 200, ResponseSize: 34},
+			line: `127.0.0.1 - frank [09/May/2018:16:00:42 +0000] "POST /api/user HTTP/1.0" 200 34`,
+			result: stat.Record{
+				UnixTime: 1525881642, Section: "/api", StatusCode: 200, ResponseSize: 34,
+				RemoteHost: "127.0.0.1", Ident: "-", AuthUser: "frank", Method: "POST", Path: "/api/user", Protocol: "HTTP/1.0",
+			},
 		},
 		{
-			line:   `127.0.0.1 - frank [09/May/2018:23:59:59 +0000] "POST /api/user HTTP/1.0" 200 34`,
-			result: stat.Record{UnixTime: 1525910399, Section: "/api", StatusCode: 200, ResponseSize: 34},
+			line: `127.0.0.1 - frank [09/May/2018:23:59:59 +0000] "POST /api/user HTTP/1.0" 200 34`,
+			result: stat.Record{
+				UnixTime: 1525910399, Section: "/api", StatusCode: 200, ResponseSize: 34,
+				RemoteHost: "127.0.0.1", Ident: "-", AuthUser: "frank", Method: "POST", Path: "/api/user", Protocol: "HTTP/1.0",
+			},
 		},
 		{
-			line:   `127.0.0.1 - frank [10/May/2018:01:15:59 +0000] "POST /api/user HTTP/1.0" 200 34`,
-			result: stat.Record{UnixTime: 1525914959, Section: "/api", StatusCode: 200, ResponseSize: 34},
+			line: `127.0.0.1 - frank [10/May/2018:01:15:59 +0000] "POST /api/user HTTP/1.0" 200 34`,
+			result: stat.Record{
+				UnixTime: 1525914959, Section: "/api", StatusCode: 200, ResponseSize: 34,
+				RemoteHost: "127.0.0.1", Ident: "-", AuthUser: "frank", Method: "POST", Path: "/api/user", Protocol: "HTTP/1.0",
+			},
 		},
 		{
-			line:   `127.0.0.1 - frank [10/May/2018:01:15:59 -0700] "POST /api/user HTTP/1.0" 200 34`,
-			result: stat.Record{UnixTime: 1525940159, Section: "/api", StatusCode: 200, ResponseSize: 34},
+			line: `127.0.0.1 - frank [10/May/2018:01:15:59 -0700] "POST /api/user HTTP/1.0" 200 34`,
+			result: stat.Record{
+				UnixTime: 1525940159, Section: "/api", StatusCode: 200, ResponseSize: 34,
+				RemoteHost: "127.0.0.1", Ident: "-", AuthUser: "frank", Method: "POST", Path: "/api/user", Protocol: "HTTP/1.0",
+			},
 		},
 		{
-			line:   `127.0.0.1 - mary [09/May/2018:16:00:42 +0000] "POST /api/user HTTP/1.0" 503 19`,
-			result: stat.Record{UnixTime: 1525881642, Section: "/api", StatusCode: 503, ResponseSize: 19},
+			line: `127.0.0.1 - mary [09/May/2018:16:00:42 +0000] "POST /api/user HTTP/1.0" 503 19`,
+			result: stat.Record{
+				UnixTime: 1525881642, Section: "/api", StatusCode: 503, ResponseSize: 19,
+				RemoteHost: "127.0.0.1", Ident: "-", AuthUser: "mary", Method: "POST", Path: "/api/user", Protocol: "HTTP/1.0",
+			},
+		},
+		{
+			line: `10.0.0.2 ident - [09/May/2018:16:00:42 +0000] "GET /api/user?id=1&x=%20 HTTP/2.0" 304 -`,
+			result: stat.Record{
+				UnixTime: 1525881642, Section: "/api", StatusCode: 304, ResponseSize: 0,
+				RemoteHost: "10.0.0.2", Ident: "ident", AuthUser: "-", Method: "GET", Path: "/api/user?id=1&x=%20", Protocol: "HTTP/2.0",
+			},
+		},
+		{
+			line: `::1 - - [09/May/2018:16:00:42 +0000] "GET /simple" 200 5`,
+			result: stat.Record{
+				UnixTime: 1525881642, Section: "/simple", StatusCode: 200, ResponseSize: 5,
+				RemoteHost: "::1", Ident: "-", AuthUser: "-", Method: "GET", Path: "/simple", Protocol: "",
+			},
 		},
 	}
 
@@ -62,4 +100,102 @@ func TestW3CParsing(t *testing.T) {
 			})
 		}
 	}
+	for _, testCase := range cases {
+		actual, err := parserOfSections.Parse([]byte(testCase.line))
+		test.FailOnError(t, err)
+		test.Equals(t, withoutTextParts(testCase.result), actual, "mismatch on: %s", testCase.line)
+	}
+}
+
+func BenchmarkW3CParsing(b *testing.B) {
+	lines := [][]byte{
+		[]byte(`127.0.0.1 - james [09/May/2018:16:00:39 +0000] "GET /report HTTP/1.0" 200 123`),
+		[]byte(`127.0.0.1 - jill [09/May/2018:16:00:41 +0000] "GET /api/user HTTP/1.0" 200 234`),
+	}
+	uniquePathLines := make([][]byte, 64*1024)
+	for i := range uniquePathLines {
+		uniquePathLines[i] = []byte(fmt.Sprintf(
+			`10.0.%v.%v - - [09/May/2018:16:00:39 +0000] "GET /api/user/%v?page=2 HTTP/1.1" 200 123`, i/256%256, i%256, i,
+		))
+	}
+	benchmarks := []struct {
+		name          string
+		lines         [][]byte
+		skipTextParts bool
+	}{
+		{name: "text_parts", lines: lines},
+		{name: "text_parts_of_unique_paths", lines: uniquePathLines},
+		{name: "sections", lines: lines, skipTextParts: true},
+		{name: "sections_of_unique_paths", lines: uniquePathLines, skipTextParts: true},
+	}
+	for _, benchmark := range benchmarks {
+		b.Run(benchmark.name, func(b *testing.B) {
+			parser, parserErr := NewLineToStoreRecordParser(16 * 1024)
+			if parserErr != nil {
+				b.Fatal(parserErr)
+			}
+			if benchmark.skipTextParts {
+				parser.SkipTextParts()
+			}
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				_, err := parser.Parse(benchmark.lines[i%len(benchmark.lines)])
+				if err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func withoutTextParts(record stat.Record) stat.Record {
+	record.RemoteHost, record.Ident, record.AuthUser = "", "", ""
+	record.Method, record.Path, record.Protocol = "", "", ""
+	return record
+}
+
+func TestW3CParsingErrors(t *testing.T) {
+	parser, parserErr := NewLineToStoreRecordParser(10)
+	test.FailOnError(t, parserErr)
+	lines := []string{
+		``,
+		`127.0.0.1 - james`,
+		`127.0.0.1 - james [09/May/2018:16:00:39 +0000]`,
+		`127.0.0.1 - james [09/May/2018:16:00:39 +0000] "GET /report HTTP/1.0`,
+		`127.0.0.1 - james [09/May/2018:16:00:39 +0000] "-" 400 0`,
+		`127.0.0.1 - james [09/May/2018:16:00:39 +0000] "GET /report HTTP/1.0" 20`,
+		`127.0.0.1 - james [09/May/2018:16:00:39 +0000] "GET /report HTTP/1.0" 200 x`,
+		`127.0.0.1 - james [09/May/2018:16:00:39 +0000] "GET /report HTTP/1.0" 200 123 x`,
+		`127.0.0.1 - james [09/May/2018:16:00:39 +0000] "GET /report HTTP/1.0" 200 123 "-" "curl/7.58.0"`,
+	}
+	for _, line := range lines {
+		_, err := parser.Parse([]byte(line))
+		test.Equals(t, true, err != nil, "line should be rejected: %v", line)
+	}
+}
+
+func TestW3CParsingWithFullInternCache(t *testing.T) {
+	parser, parserErr := NewLineToStoreRecordParser(2)
+	test.FailOnError(t, parserErr)
+	for i := 0; i < 10; i++ {
+		line := fmt.Sprintf(`127.0.0.1 - james [09/May/2018:16:00:39 +0000] "GET /section%v/x HTTP/1.0" 200 1`, i)
+		record, err := parser.Parse([]byte(line))
+		test.FailOnError(t, err)
+		test.Equals(t, fmt.Sprintf("/section%v", i), record.Section, "section mismatch")
+	}
+}
+
+func TestW3CTimeParsing(t *testing.T) {
+	parser, parserErr := NewLineToStoreRecordParser(0)
+	test.FailOnError(t, parserErr)
+
+	unixTime, timeErr := parser.ParseTime([]byte(`127.0.0.1 - frank [10/May/2018:01:15:59 -0700] "POST /api/user HTTP/1.0"`))
+	test.FailOnError(t, timeErr)
+	test.Equals(t, int64(1525940159), unixTime, "time mismatch")
+
+	_, shortTimeErr := parser.ParseTime([]byte(`127.0.0.1 - frank [10/May] "POST /api/user HTTP/1.0" 200 34`))
+	test.Equals(t, true, shortTimeErr != nil, "short time part should be rejected")
+	_, noTimeErr := parser.ParseTime([]byte(`#Fields: date time`))
+	test.Equals(t, true, noTimeErr != nil, "line without time should be rejected")
 }
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"fmt"
+	"github.com/storozhukBM/logstat/alert"
+	"github.com/storozhukBM/logstat/config"
+	"github.com/storozhukBM/logstat/stat"
+	"github.com/storozhukBM/logstat/view"
+)
+
+type recordStorage interface {
+	Store(r stat.Record)
+	StoreDroppedLines(count uint64)
+}
+
+type lineReadCloser interface {
+	ReadOneLineAsSlice() ([]byte, error)
+	Close() error
+}
+
+type lineParser interface {
+	Parse(line []byte) (stat.Record, error)
+	ParseTime(line []byte) (int64, error)
+}
+
+type lineLengthLimitedReader interface {
+	lineReadCloser
+	LimitLineLength(maxLineLength uint, truncateLongLines bool)
+}
+
+/*
+Chain of components that aggregates records into reports, examines them for alerts and sends both into view.
+*/
+type pipeline struct {
+	storage            *stat.Storage
+	trafficAlert       *alert.TrafficState
+	reportSubscription *stat.ReportSubscription
+	alertsSubscription *alert.AlertsSubscription
+}
+
+func newPipeline(cfg config.Config, ioView *view.IOView) (*pipeline, error) {
+	newStorage, newTrafficState := stat.NewStorage, alert.NewTrafficState
+	if cfg.BatchMode {
+		newStorage, newTrafficState = stat.NewBlockingStorage, alert.NewBlockingTrafficState
+	}
+
+	storage, storageErr := newStorage(10, 10)
+	if storageErr != nil {
+		return nil, fmt.Errorf("can't setup traffic aggregation storage: %v", storageErr)
+	}
+
+	trafficAlert, trafficAlertErr := newTrafficState(
+		120, 10, 10, 10,
+	)
+	if trafficAlertErr != nil {
+		return nil, fmt.Errorf("can't setup traffic alert: %v", trafficAlertErr)
+	}
+
+	alertsSubscription, alertsSubscriptionErr := alert.NewAlertsSubscription(trafficAlert, ioView.TrafficAlert)
+	if alertsSubscriptionErr != nil {
+		return nil, fmt.Errorf("can't setup alert broadcast: %v", alertsSubscriptionErr)
+	}
+
+	reportSubscription, reportSubscriptionErr := stat.NewReportSubscription(storage, trafficAlert.Store, ioView.Report)
+	if reportSubscriptionErr != nil {
+		return nil, fmt.Errorf("can't setup traffic reports broadcast: %v", reportSubscriptionErr)
+	}
+	return &pipeline{
+		storage:            storage,
+		trafficAlert:       trafficAlert,
+		reportSubscription: reportSubscription,
+		alertsSubscription: alertsSubscription,
+	}, nil
+}
+
+/*
+Flushes last partial cycle through the whole pipeline, so final reports and alerts are delivered to view.
+Should be called only when there will be no more records.
+*/
+func (p *pipeline) flushAndWait() {
+	p.storage.FlushAndClose()
+	<-p.reportSubscription.Done()
+	p.trafficAlert.Close()
+	<-p.alertsSubscription.Done()
+}
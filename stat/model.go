@@ -1,10 +1,38 @@
 package stat
 
+import (
+	"errors"
+	"time"
+)
+
+/*
+Returned by parsers for lines that have no record, like directives or comments, such lines are skipped silently.
+*/
+var ErrNoRecord = errors.New("line has no record")
+
+/*
+Parsed log line. Text parts that are absent in the line are empty, or `-` if log format writes it.
+*/
 type Record struct {
+	Source       string
 	UnixTime     int64
+	RemoteHost   string
+	Ident        string
+	AuthUser     string
+	Method       string
+	Path         string
+	Protocol     string
 	Section      string
 	StatusCode   int32
 	ResponseSize int64
+	Referer      string
+	UserAgent    string
+	// time spent to process request, zero if log format doesn't have it
+	Latency time.Duration
+	// status code returned by upstream behind proxy, like target of load balancer, zero if log format doesn't have it
+	UpstreamStatusCode int32
+	// time spent by upstream behind proxy to process request, zero if log format doesn't have it
+	UpstreamLatency time.Duration
 }
 
 /*
@@ -14,17 +42,29 @@ type Report struct {
 	CycleDurationInSeconds int64
 	CycleOffset            int64
 	CycleStartUnixTime     int64
+	// source of all records in the cycle, or empty if records came from several sources
+	Source string
 
 	TotalRequests            uint64
 	TotalResponseSizeInBytes uint64
-	requestsPerSection       map[string]uint64
-	requestsPerStatusCode    map[int32]uint64
+	// lines that weren't stored as records, because they were too long
+	DroppedLines uint64
+	// sum and max of latencies of all records, zero if log format doesn't have latency
+	TotalLatency time.Duration
+	MaxLatency   time.Duration
+
+	requestsPerSection    map[string]uint64
+	requestsPerStatusCode map[int32]uint64
+	requestsPerSource     map[string]uint64
 }
 
-func BuildReport(requestsPerSection map[string]uint64, requestsPerStatusCode map[int32]uint64) Report {
+func BuildReport(
+	requestsPerSection map[string]uint64, requestsPerStatusCode map[int32]uint64, requestsPerSource map[string]uint64,
+) Report {
 	result := Report{
 		requestsPerSection:    make(map[string]uint64, len(requestsPerSection)),
 		requestsPerStatusCode: make(map[int32]uint64, len(requestsPerStatusCode)),
+		requestsPerSource:     make(map[string]uint64, len(requestsPerSource)),
 	}
 	for section, requests := range requestsPerSection {
 		result.requestsPerSection[section] = requests
@@ -32,9 +72,22 @@ func BuildReport(requestsPerSection map[string]uint64, requestsPerStatusCode map
 	for code, requests := range requestsPerStatusCode {
 		result.requestsPerStatusCode[code] = requests
 	}
+	for source, requests := range requestsPerSource {
+		result.requestsPerSource[source] = requests
+	}
 	return result
 }
 
+/*
+Average latency of all requests of the cycle, requests without latency are counted as instant.
+*/
+func (c Report) AverageLatency() time.Duration {
+	if c.TotalRequests == 0 {
+		return 0
+	}
+	return c.TotalLatency / time.Duration(c.TotalRequests)
+}
+
 func (c Report) IterRequestsPerSection(iteration func(section string, requests uint64)) {
 	for section, requests := range c.requestsPerSection {
 		iteration(section, requests)
@@ -45,6 +98,16 @@ func (c Report) GetRequestsPerSection(section string) uint64 {
 	return c.requestsPerSection[section]
 }
 
+func (c Report) IterRequestsPerSource(iteration func(source string, requests uint64)) {
+	for source, requests := range c.requestsPerSource {
+		iteration(source, requests)
+	}
+}
+
+func (c Report) GetRequestsPerSource(source string) uint64 {
+	return c.requestsPerSource[source]
+}
+
 func (c Report) IterRequestsPerStatusCode(iteration func(code int32, requests uint64)) {
 	for code, requests := range c.requestsPerStatusCode {
 		iteration(code, requests)
@@ -0,0 +1,145 @@
+package stat
+
+/*
+A component used to aggregate records of one chunk of log independently from other chunks,
+so chunks can be aggregated in parallel and then merged into `Storage` in their order.
+Merged reports are exactly the same as if records of all chunks were stored into `Storage` one by one.
+
+Responsibilities:
+	- keep records at the start of chunk as is, while their cycle depends on records of previous chunks
+	- aggregate the rest of records into cycles, starting from the first record that certainly rotates the cycle
+
+Attention:
+	- `Store` method is not safe for concurrent use, use separate shard for each chunk
+	- shard should be merged by `Storage.MergeShard` of the storage that created it, in the order of chunks
+*/
+type Shard struct {
+	cycleDurationInSeconds int64
+	keepLateRecords        bool
+
+	// offsets of the possible current cycle of the storage, they depend on records of previous chunks
+	anyCurrentCycle      bool
+	currentCycleOffsets  [2]int64
+	currentCyclesCount   int
+	cyclesAreDetermined  bool
+	eventsBeforeRotation []shardEvent
+
+	storage *Storage
+}
+
+type shardEvent struct {
+	record       Record
+	droppedLines uint64
+}
+
+/*
+Creates shard with the same cycle duration and handling of late records as this storage.
+*/
+func (s *Storage) NewShard() *Shard {
+	return &Shard{
+		cycleDurationInSeconds: s.cycleDurationInSeconds,
+		keepLateRecords:        s.keepLateRecords,
+		anyCurrentCycle:        true,
+		storage: &Storage{
+			cycleDurationInSeconds: s.cycleDurationInSeconds,
+			keepLateRecords:        s.keepLateRecords,
+			collectCycles:          true,
+		},
+	}
+}
+
+func (s *Shard) Store(r Record) {
+	if s.cyclesAreDetermined {
+		s.storage.Store(r)
+		return
+	}
+	recordOffset := r.UnixTime / s.cycleDurationInSeconds
+	if s.certainlyRotatesCycle(recordOffset) {
+		s.cyclesAreDetermined = true
+		s.storage.Store(r)
+		return
+	}
+	s.eventsBeforeRotation = append(s.eventsBeforeRotation, shardEvent{record: r})
+	s.updatePossibleCurrentCycles(recordOffset)
+}
+
+func (s *Shard) StoreDroppedLines(count uint64) {
+	if s.cyclesAreDetermined {
+		s.storage.StoreDroppedLines(count)
+		return
+	}
+	s.eventsBeforeRotation = append(s.eventsBeforeRotation, shardEvent{droppedLines: count})
+}
+
+/*
+Storage keeps its current cycle only for records of this cycle,
+or records late by one cycle if it is configured to keep them.
+*/
+func (s *Shard) certainlyRotatesCycle(recordOffset int64) bool {
+	if s.anyCurrentCycle {
+		return false
+	}
+	for i := 0; i < s.currentCyclesCount; i++ {
+		if s.keepsCycle(s.currentCycleOffsets[i], recordOffset) {
+			return false
+		}
+	}
+	return true
+}
+
+func (s *Shard) updatePossibleCurrentCycles(recordOffset int64) {
+	// any current cycle except the record one, or the next one if late records are kept, is rotated to the record cycle
+	if s.anyCurrentCycle {
+		s.anyCurrentCycle = false
+		s.currentCycleOffsets = [2]int64{recordOffset, recordOffset + 1}
+		s.currentCyclesCount = 1
+		if s.keepLateRecords {
+			s.currentCyclesCount = 2
+		}
+		return
+	}
+	var offsets [2]int64
+	count := 0
+	rotated := false
+	for i := 0; i < s.currentCyclesCount; i++ {
+		if s.keepsCycle(s.currentCycleOffsets[i], recordOffset) {
+			offsets[count] = s.currentCycleOffsets[i]
+			count++
+		} else {
+			rotated = true
+		}
+	}
+	if rotated && (count == 0 || offsets[0] != recordOffset) {
+		offsets[count] = recordOffset
+		count++
+	}
+	s.currentCycleOffsets = offsets
+	s.currentCyclesCount = count
+}
+
+func (s *Shard) keepsCycle(currentCycleOffset int64, recordOffset int64) bool {
+	return currentCycleOffset == recordOffset || (s.keepLateRecords && currentCycleOffset-1 == recordOffset)
+}
+
+/*
+Merges shard of the next chunk into this storage, reports of completed cycles are emitted the same way as by `Store`.
+*/
+func (s *Storage) MergeShard(shard *Shard) {
+	for _, event := range shard.eventsBeforeRotation {
+		if event.droppedLines > 0 {
+			s.StoreDroppedLines(event.droppedLines)
+			continue
+		}
+		s.Store(event.record)
+	}
+	if !shard.cyclesAreDetermined {
+		return
+	}
+
+	// cycles are determined only after records before rotation, so they are already stored into the current cycle
+	s.pushReportToRing(*s.currentCycle)
+	for _, cycle := range shard.storage.collectedCycles {
+		s.pushReportToRing(cycle)
+	}
+	s.currentCycle = shard.storage.currentCycle
+}
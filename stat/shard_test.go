@@ -0,0 +1,98 @@
+package stat
+
+import (
+	"fmt"
+	"github.com/storozhukBM/logstat/common/test"
+	"math/rand"
+	"testing"
+)
+
+func TestShardsMergeIsTheSameAsSequentialStore(t *testing.T) {
+	t.Parallel()
+	testShardsMergeIsTheSameAsSequentialStore(t, false)
+}
+
+func TestShardsMergeIsTheSameAsSequentialStoreWithLateRecords(t *testing.T) {
+	t.Parallel()
+	testShardsMergeIsTheSameAsSequentialStore(t, true)
+}
+
+func testShardsMergeIsTheSameAsSequentialStore(t *testing.T, keepLateRecords bool) {
+	random := rand.New(rand.NewSource(42))
+	for iteration := 0; iteration < 500; iteration++ {
+		events := randomShardEvents(random)
+
+		sequential, sequentialErr := NewStorage(10, 1000)
+		test.FailOnError(t, sequentialErr)
+		merged, mergedErr := NewStorage(10, 1000)
+		test.FailOnError(t, mergedErr)
+		if keepLateRecords {
+			sequential.KeepLateRecordsInCurrentCycle()
+			merged.KeepLateRecordsInCurrentCycle()
+		}
+		for _, event := range events {
+			storeShardEvent(sequential, event)
+		}
+
+		var shards []*Shard
+		for chunkStart := 0; chunkStart < len(events); {
+			chunkEnd := chunkStart + random.Intn(8)
+			if chunkEnd > len(events) {
+				chunkEnd = len(events)
+			}
+			shard := merged.NewShard()
+			for _, event := range events[chunkStart:chunkEnd] {
+				storeShardEvent(shard, event)
+			}
+			shards = append(shards, shard)
+			chunkStart = chunkEnd
+		}
+		for _, shard := range shards {
+			merged.MergeShard(shard)
+		}
+
+		test.Equals(t, flushedReports(sequential), flushedReports(merged), "reports mismatch on: %+v", events)
+	}
+}
+
+func randomShardEvents(random *rand.Rand) []shardEvent {
+	count := random.Intn(40)
+	events := make([]shardEvent, 0, count)
+	unixTime := int64(random.Intn(100))
+	for i := 0; i < count; i++ {
+		if random.Intn(10) == 0 {
+			events = append(events, shardEvent{droppedLines: uint64(random.Intn(3) + 1)})
+			continue
+		}
+		// records mostly go forward, but sometimes they are late or jump
+		unixTime += int64(random.Intn(15) - 4)
+		if unixTime < 0 {
+			unixTime = 0
+		}
+		events = append(events, shardEvent{record: Record{
+			Source:       fmt.Sprintf("source%v", random.Intn(2)),
+			UnixTime:     unixTime,
+			Section:      fmt.Sprintf("/section%v", random.Intn(3)),
+			StatusCode:   int32(200 + random.Intn(2)),
+			ResponseSize: int64(random.Intn(100)),
+		}})
+	}
+	return events
+}
+
+func storeShardEvent(storage recordStorage, event shardEvent) {
+	if event.droppedLines > 0 {
+		storage.StoreDroppedLines(event.droppedLines)
+		return
+	}
+	storage.Store(event.record)
+}
+
+func flushedReports(storage *Storage) []Report {
+	storage.FlushAndClose()
+	var result []Report
+	for report := range storage.Reports() {
+		result = append(result, report)
+	}
+	return result
+}
@@ -0,0 +1,64 @@
+package stat
+
+import (
+	"fmt"
+	"sync"
+)
+
+type recordStorage interface {
+	Store(r Record)
+	StoreDroppedLines(count uint64)
+}
+
+/*
+A component used to label records with their source, like log file name,
+before they are stored into target storage.
+*/
+type SourceLabeledStorage struct {
+	source  string
+	storage recordStorage
+}
+
+func NewSourceLabeledStorage(source string, storage recordStorage) (*SourceLabeledStorage, error) {
+	if storage == nil {
+		return nil, fmt.Errorf("storage can't be nil")
+	}
+	return &SourceLabeledStorage{source: source, storage: storage}, nil
+}
+
+func (s *SourceLabeledStorage) Store(r Record) {
+	r.Source = s.source
+	s.storage.Store(r)
+}
+
+func (s *SourceLabeledStorage) StoreDroppedLines(count uint64) {
+	s.storage.StoreDroppedLines(count)
+}
+
+/*
+A component used to share one storage between several record producers,
+like watchers of several log files.
+*/
+type SynchronizedStorage struct {
+	mu      sync.Mutex
+	storage recordStorage
+}
+
+func NewSynchronizedStorage(storage recordStorage) (*SynchronizedStorage, error) {
+	if storage == nil {
+		return nil, fmt.Errorf("storage can't be nil")
+	}
+	return &SynchronizedStorage{storage: storage}, nil
+}
+
+func (s *SynchronizedStorage) Store(r Record) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.storage.Store(r)
+}
+
+func (s *SynchronizedStorage) StoreDroppedLines(count uint64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.storage.StoreDroppedLines(count)
+}
@@ -0,0 +1,58 @@
+package stat
+
+import (
+	"github.com/storozhukBM/logstat/common/test"
+	"sync"
+	"testing"
+)
+
+func TestSourceLabeledStorage(t *testing.T) {
+	t.Parallel()
+	storage, storageErr := NewStorage(10, 2)
+	test.FailOnError(t, storageErr)
+	storage.KeepLateRecordsInCurrentCycle()
+	sharedStorage, sharedStorageErr := NewSynchronizedStorage(storage)
+	test.FailOnError(t, sharedStorageErr)
+	firstStorage, firstStorageErr := NewSourceLabeledStorage("first.log", sharedStorage)
+	test.FailOnError(t, firstStorageErr)
+	secondStorage, secondStorageErr := NewSourceLabeledStorage("second.log", sharedStorage)
+	test.FailOnError(t, secondStorageErr)
+
+	firstStorage.Store(Record{UnixTime: 1, Section: "/a", StatusCode: 200, ResponseSize: 5})
+	firstStorage.Store(Record{UnixTime: 11, Section: "/a", StatusCode: 200, ResponseSize: 5})
+	waitForReport(t, storage, Report{
+		CycleDurationInSeconds:   10,
+		CycleOffset:              0,
+		CycleStartUnixTime:       0,
+		Source:                   "first.log",
+		TotalRequests:            1,
+		TotalResponseSizeInBytes: 5,
+		requestsPerSection:       map[string]uint64{"/a": 1},
+		requestsPerStatusCode:    map[int32]uint64{200: 1},
+		requestsPerSource:        map[string]uint64{"first.log": 1},
+	})
+
+	wg := &sync.WaitGroup{}
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			secondStorage.Store(Record{UnixTime: 12, Section: "/b", StatusCode: 200, ResponseSize: 1})
+		}()
+	}
+	wg.Wait()
+	// record that is late by one cycle is stored into the current one
+	firstStorage.Store(Record{UnixTime: 9, Section: "/a", StatusCode: 500, ResponseSize: 5})
+	firstStorage.Store(Record{UnixTime: 21, Section: "/a", StatusCode: 200, ResponseSize: 5})
+	waitForReport(t, storage, Report{
+		CycleDurationInSeconds:   10,
+		CycleOffset:              1,
+		CycleStartUnixTime:       10,
+		Source:                   "",
+		TotalRequests:            12,
+		TotalResponseSizeInBytes: 20,
+		requestsPerSection:       map[string]uint64{"/a": 2, "/b": 10},
+		requestsPerStatusCode:    map[int32]uint64{200: 11, 500: 1},
+		requestsPerSource:        map[string]uint64{"first.log": 2, "second.log": 10},
+	})
+}
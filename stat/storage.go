@@ -11,23 +11,48 @@ reports by the specified time windows called cycles.
 
 Responsibilities:
 	- accept log records
-	- modify internal cycle aggregate
-	- rotate cycles by time specified in log records
+	- modify internal cycle aggregate, like requests per section and status code, or total and max latency
+	- rotate cycles by time specified in log records.
+	Records that are late by one cycle rotate the cycle as any other records of another cycle,
+	unless storage is configured to keep them in the current cycle by `KeepLateRecordsInCurrentCycle`
+	- count lines dropped by the reader in the current cycle
 	- emmit traffic cycle reports into output channel
+	- flush last partial cycle when there are no more records, for example at the end of batch processing
+	- create shards for parallel aggregation of log chunks and merge them in the order of chunks
 
 Attention:
 	- `Store` method is not safe for concurrent use and intended to be synchronized externally
 	- if reports from output channel won't be consumed this component will print them as
-	error report
+	error report, unless it is created as blocking storage
 */
 type Storage struct {
 	cycleDurationInSeconds int64
+	blockOnFullRing        bool
+	keepLateRecords        bool
 
 	currentCycle   *Report
 	prevCyclesRing chan Report
+	// lines dropped before the first record are attributed to its cycle
+	pendingDroppedLines uint64
+
+	// storage of shard collects reports of completed cycles, instead of pushing them to the ring
+	collectCycles   bool
+	collectedCycles []Report
 }
 
 func NewStorage(cycleDurationInSeconds uint64, prevCyclesRingSize uint) (*Storage, error) {
+	return newStorage(cycleDurationInSeconds, prevCyclesRingSize, false)
+}
+
+/*
+Creates storage that never drops reports, but blocks `Store` till the oldest report is consumed.
+Intended for batch processing, where records are read much faster than reports are consumed.
+*/
+func NewBlockingStorage(cycleDurationInSeconds uint64, prevCyclesRingSize uint) (*Storage, error) {
+	return newStorage(cycleDurationInSeconds, prevCyclesRingSize, true)
+}
+
+func newStorage(cycleDurationInSeconds uint64, prevCyclesRingSize uint, blockOnFullRing bool) (*Storage, error) {
 	if cycleDurationInSeconds < 1 {
 		return nil, fmt.Errorf("CycleDurationInSeconds should be at least 1")
 	}
@@ -36,38 +61,85 @@ func NewStorage(cycleDurationInSeconds uint64, prevCyclesRingSize uint) (*Storag
 	}
 	return &Storage{
 		cycleDurationInSeconds: int64(cycleDurationInSeconds),
+		blockOnFullRing:        blockOnFullRing,
 		currentCycle:           nil,
 		prevCyclesRing:         make(chan Report, prevCyclesRingSize),
 	}, nil
 }
 
+/*
+Stores records that are late by one cycle into the current cycle instead of rotating it.
+Intended for storage merged from several sources, where records of different sources can be slightly reordered.
+Should be called before the first record is stored.
+*/
+func (s *Storage) KeepLateRecordsInCurrentCycle() {
+	s.keepLateRecords = true
+}
+
 func (s *Storage) Store(r Record) {
 	recordOffset := r.UnixTime / s.cycleDurationInSeconds
 	s.currentCycle = s.tryRotateCurrentCycle(recordOffset)
 
+	if s.currentCycle.TotalRequests == 0 {
+		s.currentCycle.Source = r.Source
+	} else if s.currentCycle.Source != r.Source {
+		s.currentCycle.Source = ""
+	}
 	s.currentCycle.TotalRequests++
 	s.currentCycle.TotalResponseSizeInBytes += uint64(r.ResponseSize)
+	s.currentCycle.TotalLatency += r.Latency
+	if r.Latency > s.currentCycle.MaxLatency {
+		s.currentCycle.MaxLatency = r.Latency
+	}
 	s.currentCycle.requestsPerSection[r.Section]++
 	s.currentCycle.requestsPerStatusCode[r.StatusCode]++
+	s.currentCycle.requestsPerSource[r.Source]++
+}
+
+/*
+Adds lines that were dropped by the reader to the current cycle.
+*/
+func (s *Storage) StoreDroppedLines(count uint64) {
+	if s.currentCycle == nil {
+		s.pendingDroppedLines += count
+		return
+	}
+	s.currentCycle.DroppedLines += count
 }
 
 func (s *Storage) Reports() <-chan Report {
 	return s.prevCyclesRing
 }
 
+/*
+Emits current partial cycle report and closes reports output channel.
+Storage can't be used after this call.
+*/
+func (s *Storage) FlushAndClose() {
+	if s.currentCycle != nil {
+		s.pushReportToRing(*s.currentCycle)
+		s.currentCycle = nil
+	}
+	close(s.prevCyclesRing)
+}
+
 func (s *Storage) tryRotateCurrentCycle(recordOffset int64) *Report {
 	if s.currentCycle == nil {
+		droppedLines := s.pendingDroppedLines
+		s.pendingDroppedLines = 0
 		return &Report{
 			CycleDurationInSeconds:   s.cycleDurationInSeconds,
 			CycleOffset:              recordOffset,
 			CycleStartUnixTime:       recordOffset * s.cycleDurationInSeconds,
 			TotalRequests:            0,
 			TotalResponseSizeInBytes: 0,
+			DroppedLines:             droppedLines,
 			requestsPerSection:       make(map[string]uint64),
 			requestsPerStatusCode:    make(map[int32]uint64),
+			requestsPerSource:        make(map[string]uint64),
 		}
 	}
-	if s.currentCycle.CycleOffset == recordOffset {
+	if s.currentCycle.CycleOffset == recordOffset || (s.keepLateRecords && s.currentCycle.CycleOffset-1 == recordOffset) {
 		return s.currentCycle
 	}
 
@@ -80,15 +152,27 @@ func (s *Storage) tryRotateCurrentCycle(recordOffset int64) *Report {
 		TotalResponseSizeInBytes: 0,
 		requestsPerSection:       make(map[string]uint64, len(oldCycle.requestsPerSection)),
 		requestsPerStatusCode:    make(map[int32]uint64, len(oldCycle.requestsPerStatusCode)),
+		requestsPerSource:        make(map[string]uint64, len(oldCycle.requestsPerSource)),
 	}
 
+	s.pushReportToRing(*oldCycle)
+	return newCycle
+}
+
+func (s *Storage) pushReportToRing(r Report) {
+	if s.collectCycles {
+		s.collectedCycles = append(s.collectedCycles, r)
+		return
+	}
+	if s.blockOnFullRing {
+		s.prevCyclesRing <- r
+		return
+	}
 	select {
-	case s.prevCyclesRing <- *oldCycle:
+	case s.prevCyclesRing <- r:
 	default:
 		notConsumedReport := <-s.prevCyclesRing
 		log.Error("[ALERT] CycleReport wasn't consumed from prevCyclesRing: %+v", notConsumedReport)
-		s.prevCyclesRing <- *oldCycle
+		s.prevCyclesRing <- r
 	}
-
-	return newCycle
 }
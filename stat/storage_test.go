@@ -27,6 +27,7 @@ func TestStatsStorage(t *testing.T) {
 			TotalResponseSizeInBytes: 5,
 			requestsPerSection:       map[string]uint64{"first": 1},
 			requestsPerStatusCode:    map[int32]uint64{200: 1},
+			requestsPerSource:        map[string]uint64{"": 1},
 		})
 
 		storage.Store(Record{UnixTime: 11, Section: "first", StatusCode: 500, ResponseSize: 3})
@@ -46,6 +47,7 @@ func TestStatsStorage(t *testing.T) {
 		TotalResponseSizeInBytes: 33,
 		requestsPerSection:       map[string]uint64{"first": 3, "second": 1},
 		requestsPerStatusCode:    map[int32]uint64{200: 2, 500: 2},
+		requestsPerSource:        map[string]uint64{"": 4},
 	})
 
 	storage.Store(Record{UnixTime: 30, Section: "third", StatusCode: 200, ResponseSize: 7})
@@ -60,6 +62,7 @@ func TestStatsStorage(t *testing.T) {
 		TotalResponseSizeInBytes: 7,
 		requestsPerSection:       map[string]uint64{"third": 1},
 		requestsPerStatusCode:    map[int32]uint64{200: 1},
+		requestsPerSource:        map[string]uint64{"": 1},
 	})
 	waitForReport(t, storage, Report{
 		CycleDurationInSeconds:   10,
@@ -69,9 +72,196 @@ func TestStatsStorage(t *testing.T) {
 		TotalResponseSizeInBytes: 7,
 		requestsPerSection:       map[string]uint64{"other": 1},
 		requestsPerStatusCode:    map[int32]uint64{400: 1},
+		requestsPerSource:        map[string]uint64{"": 1},
 	})
 }
 
+func TestBlockingStatsStorageFlush(t *testing.T) {
+	t.Parallel()
+	storage, storageErr := NewBlockingStorage(10, 1)
+	test.FailOnError(t, storageErr)
+
+	storage.Store(Record{UnixTime: 1, Section: "first", StatusCode: 200, ResponseSize: 5})
+	storage.Store(Record{UnixTime: 11, Section: "second", StatusCode: 200, ResponseSize: 7})
+	flushed := make(chan struct{})
+	go func() {
+		storage.Store(Record{UnixTime: 21, Section: "third", StatusCode: 500, ResponseSize: 3})
+		storage.FlushAndClose()
+		close(flushed)
+	}()
+
+	waitForReport(t, storage, Report{
+		CycleDurationInSeconds:   10,
+		CycleOffset:              0,
+		CycleStartUnixTime:       0,
+		TotalRequests:            1,
+		TotalResponseSizeInBytes: 5,
+		requestsPerSection:       map[string]uint64{"first": 1},
+		requestsPerStatusCode:    map[int32]uint64{200: 1},
+		requestsPerSource:        map[string]uint64{"": 1},
+	})
+	waitForReport(t, storage, Report{
+		CycleDurationInSeconds:   10,
+		CycleOffset:              1,
+		CycleStartUnixTime:       10,
+		TotalRequests:            1,
+		TotalResponseSizeInBytes: 7,
+		requestsPerSection:       map[string]uint64{"second": 1},
+		requestsPerStatusCode:    map[int32]uint64{200: 1},
+		requestsPerSource:        map[string]uint64{"": 1},
+	})
+	waitForReport(t, storage, Report{
+		CycleDurationInSeconds:   10,
+		CycleOffset:              2,
+		CycleStartUnixTime:       20,
+		TotalRequests:            1,
+		TotalResponseSizeInBytes: 3,
+		requestsPerSection:       map[string]uint64{"third": 1},
+		requestsPerStatusCode:    map[int32]uint64{500: 1},
+		requestsPerSource:        map[string]uint64{"": 1},
+	})
+	<-flushed
+	_, open := <-storage.Reports()
+	test.Equals(t, false, open, "reports should be closed after flush")
+}
+
+func TestStatsStorageDroppedLines(t *testing.T) {
+	t.Parallel()
+	storage, storageErr := NewBlockingStorage(10, 2)
+	test.FailOnError(t, storageErr)
+
+	storage.StoreDroppedLines(2)
+	storage.Store(Record{UnixTime: 1, Section: "first", StatusCode: 200, ResponseSize: 5})
+	storage.StoreDroppedLines(1)
+	storage.Store(Record{UnixTime: 11, Section: "second", StatusCode: 200, ResponseSize: 7})
+	storage.FlushAndClose()
+
+	waitForReport(t, storage, Report{
+		CycleDurationInSeconds:   10,
+		CycleOffset:              0,
+		CycleStartUnixTime:       0,
+		TotalRequests:            1,
+		TotalResponseSizeInBytes: 5,
+		DroppedLines:             3,
+		requestsPerSection:       map[string]uint64{"first": 1},
+		requestsPerStatusCode:    map[int32]uint64{200: 1},
+		requestsPerSource:        map[string]uint64{"": 1},
+	})
+	waitForReport(t, storage, Report{
+		CycleDurationInSeconds:   10,
+		CycleOffset:              1,
+		CycleStartUnixTime:       10,
+		TotalRequests:            1,
+		TotalResponseSizeInBytes: 7,
+		requestsPerSection:       map[string]uint64{"second": 1},
+		requestsPerStatusCode:    map[int32]uint64{200: 1},
+		requestsPerSource:        map[string]uint64{"": 1},
+	})
+}
+
+func TestStatsStorageLateRecords(t *testing.T) {
+	t.Parallel()
+	storage, storageErr := NewBlockingStorage(10, 3)
+	test.FailOnError(t, storageErr)
+
+	storage.Store(Record{UnixTime: 11, Section: "first", StatusCode: 200, ResponseSize: 5})
+	// record of the previous cycle rotates the current one
+	storage.Store(Record{UnixTime: 9, Section: "late", StatusCode: 200, ResponseSize: 3})
+	storage.Store(Record{UnixTime: 12, Section: "first", StatusCode: 200, ResponseSize: 7})
+	storage.FlushAndClose()
+
+	waitForReport(t, storage, Report{
+		CycleDurationInSeconds:   10,
+		CycleOffset:              1,
+		CycleStartUnixTime:       10,
+		TotalRequests:            1,
+		TotalResponseSizeInBytes: 5,
+		requestsPerSection:       map[string]uint64{"first": 1},
+		requestsPerStatusCode:    map[int32]uint64{200: 1},
+		requestsPerSource:        map[string]uint64{"": 1},
+	})
+	waitForReport(t, storage, Report{
+		CycleDurationInSeconds:   10,
+		CycleOffset:              0,
+		CycleStartUnixTime:       0,
+		TotalRequests:            1,
+		TotalResponseSizeInBytes: 3,
+		requestsPerSection:       map[string]uint64{"late": 1},
+		requestsPerStatusCode:    map[int32]uint64{200: 1},
+		requestsPerSource:        map[string]uint64{"": 1},
+	})
+	waitForReport(t, storage, Report{
+		CycleDurationInSeconds:   10,
+		CycleOffset:              1,
+		CycleStartUnixTime:       10,
+		TotalRequests:            1,
+		TotalResponseSizeInBytes: 7,
+		requestsPerSection:       map[string]uint64{"first": 1},
+		requestsPerStatusCode:    map[int32]uint64{200: 1},
+		requestsPerSource:        map[string]uint64{"": 1},
+	})
+}
+
+func TestStatsStorageKeepsLateRecordsInCurrentCycle(t *testing.T) {
+	t.Parallel()
+	storage, storageErr := NewBlockingStorage(10, 2)
+	test.FailOnError(t, storageErr)
+	storage.KeepLateRecordsInCurrentCycle()
+
+	storage.Store(Record{UnixTime: 21, Section: "first", StatusCode: 200, ResponseSize: 5})
+	storage.Store(Record{UnixTime: 19, Section: "late", StatusCode: 200, ResponseSize: 3})
+	// record that is late by two cycles still rotates the current one
+	storage.Store(Record{UnixTime: 9, Section: "late", StatusCode: 200, ResponseSize: 7})
+	storage.FlushAndClose()
+
+	waitForReport(t, storage, Report{
+		CycleDurationInSeconds:   10,
+		CycleOffset:              2,
+		CycleStartUnixTime:       20,
+		TotalRequests:            2,
+		TotalResponseSizeInBytes: 8,
+		requestsPerSection:       map[string]uint64{"first": 1, "late": 1},
+		requestsPerStatusCode:    map[int32]uint64{200: 2},
+		requestsPerSource:        map[string]uint64{"": 2},
+	})
+	waitForReport(t, storage, Report{
+		CycleDurationInSeconds:   10,
+		CycleOffset:              0,
+		CycleStartUnixTime:       0,
+		TotalRequests:            1,
+		TotalResponseSizeInBytes: 7,
+		requestsPerSection:       map[string]uint64{"late": 1},
+		requestsPerStatusCode:    map[int32]uint64{200: 1},
+		requestsPerSource:        map[string]uint64{"": 1},
+	})
+}
+
+func TestStatsStorageLatency(t *testing.T) {
+	t.Parallel()
+	storage, storageErr := NewBlockingStorage(10, 2)
+	test.FailOnError(t, storageErr)
+
+	storage.Store(Record{UnixTime: 1, Section: "first", StatusCode: 200, Latency: 30 * time.Millisecond})
+	storage.Store(Record{UnixTime: 2, Section: "first", StatusCode: 200, Latency: 90 * time.Millisecond})
+	storage.Store(Record{UnixTime: 3, Section: "first", StatusCode: 200})
+	storage.FlushAndClose()
+
+	report := Report{
+		CycleDurationInSeconds: 10,
+		CycleOffset:            0,
+		CycleStartUnixTime:     0,
+		TotalRequests:          3,
+		TotalLatency:           120 * time.Millisecond,
+		MaxLatency:             90 * time.Millisecond,
+		requestsPerSection:     map[string]uint64{"first": 3},
+		requestsPerStatusCode:  map[int32]uint64{200: 3},
+		requestsPerSource:      map[string]uint64{"": 3},
+	}
+	waitForReport(t, storage, report)
+	test.Equals(t, 40*time.Millisecond, report.AverageLatency(), "requests without latency should be counted as instant")
+	test.Equals(t, time.Duration(0), Report{}.AverageLatency(), "empty report should have no latency")
+}
+
 func waitForReport(t *testing.T, storage *Storage, expectedReport Report) {
 	var timeout time.Time
 	var report Report
@@ -11,10 +11,12 @@ type reportProvider interface {
 
 /*
 A component used broadcast reports to multiple consumers.
+When reports channel is closed, all reports are delivered and `Done` channel is closed.
 */
 type ReportSubscription struct {
 	reportProvider reportProvider
 	listeners      []func(r Report)
+	done           chan struct{}
 }
 
 func NewReportSubscription(reportProvider reportProvider, listeners ...func(r Report)) (*ReportSubscription, error) {
@@ -24,12 +26,17 @@ func NewReportSubscription(reportProvider reportProvider, listeners ...func(r Re
 	if reportProvider.Reports() == nil {
 		return nil, fmt.Errorf("reportProvider reports chan can't be nil")
 	}
-	result := &ReportSubscription{reportProvider: reportProvider, listeners: listeners}
+	result := &ReportSubscription{reportProvider: reportProvider, listeners: listeners, done: make(chan struct{})}
 	go result.run()
 	return result, nil
 }
 
+func (s *ReportSubscription) Done() <-chan struct{} {
+	return s.done
+}
+
 func (s *ReportSubscription) run() {
+	defer close(s.done)
 	if s.listeners == nil {
 		return
 	}
@@ -0,0 +1,336 @@
+package syslog
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"github.com/storozhukBM/logstat/common/log"
+	"github.com/storozhukBM/logstat/common/pnc"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+const (
+	maxMessageSize    = 64 * 1024
+	messageQueueSize  = 1024
+	maxFrameLenDigits = 6
+)
+
+/*
+A component used to receive syslog messages over UDP or TCP network.
+It starts separate goroutines to receive datagrams or to accept and serve TCP connections.
+
+Responsibilities:
+	- listen on address like `udp://:5514` or `tcp://127.0.0.1:5514`
+	- split TCP stream into frames using octet counting or new line delimiters (RFC 6587)
+	- extract message payload from RFC 5424 and RFC 3164 frames
+	- provide messages as lines via `ReadOneLineAsSlice`, so listener can be used instead of file reader
+
+Attention:
+	- you should cancel associated context or call `Close` to free all attached resources.
+	- `ReadOneLineAsSlice` blocks till the next message and returns `io.EOF` when listener is closed
+	- `ReadOneLineAsSlice` returns a view to internal buffer,
+	this view is only valid before the next `ReadOneLineAsSlice` call
+	- messages bigger than 64KB are dropped
+*/
+type Listener struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+	url    string
+
+	packetConn  net.PacketConn
+	tcpListener net.Listener
+
+	messages chan []byte
+	buffers  chan []byte
+	current  []byte
+
+	connectionsLock sync.Mutex
+	connections     map[net.Conn]struct{}
+	servers         sync.WaitGroup
+
+	droppedMessages uint64
+}
+
+func NewListener(ctx context.Context, listenURL string) (*Listener, error) {
+	if ctx.Err() != nil {
+		return nil, fmt.Errorf("ctx is already closed")
+	}
+	network, address, urlErr := parseListenURL(listenURL)
+	if urlErr != nil {
+		return nil, urlErr
+	}
+	listenerCtx, cancel := context.WithCancel(ctx)
+	result := &Listener{
+		ctx:    listenerCtx,
+		cancel: cancel,
+		url:    listenURL,
+
+		messages: make(chan []byte, messageQueueSize),
+		buffers:  make(chan []byte, messageQueueSize+1),
+
+		connections: make(map[net.Conn]struct{}),
+	}
+	if network == "udp" {
+		packetConn, listenErr := net.ListenPacket("udp", address)
+		if listenErr != nil {
+			cancel()
+			return nil, fmt.Errorf("can't listen on: %v; error: %v", listenURL, listenErr)
+		}
+		result.packetConn = packetConn
+		result.servers.Add(1)
+		go result.serveUDP()
+	} else {
+		tcpListener, listenErr := net.Listen("tcp", address)
+		if listenErr != nil {
+			cancel()
+			return nil, fmt.Errorf("can't listen on: %v; error: %v", listenURL, listenErr)
+		}
+		result.tcpListener = tcpListener
+		result.servers.Add(1)
+		go result.serveTCP()
+	}
+	go result.closeOnDone()
+	return result, nil
+}
+
+/*
+Network address listener is bound to. Useful if port wasn't specified explicitly.
+*/
+func (l *Listener) Addr() net.Addr {
+	if l.packetConn != nil {
+		return l.packetConn.LocalAddr()
+	}
+	return l.tcpListener.Addr()
+}
+
+func (l *Listener) ReadOneLineAsSlice() ([]byte, error) {
+	if l.current != nil {
+		l.releaseBuffer(l.current)
+		l.current = nil
+	}
+	if l.ctx.Err() != nil {
+		return nil, io.EOF
+	}
+	select {
+	case message := <-l.messages:
+		l.current = message
+		return message, nil
+	case <-l.ctx.Done():
+		return nil, io.EOF
+	}
+}
+
+/*
+Count of messages that were dropped because they were too big.
+*/
+func (l *Listener) DroppedLines() uint64 {
+	return atomic.LoadUint64(&l.droppedMessages)
+}
+
+func (l *Listener) Close() error {
+	l.cancel()
+	l.servers.Wait()
+	return nil
+}
+
+func (l *Listener) closeOnDone() {
+	<-l.ctx.Done()
+	if l.packetConn != nil {
+		log.OnError(l.packetConn.Close, "can't close syslog listener: %v", l.url)()
+		return
+	}
+	log.OnError(l.tcpListener.Close, "can't close syslog listener: %v", l.url)()
+	l.connectionsLock.Lock()
+	defer l.connectionsLock.Unlock()
+	for conn := range l.connections {
+		log.OnError(conn.Close, "can't close syslog connection: %v", conn.RemoteAddr())()
+	}
+}
+
+func (l *Listener) serveUDP() {
+	defer l.servers.Done()
+	datagram := make([]byte, maxMessageSize)
+	for l.ctx.Err() == nil {
+		size, _, readErr := l.packetConn.ReadFrom(datagram)
+		if readErr != nil {
+			if l.ctx.Err() == nil {
+				log.Error("can't receive syslog datagram: %v; error: %v", l.url, readErr)
+			}
+			continue
+		}
+		l.handleFrame(datagram[:size])
+	}
+}
+
+func (l *Listener) serveTCP() {
+	defer l.servers.Done()
+	for l.ctx.Err() == nil {
+		conn, acceptErr := l.tcpListener.Accept()
+		if acceptErr != nil {
+			if l.ctx.Err() == nil {
+				log.Error("can't accept syslog connection: %v; error: %v", l.url, acceptErr)
+			}
+			continue
+		}
+		if !l.trackConnection(conn) {
+			log.OnError(conn.Close, "can't close syslog connection: %v", conn.RemoteAddr())()
+			return
+		}
+		l.servers.Add(1)
+		go l.serveConnection(conn)
+	}
+}
+
+func (l *Listener) trackConnection(conn net.Conn) bool {
+	l.connectionsLock.Lock()
+	defer l.connectionsLock.Unlock()
+	if l.ctx.Err() != nil {
+		return false
+	}
+	l.connections[conn] = struct{}{}
+	return true
+}
+
+func (l *Listener) serveConnection(conn net.Conn) {
+	defer l.servers.Done()
+	defer func() {
+		l.connectionsLock.Lock()
+		delete(l.connections, conn)
+		l.connectionsLock.Unlock()
+		log.OnError(conn.Close, "can't close syslog connection: %v", conn.RemoteAddr())()
+	}()
+	reader := bufio.NewReaderSize(conn, maxMessageSize)
+	for l.ctx.Err() == nil {
+		frame, readErr := l.readTCPFrame(reader)
+		if readErr == io.EOF {
+			return
+		}
+		if readErr != nil {
+			if l.ctx.Err() == nil {
+				log.Error("can't read syslog frame from: %v; error: %v", conn.RemoteAddr(), readErr)
+			}
+			return
+		}
+		if frame != nil {
+			l.handleFrame(frame)
+		}
+	}
+}
+
+/*
+Octet counted frame starts with its length: `LEN SP FRAME`,
+otherwise frame should start with `<` of priority and end with new line.
+Returned frame is nil if it was dropped.
+*/
+func (l *Listener) readTCPFrame(reader *bufio.Reader) ([]byte, error) {
+	firstByte, peekErr := reader.Peek(1)
+	if peekErr != nil {
+		return nil, peekErr
+	}
+	if firstByte[0] < '1' || firstByte[0] > '9' {
+		return l.readDelimitedFrame(reader)
+	}
+	lenPart, lenErr := reader.ReadSlice(' ')
+	if lenErr != nil {
+		return nil, fmt.Errorf("can't read octet count: %v", lenErr)
+	}
+	frameLen, parseErr := parseFrameLen(lenPart[:len(lenPart)-1])
+	if parseErr != nil {
+		return nil, parseErr
+	}
+	if frameLen > maxMessageSize {
+		// connection can still be used, so we only skip this frame
+		_, discardErr := reader.Discard(frameLen)
+		atomic.AddUint64(&l.droppedMessages, 1)
+		log.Error("syslog frame is too big: %v", frameLen)
+		return nil, discardErr
+	}
+	frame, peekFrameErr := reader.Peek(frameLen)
+	if peekFrameErr != nil {
+		return nil, peekFrameErr
+	}
+	// bytes are copied in `handleFrame`, before the next read
+	_, _ = reader.Discard(frameLen)
+	return frame, nil
+}
+
+func (l *Listener) readDelimitedFrame(reader *bufio.Reader) ([]byte, error) {
+	frame, readErr := reader.ReadSlice('\n')
+	if readErr == bufio.ErrBufferFull {
+		atomic.AddUint64(&l.droppedMessages, 1)
+		log.Error("syslog frame is too big, it will be dropped")
+		for readErr == bufio.ErrBufferFull {
+			_, readErr = reader.ReadSlice('\n')
+		}
+		return nil, readErr
+	}
+	if readErr == io.EOF && len(frame) > 0 {
+		// last frame isn't required to end with new line
+		return frame, nil
+	}
+	return frame, readErr
+}
+
+func (l *Listener) handleFrame(frame []byte) {
+	defer pnc.PanicHandle()
+	message, extractErr := ExtractMessage(frame)
+	if extractErr != nil {
+		log.Error("can't extract syslog message: %v", extractErr)
+		return
+	}
+	buffer := append(l.acquireBuffer(), message...)
+	select {
+	case l.messages <- buffer:
+	case <-l.ctx.Done():
+	}
+}
+
+func (l *Listener) acquireBuffer() []byte {
+	select {
+	case buffer := <-l.buffers:
+		return buffer
+	default:
+		return make([]byte, 0, 512)
+	}
+}
+
+func (l *Listener) releaseBuffer(buffer []byte) {
+	select {
+	case l.buffers <- buffer[:0]:
+	default:
+		// there are enough buffers for the whole queue
+	}
+}
+
+func parseListenURL(listenURL string) (string, string, error) {
+	schemeEnd := strings.Index(listenURL, "://")
+	if schemeEnd == -1 {
+		return "", "", fmt.Errorf("listen url should look like `udp://:5514` or `tcp://:5514`: %v", listenURL)
+	}
+	network, address := listenURL[:schemeEnd], listenURL[schemeEnd+3:]
+	if network != "udp" && network != "tcp" {
+		return "", "", fmt.Errorf("unsupported network: %v; only udp and tcp are supported", network)
+	}
+	if address == "" {
+		return "", "", fmt.Errorf("listen address can't be empty")
+	}
+	return network, address, nil
+}
+
+func parseFrameLen(lenPart []byte) (int, error) {
+	if len(lenPart) == 0 || len(lenPart) > maxFrameLenDigits {
+		return 0, fmt.Errorf("enexpected octet count length: %v", len(lenPart))
+	}
+	result := 0
+	for _, c := range lenPart {
+		if c < '0' || c > '9' {
+			return 0, fmt.Errorf("octet count isn't a number: %q", lenPart)
+		}
+		result = result*10 + int(c-'0')
+	}
+	return result, nil
+}
@@ -0,0 +1,100 @@
+package syslog
+
+import (
+	"context"
+	"fmt"
+	"github.com/storozhukBM/logstat/common/log"
+	"github.com/storozhukBM/logstat/common/test"
+	"io"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestUDPListener(t *testing.T) {
+	t.Parallel()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	listener, listenerErr := NewListener(ctx, "udp://127.0.0.1:0")
+	test.FailOnError(t, listenerErr)
+
+	conn, dialErr := net.Dial("udp", listener.Addr().String())
+	test.FailOnError(t, dialErr)
+	defer log.OnError(conn.Close, "can't close udp connection")
+	for _, frame := range []string{
+		"<190>May  9 16:00:39 host nginx: first message",
+		"not a syslog frame",
+		"<190>1 2018-05-09T16:00:39Z host nginx - - - second message\n",
+	} {
+		_, writeErr := conn.Write([]byte(frame))
+		test.FailOnError(t, writeErr)
+	}
+
+	expectMessage(t, listener, "first message")
+	expectMessage(t, listener, "second message")
+
+	test.FailOnError(t, listener.Close())
+	expectEOF(t, listener)
+}
+
+func TestTCPListener(t *testing.T) {
+	t.Parallel()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	listener, listenerErr := NewListener(ctx, "tcp://127.0.0.1:0")
+	test.FailOnError(t, listenerErr)
+
+	conn, dialErr := net.Dial("tcp", listener.Addr().String())
+	test.FailOnError(t, dialErr)
+	octetCounted := "<190>1 2018-05-09T16:00:39Z host nginx - - - counted\nmessage"
+	stream := fmt.Sprintf("%v %v", len(octetCounted), octetCounted) +
+		"<190>May  9 16:00:39 host nginx: delimited message\n" +
+		"<190>May  9 16:00:39 host nginx: last message without delimiter"
+	_, writeErr := conn.Write([]byte(stream))
+	test.FailOnError(t, writeErr)
+	test.FailOnError(t, conn.Close())
+
+	expectMessage(t, listener, "counted\nmessage")
+	expectMessage(t, listener, "delimited message")
+	expectMessage(t, listener, "last message without delimiter")
+
+	// pending connections are closed on cancellation
+	pendingConn, pendingDialErr := net.Dial("tcp", listener.Addr().String())
+	test.FailOnError(t, pendingDialErr)
+	defer log.OnError(pendingConn.Close, "can't close tcp connection")
+	cancel()
+	test.FailOnError(t, listener.Close())
+	expectEOF(t, listener)
+}
+
+func TestListenerURL(t *testing.T) {
+	t.Parallel()
+	for _, listenURL := range []string{"", ":5514", "unix://:5514", "udp://"} {
+		_, listenerErr := NewListener(context.Background(), listenURL)
+		test.Equals(t, true, listenerErr != nil, "url should be rejected: %v", listenURL)
+	}
+}
+
+func expectMessage(t *testing.T, listener *Listener, expMessage string) {
+	messages := make(chan []byte)
+	go func() {
+		message, readErr := listener.ReadOneLineAsSlice()
+		if readErr != nil {
+			close(messages)
+			return
+		}
+		messages <- message
+	}()
+	select {
+	case message := <-messages:
+		test.Equals(t, expMessage, string(message), "unexpected message")
+	case <-time.After(5 * time.Second):
+		t.Fatalf("message wasn't received: %v", expMessage)
+	}
+}
+
+func expectEOF(t *testing.T, listener *Listener) {
+	message, readErr := listener.ReadOneLineAsSlice()
+	test.Equals(t, []byte(nil), message, "message should be empty")
+	test.Equals(t, io.EOF, readErr, "listener should be closed")
+}
@@ -0,0 +1,171 @@
+package syslog
+
+import (
+	"bytes"
+	"fmt"
+)
+
+const (
+	maxPriorityLen    = 5  // `<191>`
+	rfc3164TimeLen    = 15 // `Jan _2 15:04:05`
+	maxRFC3164TagLen  = 48 // tag is limited by 32 chars, but some senders add pid in brackets after it
+	rfc5424HeaderSize = 5  // TIMESTAMP HOSTNAME APP-NAME PROCID MSGID
+)
+
+var utf8BOM = []byte("\xEF\xBB\xBF")
+
+/*
+Extracts message payload from syslog frame in RFC 5424 or RFC 3164 format.
+Returned payload is a view to the frame bytes, so there are no allocations.
+
+RFC 5424: `<PRI>VERSION TIMESTAMP HOSTNAME APP-NAME PROCID MSGID STRUCTURED-DATA MSG`
+RFC 3164: `<PRI>Mmm dd hh:mm:ss HOSTNAME TAG: MSG`
+
+Attention:
+	- RFC 3164 frames are widely malformed by senders, so hostname and tag are skipped only if they look like them
+*/
+func ExtractMessage(frame []byte) ([]byte, error) {
+	frame = bytes.TrimRight(frame, "\r\n\x00")
+	headerStart, priorityErr := skipPriority(frame)
+	if priorityErr != nil {
+		return nil, priorityErr
+	}
+	header := frame[headerStart:]
+	if len(header) >= 2 && header[0] >= '1' && header[0] <= '9' && header[1] == ' ' {
+		return extractRFC5424Message(header[2:])
+	}
+	return extractRFC3164Message(header), nil
+}
+
+func skipPriority(frame []byte) (int, error) {
+	if len(frame) == 0 || frame[0] != '<' {
+		return 0, fmt.Errorf("enexpected format of frame. missed `<` in priority part")
+	}
+	priorityEnd := bytes.IndexByte(frame[:minInt(len(frame), maxPriorityLen)], '>')
+	if priorityEnd < 2 {
+		return 0, fmt.Errorf("enexpected format of frame. can't parse priority part end")
+	}
+	for _, c := range frame[1:priorityEnd] {
+		if c < '0' || c > '9' {
+			return 0, fmt.Errorf("enexpected format of frame. priority isn't a number")
+		}
+	}
+	return priorityEnd + 1, nil
+}
+
+func extractRFC5424Message(header []byte) ([]byte, error) {
+	for i := 0; i < rfc5424HeaderSize; i++ {
+		fieldEnd := bytes.IndexByte(header, ' ')
+		if fieldEnd == -1 {
+			return nil, fmt.Errorf("enexpected format of frame. header is cropped")
+		}
+		header = header[fieldEnd+1:]
+	}
+	message, structuredDataErr := skipStructuredData(header)
+	if structuredDataErr != nil {
+		return nil, structuredDataErr
+	}
+	return bytes.TrimPrefix(message, utf8BOM), nil
+}
+
+/*
+Structured data is either `-` or sequence of `[id param="value"]` elements,
+where value can contain escaped `\]` and `\"`.
+*/
+func skipStructuredData(data []byte) ([]byte, error) {
+	if len(data) == 0 {
+		return nil, fmt.Errorf("enexpected format of frame. missed structured data")
+	}
+	if data[0] == '-' {
+		return skipSpace(data[1:]), nil
+	}
+	for len(data) > 0 && data[0] == '[' {
+		elementEnd := findStructuredDataElementEnd(data)
+		if elementEnd == -1 {
+			return nil, fmt.Errorf("enexpected format of frame. can't parse structured data end")
+		}
+		data = data[elementEnd+1:]
+	}
+	return skipSpace(data), nil
+}
+
+func findStructuredDataElementEnd(data []byte) int {
+	inValue := false
+	for i := 1; i < len(data); i++ {
+		switch data[i] {
+		case '\\':
+			if inValue {
+				i++ // skip escaped char
+			}
+		case '"':
+			inValue = !inValue
+		case ']':
+			if !inValue {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+func extractRFC3164Message(header []byte) []byte {
+	if !looksLikeRFC3164Time(header) {
+		// timestamp is absent, so the rest of frame is a message
+		return header
+	}
+	header = skipSpace(header[rfc3164TimeLen:])
+	hostnameEnd := bytes.IndexByte(header, ' ')
+	if hostnameEnd == -1 {
+		return header
+	}
+	if tagEnd := findRFC3164TagEnd(header); tagEnd != -1 {
+		// hostname is omitted by some senders, like local rsyslog
+		return skipSpace(header[tagEnd+1:])
+	}
+	message := skipSpace(header[hostnameEnd+1:])
+	if tagEnd := findRFC3164TagEnd(message); tagEnd != -1 {
+		return skipSpace(message[tagEnd+1:])
+	}
+	return message
+}
+
+/*
+Tag is an alphanumeric name, optionally with `[pid]`, that ends with `:` and is followed by space.
+*/
+func findRFC3164TagEnd(data []byte) int {
+	limit := minInt(len(data), maxRFC3164TagLen)
+	for i := 0; i < limit; i++ {
+		c := data[i]
+		if c == ' ' {
+			return -1
+		}
+		if c == ':' {
+			if i == 0 || (i+1 < len(data) && data[i+1] != ' ') {
+				return -1
+			}
+			return i
+		}
+	}
+	return -1
+}
+
+func looksLikeRFC3164Time(header []byte) bool {
+	if len(header) < rfc3164TimeLen+1 {
+		return false
+	}
+	return header[3] == ' ' && header[6] == ' ' && header[9] == ':' && header[12] == ':' && header[rfc3164TimeLen] == ' '
+}
+
+func skipSpace(data []byte) []byte {
+	if len(data) > 0 && data[0] == ' ' {
+		return data[1:]
+	}
+	return data
+}
+
+func minInt(a int, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
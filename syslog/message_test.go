@@ -0,0 +1,52 @@
+package syslog
+
+import (
+	"github.com/storozhukBM/logstat/common/test"
+	"testing"
+)
+
+const accessLogLine = `127.0.0.1 - james [09/May/2018:16:00:39 +0000] "GET /report HTTP/1.0" 200 123`
+
+func TestExtractMessage(t *testing.T) {
+	t.Parallel()
+	cases := []struct {
+		name  string
+		frame string
+		exp   string
+	}{
+		{"rfc5424", "<190>1 2018-05-09T16:00:39.000Z host nginx 123 - - " + accessLogLine, accessLogLine},
+		{"rfc5424 with bom", "<190>1 2018-05-09T16:00:39Z host nginx - - - \xEF\xBB\xBF" + accessLogLine + "\n", accessLogLine},
+		{
+			"rfc5424 with structured data",
+			`<190>1 2018-05-09T16:00:39Z host nginx - ID47 [exampleSDID@32473 iut="3" eventSource="App\]"][meta x="\"y"] ` + accessLogLine,
+			accessLogLine,
+		},
+		{"rfc5424 without message", "<190>1 2018-05-09T16:00:39Z host nginx - - -", ""},
+		{"rfc3164", "<190>May  9 16:00:39 host nginx: " + accessLogLine + "\r\n", accessLogLine},
+		{"rfc3164 with pid", "<190>May  9 16:00:39 host nginx[123]: " + accessLogLine, accessLogLine},
+		{"rfc3164 without hostname", "<190>May  9 16:00:39 nginx: " + accessLogLine, accessLogLine},
+		{"rfc3164 without tag", "<190>May  9 16:00:39 host " + accessLogLine, accessLogLine},
+		{"rfc3164 without header", "<13>" + accessLogLine, accessLogLine},
+	}
+	for _, c := range cases {
+		message, extractErr := ExtractMessage([]byte(c.frame))
+		test.FailOnError(t, extractErr)
+		test.Equals(t, c.exp, string(message), "unexpected message in case: %v", c.name)
+	}
+}
+
+func TestExtractMessageErrors(t *testing.T) {
+	t.Parallel()
+	frames := []string{
+		"",
+		accessLogLine,
+		"<>1 2018-05-09T16:00:39Z host nginx - - - msg",
+		"<1x0>May  9 16:00:39 host nginx: msg",
+		"<190>1 2018-05-09T16:00:39Z host",
+		`<190>1 2018-05-09T16:00:39Z host nginx - - [id x="]`,
+	}
+	for _, frame := range frames {
+		_, extractErr := ExtractMessage([]byte(frame))
+		test.Equals(t, true, extractErr != nil, "frame should be rejected: %q", frame)
+	}
+}
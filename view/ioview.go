@@ -19,9 +19,10 @@ const sep = "_________________________________"
 A component used to visualize reports and print alerts to the specified writer.
 
 Responsibilities:
-	- print stats reports
+	- print stats reports, latency is printed only if log format has it
 	- print alerts
 	- print heartbeats in case of no other events
+	- print all pending reports and alerts on `Close`
 
 Attention:
 	- this component allocated a lot, but it shouldn't be a problem
@@ -40,6 +41,8 @@ type IOView struct {
 	lastTrafficAlert *alert.TrafficAlert
 	alerts           chan alert.TrafficAlert
 	reports          chan stat.Report
+	closing          chan struct{}
+	done             chan struct{}
 }
 
 func NewIOView(ctx context.Context, refreshPeriod time.Duration, output io.Writer) (*IOView, error) {
@@ -54,6 +57,8 @@ func NewIOView(ctx context.Context, refreshPeriod time.Duration, output io.Write
 		lastTrafficAlert: nil,
 		alerts:           make(chan alert.TrafficAlert, 8),
 		reports:          make(chan stat.Report, 8),
+		closing:          make(chan struct{}),
+		done:             make(chan struct{}),
 	}
 	go result.run()
 	return result, nil
@@ -67,7 +72,18 @@ func (v *IOView) Report(r stat.Report) {
 	v.reports <- r
 }
 
+/*
+Prints all pending reports and alerts and stops the view.
+Should be called only when all report and alert producers are stopped.
+*/
+func (v *IOView) Close() error {
+	close(v.closing)
+	<-v.done
+	return nil
+}
+
 func (v *IOView) run() {
+	defer close(v.done)
 	cycle := func() {
 		defer pnc.PanicHandle()
 		select {
@@ -77,17 +93,39 @@ func (v *IOView) run() {
 			v.printReport(r)
 		case <-time.After(v.refreshPeriod):
 			v.printNoTrafficReport()
+		case <-v.closing:
 		case <-v.ctx.Done():
 			return
 		}
 	}
 	for v.ctx.Err() == nil {
+		select {
+		case <-v.closing:
+			v.printPending()
+			return
+		default:
+		}
 		cycle()
 	}
 }
 
+func (v *IOView) printPending() {
+	defer pnc.PanicHandle()
+	for {
+		select {
+		case a := <-v.alerts:
+			v.printTrafficAlert(a)
+		case r := <-v.reports:
+			v.printReport(r)
+		default:
+			return
+		}
+	}
+}
+
 func (v *IOView) printReport(r stat.Report) {
 	v.printReportSummary(r)
+	v.printSourceTop(r)
 	v.printSectionTop(r)
 	v.printStatusCodeTop(r)
 }
@@ -105,6 +143,11 @@ func (v *IOView) printReportSummary(r stat.Report) {
 	v.printRowToTable(w, "| Server Time\t %v\n", time.Unix(r.CycleStartUnixTime, 0).UTC())
 	v.printRowToTable(w, "|%s\t%s\n", sep, sep)
 
+	if r.Source != "" {
+		v.printRowToTable(w, "| Source\t %v\n", r.Source)
+		v.printRowToTable(w, "|%s\t%s\n", sep, sep)
+	}
+
 	v.printRowToTable(w, "| Total Requests\t %29d\n", r.TotalRequests)
 	v.printRowToTable(w, "|%s\t%s\n", sep, sep)
 
@@ -120,6 +163,55 @@ func (v *IOView) printReportSummary(r stat.Report) {
 	v.printRowToTable(w, "| Average Response Size [KBs/req]\t %29.4f\n", KBPerRequest)
 	v.printRowToTable(w, "|%s\t%s\n", sep, sep)
 
+	// log formats without latency have none in any record
+	if r.MaxLatency > 0 {
+		v.printRowToTable(w, "| Average Latency [ms]\t %29.4f\n", durationToMillis(r.AverageLatency()))
+		v.printRowToTable(w, "|%s\t%s\n", sep, sep)
+
+		v.printRowToTable(w, "| Max Latency [ms]\t %29.4f\n", durationToMillis(r.MaxLatency))
+		v.printRowToTable(w, "|%s\t%s\n", sep, sep)
+	}
+
+	if r.DroppedLines > 0 {
+		v.printRowToTable(w, "| Dropped Too Long Lines\t %29d\n", r.DroppedLines)
+		v.printRowToTable(w, "|%s\t%s\n", sep, sep)
+	}
+
+	v.finishTable(w)
+}
+
+func durationToMillis(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
+
+func (v *IOView) printSourceTop(r stat.Report) {
+	type sourceHit struct {
+		source string
+		hits   uint64
+	}
+	var sourceHits []sourceHit
+	r.IterRequestsPerSource(func(source string, requests uint64) {
+		sourceHits = append(sourceHits, sourceHit{source: source, hits: requests})
+	})
+	// there is nothing to compare if all requests came from one source
+	if len(sourceHits) < 2 {
+		return
+	}
+	sort.Slice(sourceHits, func(i, j int) bool {
+		return sourceHits[i].hits > sourceHits[j].hits
+	})
+
+	_, _ = fmt.Fprintf(v.output, "|\n| Source TOP\n")
+	w := v.newTable()
+	v.printRowToTable(w, "|%s\t%s\n", sep, sep)
+
+	v.printRowToTable(w, "| Source\t Requests\n")
+	v.printRowToTable(w, "|%s\t%s\n", sep, sep)
+
+	for _, sourceHit := range sourceHits {
+		v.printRowToTable(w, "| %v\t %29d\n", sourceHit.source, sourceHit.hits)
+		v.printRowToTable(w, "|%s\t%s\n", sep, sep)
+	}
 	v.finishTable(w)
 }
 
@@ -195,6 +287,9 @@ func (v *IOView) printTrafficAlert(a alert.TrafficAlert) {
 		_, _ = fmt.Fprintf(v.output, "[ALERT] ")
 		v.lastTrafficAlert = &a
 	}
+	if a.Source != "" {
+		_, _ = fmt.Fprintf(v.output, "Source: %v; ", a.Source)
+	}
 	_, _ = fmt.Fprintf(
 		v.output, "Time: %+v; Max Average Requests Rate [req/sec]: %.4f; Observed Average Requests Rate: %.4f\n",
 		time.Unix(a.WindowEndUnixTime, 0).UTC(), maxAllowedReqPerSecond, observedReqPerSecond,
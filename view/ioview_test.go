@@ -6,6 +6,7 @@ import (
 	"github.com/storozhukBM/logstat/alert"
 	"github.com/storozhukBM/logstat/common/test"
 	"github.com/storozhukBM/logstat/stat"
+	"strings"
 	"sync"
 	"testing"
 	"time"
@@ -65,6 +66,7 @@ func TestIOReport(t *testing.T) {
 	report := stat.BuildReport(
 		map[string]uint64{"/report": 3, "/api": 10, "/user": 32},
 		map[int32]uint64{200: 15, 201: 20, 400: 10},
+		nil,
 	)
 	report.CycleDurationInSeconds = 10
 	report.CycleOffset = 30
@@ -77,6 +79,30 @@ func TestIOReport(t *testing.T) {
 	test.Equals(t, expectedReport, string(reportBuf.Bytes()), "report")
 }
 
+func TestIOReportLatency(t *testing.T) {
+	t.Parallel()
+	reportBuf := &syncByteBuff{buf: bytes.NewBuffer(nil)}
+	v, vErr := NewIOView(context.Background(), 10*time.Second, reportBuf)
+	test.FailOnError(t, vErr)
+
+	report := stat.BuildReport(nil, nil, nil)
+	report.CycleDurationInSeconds = 10
+	report.TotalRequests = 4
+	report.TotalLatency = 250 * time.Millisecond
+	report.MaxLatency = 150500 * time.Microsecond
+
+	v.Report(report)
+	test.FailOnError(t, v.Close())
+	output := string(reportBuf.Bytes())
+	expectedRows := []string{
+		"| Average Latency [ms]                                    62.5000\n",
+		"| Max Latency [ms]                                       150.5000\n",
+	}
+	for _, row := range expectedRows {
+		test.Equals(t, true, strings.Contains(output, row), "report should contain row `%v`:\n%v", row, output)
+	}
+}
+
 const expAlert = "[ALERT] Time: 1970-01-01 00:02:00 +0000 UTC; Max Average Requests Rate [req/sec]: 1.2500; Observed Average Requests Rate: 2.5000\n"
 const expResolved = "[RESOLVED] Time: 1970-01-01 00:02:10 +0000 UTC; Max Average Requests Rate [req/sec]: 1.2500; Observed Average Requests Rate: 1.2417\n"
 
@@ -113,6 +139,24 @@ func TestIOAlert(t *testing.T) {
 	}
 }
 
+func TestIOViewClose(t *testing.T) {
+	t.Parallel()
+	buf := &syncByteBuff{buf: bytes.NewBuffer(nil)}
+	v, vErr := NewIOView(context.Background(), 10*time.Second, buf)
+	test.FailOnError(t, vErr)
+
+	v.TrafficAlert(alert.TrafficAlert{
+		AlertID:                  1,
+		Resolved:                 false,
+		MaxAllowedRequests:       150,
+		ObservedInWindowRequests: 300,
+		WindowStartUnixTime:      0,
+		WindowEndUnixTime:        120,
+	})
+	test.FailOnError(t, v.Close())
+	test.Equals(t, []byte(expAlert), buf.Bytes(), "alert should be printed before close")
+}
+
 type syncByteBuff struct {
 	mu  sync.Mutex
 	buf *bytes.Buffer
@@ -0,0 +1,132 @@
+package watcher
+
+import (
+	"context"
+	"fmt"
+	"github.com/storozhukBM/logstat/common/log"
+	"github.com/storozhukBM/logstat/common/pnc"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+/*
+Starts watching of one file, returns channel that is closed when watching is finished.
+*/
+type FileStarter func(ctx context.Context, fileName string) (<-chan struct{}, error)
+
+/*
+A component used to watch several files specified by paths or glob patterns.
+It starts separate goroutine to track new files that match patterns.
+
+Responsibilities:
+	- expand glob patterns into file names
+	- start watching of every newly matched file via provided `FileStarter`
+	- periodically rescan patterns to pick up new files, or scan them only once if rescan period is zero
+	- signal via `Done` channel when all started files are finished
+
+Attention:
+	- you should cancel associated context to free all attached resources.
+	- paths without glob meta characters are watched even if file doesn't exist yet,
+	so absent file is handled by file watcher itself
+	- files that are no longer matched are still watched, because they can be recreated by rotation
+*/
+type GlobWatcher struct {
+	ctx          context.Context
+	patterns     []string
+	rescanPeriod time.Duration
+	startFile    FileStarter
+
+	started map[string]<-chan struct{}
+	done    chan struct{}
+}
+
+func NewGlobWatcher(ctx context.Context, patterns []string, rescanPeriod time.Duration, startFile FileStarter) (*GlobWatcher, error) {
+	if ctx.Err() != nil {
+		return nil, fmt.Errorf("ctx is already closed")
+	}
+	if len(patterns) == 0 {
+		return nil, fmt.Errorf("patterns can't be empty")
+	}
+	if startFile == nil {
+		return nil, fmt.Errorf("startFile can't be nil")
+	}
+	for _, pattern := range patterns {
+		_, patternErr := filepath.Match(pattern, "")
+		if patternErr != nil {
+			return nil, fmt.Errorf("invalid pattern: %v; error: %v", pattern, patternErr)
+		}
+	}
+	result := &GlobWatcher{
+		ctx:          ctx,
+		patterns:     patterns,
+		rescanPeriod: rescanPeriod,
+		startFile:    startFile,
+
+		started: make(map[string]<-chan struct{}),
+		done:    make(chan struct{}),
+	}
+	go result.run()
+	return result, nil
+}
+
+/*
+Channel that is closed when watching of all started files is finished.
+*/
+func (g *GlobWatcher) Done() <-chan struct{} {
+	return g.done
+}
+
+func HasGlobMeta(pattern string) bool {
+	return strings.ContainsAny(pattern, "*?[")
+}
+
+func (g *GlobWatcher) run() {
+	defer close(g.done)
+	g.scan()
+	for g.rescanPeriod > 0 && g.ctx.Err() == nil {
+		select {
+		case <-time.After(g.rescanPeriod):
+			g.scan()
+		case <-g.ctx.Done():
+		}
+	}
+	for _, fileDone := range g.started {
+		<-fileDone
+	}
+}
+
+func (g *GlobWatcher) scan() {
+	for _, pattern := range g.patterns {
+		if g.ctx.Err() != nil {
+			return
+		}
+		if !HasGlobMeta(pattern) {
+			g.tryStartFile(pattern)
+			continue
+		}
+		fileNames, globErr := filepath.Glob(pattern)
+		if globErr != nil {
+			log.Error("can't expand pattern: %v; error: %v", pattern, globErr)
+			continue
+		}
+		for _, fileName := range fileNames {
+			g.tryStartFile(fileName)
+		}
+	}
+}
+
+func (g *GlobWatcher) tryStartFile(fileName string) {
+	defer pnc.PanicHandle()
+	if _, ok := g.started[fileName]; ok {
+		return
+	}
+	fileDone, startErr := g.startFile(g.ctx, fileName)
+	if startErr != nil {
+		// we will try again on the next scan
+		log.Error("can't start watching file: %v; error: %v", fileName, startErr)
+		return
+	}
+	log.Debug("started watching file: %v", fileName)
+	g.started[fileName] = fileDone
+}
@@ -0,0 +1,104 @@
+package watcher
+
+import (
+	"context"
+	"fmt"
+	"github.com/storozhukBM/logstat/common/test"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestGlobWatcher(t *testing.T) {
+	t.Parallel()
+	dir, dirErr := ioutil.TempDir("", "test_glob_watcher")
+	test.FailOnError(t, dirErr)
+	defer os.RemoveAll(dir)
+	test.FailOnError(t, ioutil.WriteFile(filepath.Join(dir, "a.access.log"), nil, 0644))
+	test.FailOnError(t, ioutil.WriteFile(filepath.Join(dir, "a.error.log"), nil, 0644))
+
+	starter := newFileStarterMock()
+	ctx, cancel := context.WithCancel(context.Background())
+	patterns := []string{filepath.Join(dir, "*.access.log"), filepath.Join(dir, "absent.log")}
+	globWatcher, globWatcherErr := NewGlobWatcher(ctx, patterns, 5*time.Millisecond, starter.start)
+	test.FailOnError(t, globWatcherErr)
+
+	time.Sleep(20 * time.Millisecond)
+	test.Equals(
+		t, []string{filepath.Join(dir, "a.access.log"), filepath.Join(dir, "absent.log")},
+		starter.startedFiles(), "initially matched files",
+	)
+
+	test.FailOnError(t, ioutil.WriteFile(filepath.Join(dir, "b.access.log"), nil, 0644))
+	time.Sleep(20 * time.Millisecond)
+	test.Equals(
+		t, []string{filepath.Join(dir, "a.access.log"), filepath.Join(dir, "absent.log"), filepath.Join(dir, "b.access.log")},
+		starter.startedFiles(), "new file should be picked up",
+	)
+
+	cancel()
+	select {
+	case <-globWatcher.Done():
+	case <-time.After(time.Second):
+		test.FailOnError(t, fmt.Errorf("glob watcher should be done after cancel"))
+	}
+}
+
+func TestGlobWatcherSingleScan(t *testing.T) {
+	t.Parallel()
+	dir, dirErr := ioutil.TempDir("", "test_glob_watcher_single_scan")
+	test.FailOnError(t, dirErr)
+	defer os.RemoveAll(dir)
+	test.FailOnError(t, ioutil.WriteFile(filepath.Join(dir, "a.access.log"), nil, 0644))
+
+	starter := newFileStarterMock()
+	starter.finishImmediately = true
+	globWatcher, globWatcherErr := NewGlobWatcher(
+		context.Background(), []string{filepath.Join(dir, "*.log")}, 0, starter.start,
+	)
+	test.FailOnError(t, globWatcherErr)
+
+	select {
+	case <-globWatcher.Done():
+	case <-time.After(time.Second):
+		test.FailOnError(t, fmt.Errorf("glob watcher should be done when all files are finished"))
+	}
+	test.Equals(t, []string{filepath.Join(dir, "a.access.log")}, starter.startedFiles(), "matched files")
+
+	_, patternErr := NewGlobWatcher(context.Background(), []string{"[invalid"}, 0, starter.start)
+	test.Equals(t, true, patternErr != nil, "invalid pattern should be rejected")
+}
+
+type fileStarterMock struct {
+	mu                sync.Mutex
+	finishImmediately bool
+	started           []string
+}
+
+func newFileStarterMock() *fileStarterMock {
+	return &fileStarterMock{}
+}
+
+func (s *fileStarterMock) start(ctx context.Context, fileName string) (<-chan struct{}, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.started = append(s.started, fileName)
+	if s.finishImmediately {
+		done := make(chan struct{})
+		close(done)
+		return done, nil
+	}
+	return ctx.Done(), nil
+}
+
+func (s *fileStarterMock) startedFiles() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	result := append([]string(nil), s.started...)
+	sort.Strings(result)
+	return result
+}
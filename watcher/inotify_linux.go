@@ -0,0 +1,188 @@
+//go:build linux
+// +build linux
+
+package watcher
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"github.com/storozhukBM/logstat/common/log"
+	"github.com/storozhukBM/logstat/common/pnc"
+	"os"
+	"path/filepath"
+	"syscall"
+	"unsafe"
+)
+
+const (
+	inotifyFileEvents = syscall.IN_MODIFY | syscall.IN_ATTRIB | syscall.IN_MOVE_SELF | syscall.IN_DELETE_SELF
+	inotifyDirEvents  = syscall.IN_CREATE | syscall.IN_MOVED_TO
+	inotifyBufSize    = 64 * (syscall.SizeofInotifyEvent + syscall.NAME_MAX + 1)
+	noWatch           = -1
+)
+
+/*
+A component used to notify about changes of the file using linux inotify API.
+It starts separate goroutine to read inotify events.
+
+Responsibilities:
+	- watch file for modifications, moves and deletions
+	- watch parent directory for creation of the file, so rotated file will be watched again
+	- keep watching previous file after rotation, so its remaining lines can be drained
+	- coalesce all relevant events into non-blocking change notifications
+
+Attention:
+	- you should cancel associated context to free all attached resources.
+	- inotify doesn't work on some filesystems (NFS, FUSE, etc.),
+	so it should be used in combination with some fallback polling.
+*/
+type InotifyNotifier struct {
+	ctx      context.Context
+	fileName string
+	baseName []byte
+
+	inotifyFd     int
+	inotifyFile   *os.File
+	dirWatch      int
+	fileWatch     int
+	prevFileWatch int
+	changes       chan struct{}
+}
+
+func NewInotifyNotifier(ctx context.Context, fileName string) (*InotifyNotifier, error) {
+	if ctx.Err() != nil {
+		return nil, fmt.Errorf("ctx is already closed")
+	}
+	if fileName == "" {
+		return nil, fmt.Errorf("fileName can't be empty")
+	}
+	fd, initErr := syscall.InotifyInit1(syscall.IN_CLOEXEC | syscall.IN_NONBLOCK)
+	if initErr != nil {
+		return nil, fmt.Errorf("can't init inotify: %v", initErr)
+	}
+	dirWatch, dirWatchErr := syscall.InotifyAddWatch(fd, filepath.Dir(fileName), inotifyDirEvents)
+	if dirWatchErr != nil {
+		_ = syscall.Close(fd)
+		return nil, fmt.Errorf("can't watch directory of file: %v; error: %v", fileName, dirWatchErr)
+	}
+	result := &InotifyNotifier{
+		ctx:      ctx,
+		fileName: fileName,
+		baseName: []byte(filepath.Base(fileName)),
+
+		inotifyFd: fd,
+		// non-blocking descriptor is registered in runtime poller, so `Close` will unblock pending `Read`
+		inotifyFile:   os.NewFile(uintptr(fd), "inotify"),
+		dirWatch:      dirWatch,
+		fileWatch:     noWatch,
+		prevFileWatch: noWatch,
+		changes:       make(chan struct{}, 1),
+	}
+	result.watchFile()
+	go result.closeOnDone()
+	go result.run()
+	return result, nil
+}
+
+func (n *InotifyNotifier) Changes() <-chan struct{} {
+	return n.changes
+}
+
+func (n *InotifyNotifier) closeOnDone() {
+	<-n.ctx.Done()
+	log.OnError(n.inotifyFile.Close, "can't close inotify for file: %v", n.fileName)()
+}
+
+func (n *InotifyNotifier) run() {
+	buf := make([]byte, inotifyBufSize)
+	for n.ctx.Err() == nil {
+		readErr := n.readEvents(buf)
+		if readErr != nil && n.ctx.Err() == nil {
+			log.Error("can't read inotify events: %v", readErr)
+			return
+		}
+	}
+}
+
+func (n *InotifyNotifier) readEvents(buf []byte) error {
+	defer pnc.PanicHandle()
+	size, readErr := n.inotifyFile.Read(buf)
+	if readErr != nil {
+		return readErr
+	}
+	offset := 0
+	for offset+syscall.SizeofInotifyEvent <= size {
+		event := (*syscall.InotifyEvent)(unsafe.Pointer(&buf[offset]))
+		nameStart := offset + syscall.SizeofInotifyEvent
+		nameEnd := nameStart + int(event.Len)
+		if nameEnd > size {
+			return fmt.Errorf("inotify event is cropped")
+		}
+		name := bytes.TrimRight(buf[nameStart:nameEnd], "\x00")
+		n.handleEvent(event, name)
+		offset = nameEnd
+	}
+	return nil
+}
+
+func (n *InotifyNotifier) handleEvent(event *syscall.InotifyEvent, name []byte) {
+	if event.Mask&syscall.IN_Q_OVERFLOW != 0 {
+		log.Debug("inotify queue overflow: %v", n.fileName)
+		n.notify()
+		return
+	}
+	if int(event.Wd) == n.dirWatch {
+		if !bytes.Equal(name, n.baseName) {
+			return
+		}
+		log.Debug("file was created: %v", n.fileName)
+		n.watchFile()
+		n.notify()
+		return
+	}
+	if int(event.Wd) == n.prevFileWatch {
+		if event.Mask&syscall.IN_IGNORED != 0 {
+			log.Debug("rotated file watch was removed: %v", n.fileName)
+			n.prevFileWatch = noWatch
+		}
+		n.notify()
+		return
+	}
+	if int(event.Wd) != n.fileWatch {
+		return
+	}
+	if event.Mask&syscall.IN_IGNORED != 0 {
+		log.Debug("file watch was removed: %v", n.fileName)
+		n.fileWatch = noWatch
+	}
+	n.notify()
+}
+
+func (n *InotifyNotifier) watchFile() {
+	fileWatch, fileWatchErr := syscall.InotifyAddWatch(n.inotifyFd, n.fileName, inotifyFileEvents)
+	if fileWatchErr != nil {
+		// file can be absent for now, we will get notified from directory watch
+		log.Debug("can't watch file: %v; error: %v", n.fileName, fileWatchErr)
+		return
+	}
+	if fileWatch == n.fileWatch {
+		// the same file, watch descriptor is reused by kernel
+		return
+	}
+	if n.prevFileWatch != noWatch && n.prevFileWatch != fileWatch {
+		// file was rotated twice, so the oldest one shouldn't have any new lines
+		_, _ = syscall.InotifyRmWatch(n.inotifyFd, uint32(n.prevFileWatch))
+	}
+	// rotated file is still watched, so reader can drain lines appended after rotation
+	n.prevFileWatch = n.fileWatch
+	n.fileWatch = fileWatch
+}
+
+func (n *InotifyNotifier) notify() {
+	select {
+	case n.changes <- struct{}{}:
+	default:
+		// there is already pending notification
+	}
+}
@@ -0,0 +1,89 @@
+//go:build linux
+// +build linux
+
+package watcher
+
+import (
+	"context"
+	"fmt"
+	"github.com/storozhukBM/logstat/common/test"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestInotifyNotifier(t *testing.T) {
+	t.Parallel()
+	dir, dirErr := ioutil.TempDir("", "test_inotify_notifier")
+	test.FailOnError(t, dirErr)
+	defer os.RemoveAll(dir)
+	fileName := filepath.Join(dir, "access.log")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	notifier, notifierErr := NewInotifyNotifier(ctx, fileName)
+	test.FailOnError(t, notifierErr)
+	waitForNoChange(t, notifier)
+
+	test.FailOnError(t, ioutil.WriteFile(fileName, []byte("first line\n"), 0644))
+	waitForChange(t, notifier)
+	drainChanges(notifier)
+
+	appendLine(t, fileName, "second line")
+	waitForChange(t, notifier)
+	drainChanges(notifier)
+
+	test.FailOnError(t, ioutil.WriteFile(filepath.Join(dir, "other.log"), []byte("other line\n"), 0644))
+	waitForNoChange(t, notifier)
+
+	test.FailOnError(t, os.Rename(fileName, fileName+".1"))
+	waitForChange(t, notifier)
+	drainChanges(notifier)
+
+	test.FailOnError(t, ioutil.WriteFile(fileName, []byte("rotated line\n"), 0644))
+	waitForChange(t, notifier)
+	drainChanges(notifier)
+
+	appendLine(t, fileName, "next rotated line")
+	waitForChange(t, notifier)
+	drainChanges(notifier)
+
+	// writer can still append to the rotated file
+	appendLine(t, fileName+".1", "late line")
+	waitForChange(t, notifier)
+	drainChanges(notifier)
+}
+
+func appendLine(t *testing.T, fileName string, line string) {
+	f, openErr := os.OpenFile(fileName, os.O_APPEND|os.O_WRONLY, 0644)
+	test.FailOnError(t, openErr)
+	defer f.Close()
+	_, writeErr := f.WriteString(line + "\n")
+	test.FailOnError(t, writeErr)
+}
+
+func waitForChange(t *testing.T, notifier *InotifyNotifier) {
+	select {
+	case <-notifier.Changes():
+	case <-time.After(time.Second):
+		test.FailOnError(t, fmt.Errorf("change notification timeout"))
+	}
+}
+
+func waitForNoChange(t *testing.T, notifier *InotifyNotifier) {
+	select {
+	case <-notifier.Changes():
+		test.FailOnError(t, fmt.Errorf("unexpected change notification"))
+	case <-time.After(20 * time.Millisecond):
+	}
+}
+
+func drainChanges(notifier *InotifyNotifier) {
+	time.Sleep(20 * time.Millisecond)
+	select {
+	case <-notifier.Changes():
+	default:
+	}
+}
@@ -0,0 +1,25 @@
+//go:build !linux
+// +build !linux
+
+package watcher
+
+import (
+	"context"
+	"fmt"
+)
+
+/*
+Stub of inotify based notifier for platforms without inotify API.
+Its constructor always fails, so callers should fall back to polling.
+*/
+type InotifyNotifier struct {
+	changes chan struct{}
+}
+
+func NewInotifyNotifier(ctx context.Context, fileName string) (*InotifyNotifier, error) {
+	return nil, fmt.Errorf("inotify isn't supported on this platform")
+}
+
+func (n *InotifyNotifier) Changes() <-chan struct{} {
+	return n.changes
+}
@@ -0,0 +1,139 @@
+package watcher
+
+import (
+	"context"
+	"fmt"
+	"github.com/storozhukBM/logstat/common/log"
+	"github.com/storozhukBM/logstat/common/pnc"
+	"github.com/storozhukBM/logstat/stat"
+	"sync"
+)
+
+/*
+Reads, parses and stores all lines of one chunk into the provided shard, returns when chunk is finished.
+*/
+type ChunkReader func(ctx context.Context, chunkIdx int, shard *stat.Shard) error
+
+type shardedStorage interface {
+	NewShard() *stat.Shard
+	MergeShard(shard *stat.Shard)
+}
+
+/*
+A component used to read huge batch file in parallel by chunks.
+It starts separate goroutines for workers and merge of their results.
+
+Responsibilities:
+	- read chunks by several workers via provided `ChunkReader`
+	- give each chunk its own shard of storage, so chunks are aggregated independently
+	- merge shards into storage in the order of chunks, so reports are the same as after sequential reading
+	- limit amount of chunks that are read ahead of merge, so memory isn't exhausted by not merged shards
+	- signal via `Done` channel when all chunks are merged
+
+Attention:
+	- chunks are expected to be split by line endings
+	- chunk that can't be read is skipped with error
+	- you should cancel associated context to stop before the end of file
+*/
+type ParallelBatchWatcher struct {
+	ctx         context.Context
+	storage     shardedStorage
+	chunkCount  int
+	workerCount int
+	readChunk   ChunkReader
+	done        chan struct{}
+}
+
+func NewParallelBatchWatcher(
+	ctx context.Context, store shardedStorage, chunkCount int, workerCount int, readChunk ChunkReader,
+) (*ParallelBatchWatcher, error) {
+	if ctx.Err() != nil {
+		return nil, fmt.Errorf("ctx is already closed")
+	}
+	if store == nil {
+		return nil, fmt.Errorf("store can't be nil")
+	}
+	if workerCount < 1 {
+		return nil, fmt.Errorf("workerCount should be at least 1")
+	}
+	if readChunk == nil {
+		return nil, fmt.Errorf("readChunk can't be nil")
+	}
+	result := &ParallelBatchWatcher{
+		ctx:         ctx,
+		storage:     store,
+		chunkCount:  chunkCount,
+		workerCount: workerCount,
+		readChunk:   readChunk,
+		done:        make(chan struct{}),
+	}
+	go result.run()
+	return result, nil
+}
+
+/*
+Channel that is closed when all chunks are merged into storage, or watcher is stopped by context.
+*/
+func (p *ParallelBatchWatcher) Done() <-chan struct{} {
+	return p.done
+}
+
+func (p *ParallelBatchWatcher) run() {
+	defer close(p.done)
+	shards := make([]chan *stat.Shard, p.chunkCount)
+	for i := range shards {
+		shards[i] = make(chan *stat.Shard, 1)
+	}
+	// each chunk holds a slot till its shard is merged
+	slots := make(chan struct{}, 2*p.workerCount)
+	chunkIdxs := make(chan int)
+	go func() {
+		defer close(chunkIdxs)
+		for i := 0; i < p.chunkCount; i++ {
+			select {
+			case slots <- struct{}{}:
+			case <-p.ctx.Done():
+				return
+			}
+			chunkIdxs <- i
+		}
+	}()
+
+	workers := &sync.WaitGroup{}
+	for i := 0; i < p.workerCount; i++ {
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			for chunkIdx := range chunkIdxs {
+				shards[chunkIdx] <- p.readShard(chunkIdx)
+			}
+		}()
+	}
+	defer workers.Wait()
+
+	for i := range shards {
+		select {
+		case shard := <-shards[i]:
+			if shard != nil {
+				p.storage.MergeShard(shard)
+			}
+			<-slots
+		case <-p.ctx.Done():
+			return
+		}
+	}
+}
+
+func (p *ParallelBatchWatcher) readShard(chunkIdx int) (result *stat.Shard) {
+	defer pnc.PanicHandle()
+	if p.ctx.Err() != nil {
+		return nil
+	}
+	shard := p.storage.NewShard()
+	readErr := p.readChunk(p.ctx, chunkIdx, shard)
+	if readErr != nil {
+		log.Error("can't read chunk %v, it will be skipped: %v", chunkIdx, readErr)
+		return nil
+	}
+	return shard
+}
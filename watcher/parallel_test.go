@@ -0,0 +1,87 @@
+package watcher
+
+import (
+	"context"
+	"fmt"
+	"github.com/storozhukBM/logstat/common/test"
+	"github.com/storozhukBM/logstat/stat"
+	"math/rand"
+	"testing"
+	"time"
+)
+
+func TestParallelBatchWatcher(t *testing.T) {
+	t.Parallel()
+	var chunks [][]stat.Record
+	for i := 0; i < 20; i++ {
+		var chunk []stat.Record
+		for j := 0; j < 10; j++ {
+			// every chunk starts with the record that is late by one cycle
+			chunk = append(chunk, stat.Record{UnixTime: int64(i*50 + j*5 - 10), Section: fmt.Sprintf("/s%v", j%3)})
+		}
+		chunks = append(chunks, chunk)
+	}
+
+	parallel, parallelErr := stat.NewStorage(10, 1000)
+	test.FailOnError(t, parallelErr)
+	readChunk := func(ctx context.Context, chunkIdx int, shard *stat.Shard) error {
+		// chunks are finished out of order
+		time.Sleep(time.Duration(rand.Intn(5)) * time.Millisecond)
+		if chunkIdx == 7 {
+			panic("expected panic for tests")
+		}
+		for _, record := range chunks[chunkIdx] {
+			shard.Store(record)
+		}
+		return nil
+	}
+	parallelWatcher, watcherErr := NewParallelBatchWatcher(context.Background(), parallel, len(chunks), 4, readChunk)
+	test.FailOnError(t, watcherErr)
+	select {
+	case <-parallelWatcher.Done():
+	case <-time.After(time.Second):
+		test.FailOnError(t, fmt.Errorf("parallel watcher should stop after the last chunk"))
+	}
+
+	// chunk that failed is skipped, so it is skipped in sequentially filled storage too
+	expected, expectedErr := stat.NewStorage(10, 1000)
+	test.FailOnError(t, expectedErr)
+	for chunkIdx, chunk := range chunks {
+		for _, record := range chunk {
+			if chunkIdx != 7 {
+				expected.Store(record)
+			}
+		}
+	}
+	expectedReports := flushReports(expected)
+	test.Equals(t, true, len(expectedReports) > len(chunks), "there should be several reports per chunk")
+	test.Equals(t, expectedReports, flushReports(parallel), "reports should be the same as sequential")
+}
+
+func TestParallelBatchWatcherStopsByContext(t *testing.T) {
+	t.Parallel()
+	storage, storageErr := stat.NewStorage(10, 1000)
+	test.FailOnError(t, storageErr)
+	ctx, cancel := context.WithCancel(context.Background())
+	readChunk := func(ctx context.Context, chunkIdx int, shard *stat.Shard) error {
+		<-ctx.Done()
+		return ctx.Err()
+	}
+	parallelWatcher, watcherErr := NewParallelBatchWatcher(ctx, storage, 100, 2, readChunk)
+	test.FailOnError(t, watcherErr)
+	cancel()
+	select {
+	case <-parallelWatcher.Done():
+	case <-time.After(time.Second):
+		test.FailOnError(t, fmt.Errorf("parallel watcher should stop by context"))
+	}
+}
+
+func flushReports(storage *stat.Storage) []stat.Report {
+	storage.FlushAndClose()
+	var result []stat.Report
+	for report := range storage.Reports() {
+		result = append(result, report)
+	}
+	return result
+}
@@ -17,12 +17,27 @@ type lineReader interface {
 
 type storage interface {
 	Store(r stat.Record)
+	StoreDroppedLines(count uint64)
 }
 
 type parser interface {
 	Parse(line []byte) (stat.Record, error)
 }
 
+type changeNotifier interface {
+	Changes() <-chan struct{}
+}
+
+// reader can optionally count lines it dropped, like too long ones
+type droppedLinesCounter interface {
+	DroppedLines() uint64
+}
+
+// reader can optionally keep unterminated line till its flush deadline, zero deadline means there is no such line
+type unterminatedLineKeeper interface {
+	UnterminatedLineFlushDeadline() time.Time
+}
+
 /*
 A component used to stream new lines from file, parse and store them.
 It starts separate goroutine to track file changes.
@@ -32,14 +47,15 @@ Responsibilities:
 	- gracefully react if the file doesn't exist, is empty or has no new lines
 	- push new lines to the provided parser
 	- feed parsed log record to storage.
+	- feed count of lines dropped by the reader to storage, if reader counts them
+	- wake up on file change notifications, if notifier is provided, or by poll period
+	- wake up in time to flush unterminated line kept by the reader, even if poll period is longer
+	- in batch mode, read lines till the end of file and signal about it via `Done` channel
 
 Attention:
 	- you should cancel associated context to free all attached resources.
-
-Future:
-	- this solution is too straightforward and can have bad latency and energy efficiency
-	capabilities. In the future, it can be replaced by some specialized library with the
-	usage of fsnotify.
+	- with notifier, poll period is used only as a fallback for missed notifications,
+	so it can be much longer than in pure polling mode
 */
 type LogFileWatcher struct {
 	ctx           context.Context
@@ -48,9 +64,57 @@ type LogFileWatcher struct {
 	reader        lineReader
 	storage       storage
 	parser        parser
+	changes       <-chan struct{}
+	done          chan struct{}
+
+	droppedLinesCounter droppedLinesCounter
+	droppedLines        uint64
+
+	unterminatedLineKeeper unterminatedLineKeeper
 }
 
 func NewLogFileWatcher(ctx context.Context, reader lineReader, store storage, parser parser, pollPeriod time.Duration) (*LogFileWatcher, error) {
+	result, err := newLogFileWatcher(ctx, reader, store, parser, nil, pollPeriod)
+	if err != nil {
+		return nil, err
+	}
+	go result.run()
+	return result, nil
+}
+
+/*
+Creates watcher that reads lines only till the end of file and then stops.
+When all lines are stored, `Done` channel is closed, so storage can be flushed.
+It is also used for streams like stdin, that are finished when their writer closes them.
+*/
+func NewBatchLogFileWatcher(ctx context.Context, reader lineReader, store storage, parser parser) (*LogFileWatcher, error) {
+	result, err := newLogFileWatcher(ctx, reader, store, parser, nil, 0)
+	if err != nil {
+		return nil, err
+	}
+	go result.runBatch()
+	return result, nil
+}
+
+func NewNotifiedLogFileWatcher(
+	ctx context.Context, reader lineReader, store storage, parser parser,
+	notifier changeNotifier, pollPeriod time.Duration,
+) (*LogFileWatcher, error) {
+	if notifier == nil {
+		return nil, fmt.Errorf("notifier can't be nil")
+	}
+	result, err := newLogFileWatcher(ctx, reader, store, parser, notifier.Changes(), pollPeriod)
+	if err != nil {
+		return nil, err
+	}
+	go result.run()
+	return result, nil
+}
+
+func newLogFileWatcher(
+	ctx context.Context, reader lineReader, store storage, parser parser,
+	changes <-chan struct{}, pollPeriod time.Duration,
+) (*LogFileWatcher, error) {
 	if ctx.Err() != nil {
 		return nil, fmt.Errorf("ctx is already closed")
 	}
@@ -64,14 +128,25 @@ func NewLogFileWatcher(ctx context.Context, reader lineReader, store storage, pa
 		reader:        reader,
 		storage:       store,
 		parser:        parser,
+		changes:       changes,
+		done:          make(chan struct{}),
 	}
-	go result.run()
+	result.droppedLinesCounter, _ = reader.(droppedLinesCounter)
+	result.unterminatedLineKeeper, _ = reader.(unterminatedLineKeeper)
 	return result, nil
 }
 
+/*
+Channel that is closed when watcher is stopped by context or, in batch mode, when end of file is reached.
+*/
+func (l *LogFileWatcher) Done() <-chan struct{} {
+	return l.done
+}
+
 func (l *LogFileWatcher) run() {
+	defer close(l.done)
 	for l.ctx.Err() == nil {
-		cycleErr := l.cycle()
+		_, cycleErr := l.cycle()
 		if cycleErr != nil {
 			log.Error("error happened: %v", cycleErr)
 			l.waitOnError()
@@ -81,18 +156,39 @@ func (l *LogFileWatcher) run() {
 	}
 }
 
-func (l *LogFileWatcher) cycle() error {
+func (l *LogFileWatcher) runBatch() {
+	defer close(l.done)
+	for l.ctx.Err() == nil {
+		endReached, cycleErr := l.cycle()
+		if cycleErr != nil {
+			// stream reader can be closed to interrupt pending read
+			if l.ctx.Err() == nil {
+				log.Error("error happened: %v", cycleErr)
+			}
+			return
+		}
+		if endReached {
+			return
+		}
+	}
+}
+
+func (l *LogFileWatcher) cycle() (bool, error) {
 	defer pnc.PanicHandle()
 	for l.ctx.Err() == nil {
 		slice, readErr := l.reader.ReadOneLineAsSlice()
+		l.storeDroppedLines()
 		if readErr == io.EOF {
-			return nil
+			return true, nil
 		}
 		if readErr != nil {
-			return readErr
+			return false, readErr
 		}
 
 		record, parseErr := l.parser.Parse(slice)
+		if parseErr == stat.ErrNoRecord {
+			continue
+		}
 		if parseErr != nil {
 			// we should immediately proceed with next line
 			log.Error("parser error happened: %v", parseErr)
@@ -101,16 +197,48 @@ func (l *LogFileWatcher) cycle() error {
 
 		l.storage.Store(record)
 	}
-	return nil
+	return false, nil
+}
+
+func (l *LogFileWatcher) storeDroppedLines() {
+	if l.droppedLinesCounter == nil {
+		return
+	}
+	droppedLines := l.droppedLinesCounter.DroppedLines()
+	if droppedLines == l.droppedLines {
+		return
+	}
+	l.storage.StoreDroppedLines(droppedLines - l.droppedLines)
+	l.droppedLines = droppedLines
 }
 
 func (l *LogFileWatcher) wait() {
+	// `changes` is nil in pure polling mode, so it blocks forever
 	select {
-	case <-time.After(l.pollPeriod):
+	case <-l.changes:
+	case <-time.After(l.waitPeriod()):
 	case <-l.ctx.Done():
 	}
 }
 
+func (l *LogFileWatcher) waitPeriod() time.Duration {
+	if l.unterminatedLineKeeper == nil {
+		return l.pollPeriod
+	}
+	flushDeadline := l.unterminatedLineKeeper.UnterminatedLineFlushDeadline()
+	if flushDeadline.IsZero() {
+		return l.pollPeriod
+	}
+	untilFlush := time.Until(flushDeadline)
+	if untilFlush < 0 {
+		return 0
+	}
+	if untilFlush < l.pollPeriod {
+		return untilFlush
+	}
+	return l.pollPeriod
+}
+
 func (l *LogFileWatcher) waitOnError() {
 	multiplier := time.Duration(l.backOffRandom.Intn(8) + 2)
 	select {
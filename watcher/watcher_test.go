@@ -8,6 +8,7 @@ import (
 	"io"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 )
@@ -55,6 +56,9 @@ func TestLogFileWatcher(t *testing.T) {
 	reader.lines <- []byte("first5")
 	waitForRecord(t, store, "first5")
 
+	reader.lines <- []byte("#: directive without record")
+	waitForRecordTimeout(t, store)
+
 	reader.lines <- []byte("pnc: expected panic for tests")
 	waitForRecordTimeout(t, store)
 
@@ -62,6 +66,84 @@ func TestLogFileWatcher(t *testing.T) {
 	waitForRecord(t, store, "first6")
 }
 
+func TestNotifiedLogFileWatcher(t *testing.T) {
+	t.Parallel()
+	reader := newFileReaderMock()
+	store := newStorageMock()
+	parser := &parserMock{}
+	notifier := &notifierMock{changes: make(chan struct{}, 1)}
+	ctx := context.Background()
+
+	_, watcherErr := NewNotifiedLogFileWatcher(ctx, reader, store, parser, notifier, time.Hour)
+	test.FailOnError(t, watcherErr)
+	waitForRecordTimeout(t, store)
+
+	waitForEOF(t, reader)
+	reader.lines <- []byte("first1")
+	waitForRecordTimeout(t, store)
+	notifier.changes <- struct{}{}
+	waitForRecord(t, store, "first1")
+
+	waitForEOF(t, reader)
+	reader.lines <- []byte("second")
+	waitForRecordTimeout(t, store)
+	notifier.changes <- struct{}{}
+	waitForRecord(t, store, "second")
+
+	_, nilNotifierErr := NewNotifiedLogFileWatcher(ctx, reader, store, parser, nil, time.Hour)
+	test.Equals(t, fmt.Errorf("notifier can't be nil"), nilNotifierErr, "nil notifier should be rejected")
+}
+
+func TestNotifiedLogFileWatcherFlushesUnterminatedLineInTime(t *testing.T) {
+	t.Parallel()
+	reader := &unterminatedLineReaderMock{line: "unterminated", flushDeadline: time.Now().Add(30 * time.Millisecond)}
+	store := newStorageMock()
+	parser := &parserMock{}
+	notifier := &notifierMock{changes: make(chan struct{}, 1)}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// nothing is written anymore, so only flush deadline can wake up the watcher before poll period
+	_, watcherErr := NewNotifiedLogFileWatcher(ctx, reader, store, parser, notifier, time.Hour)
+	test.FailOnError(t, watcherErr)
+	waitForRecordTimeout(t, store)
+	waitForRecord(t, store, "unterminated")
+}
+
+func TestBatchLogFileWatcher(t *testing.T) {
+	t.Parallel()
+	reader := newFileReaderMock()
+	store := newStorageMock()
+	parser := &parserMock{}
+	ctx := context.Background()
+
+	reader.lines <- []byte("first1")
+	reader.lines <- []byte("pnc: expected panic for tests")
+	reader.lines <- []byte("drop: too long line")
+	reader.lines <- []byte("second")
+	reader.lines <- []byte("drop: too long line")
+	batchWatcher, watcherErr := NewBatchLogFileWatcher(ctx, reader, store, parser)
+	test.FailOnError(t, watcherErr)
+
+	select {
+	case <-batchWatcher.Done():
+	case <-time.After(time.Second):
+		test.FailOnError(t, fmt.Errorf("batch watcher should stop at the end of file"))
+	}
+	waitForRecord(t, store, "first1")
+	waitForRecord(t, store, "second")
+	waitForRecordTimeout(t, store)
+	test.Equals(t, uint64(2), atomic.LoadUint64(&store.droppedLines), "dropped lines should be stored")
+}
+
+type notifierMock struct {
+	changes chan struct{}
+}
+
+func (n *notifierMock) Changes() <-chan struct{} {
+	return n.changes
+}
+
 type parserMock struct{}
 
 func (p *parserMock) Parse(line []byte) (stat.Record, error) {
@@ -69,6 +151,9 @@ func (p *parserMock) Parse(line []byte) (stat.Record, error) {
 	if strings.HasPrefix(lineStr, "err:") {
 		return stat.Record{}, fmt.Errorf("can't parse line: %v", lineStr)
 	}
+	if strings.HasPrefix(lineStr, "#:") {
+		return stat.Record{}, stat.ErrNoRecord
+	}
 	if strings.HasPrefix(lineStr, "pnc:") {
 		panic(fmt.Errorf("can't parse line: %v", lineStr))
 	}
@@ -76,7 +161,8 @@ func (p *parserMock) Parse(line []byte) (stat.Record, error) {
 }
 
 type storageMock struct {
-	records chan stat.Record
+	records      chan stat.Record
+	droppedLines uint64
 }
 
 func newStorageMock() *storageMock {
@@ -90,6 +176,10 @@ func (p *storageMock) Store(r stat.Record) {
 	p.records <- r
 }
 
+func (p *storageMock) StoreDroppedLines(count uint64) {
+	atomic.AddUint64(&p.droppedLines, count)
+}
+
 func waitForRecord(t *testing.T, storage *storageMock, expSection string) {
 	{
 		var timeout time.Time
@@ -122,15 +212,18 @@ func waitForRecordTimeout(t *testing.T, storage *storageMock) {
 }
 
 type fileReaderMock struct {
-	mu    sync.Mutex
-	lines chan []byte
-	pnc   bool
-	err   error
+	mu           sync.Mutex
+	lines        chan []byte
+	eofs         chan struct{}
+	pnc          bool
+	err          error
+	droppedLines uint64
 }
 
 func newFileReaderMock() *fileReaderMock {
 	result := &fileReaderMock{
 		lines: make(chan []byte, 100),
+		eofs:  make(chan struct{}, 1),
 	}
 	return result
 }
@@ -157,8 +250,53 @@ func (r *fileReaderMock) ReadOneLineAsSlice() ([]byte, error) {
 	if r.err != nil {
 		return nil, r.err
 	}
-	if len(r.lines) == 0 {
+	for len(r.lines) > 0 {
+		line := <-r.lines
+		if !strings.HasPrefix(string(line), "drop:") {
+			return line, nil
+		}
+		r.droppedLines++
+	}
+	// signal that reader is drained, tests wait for it to be sure that next line is read only after notification
+	select {
+	case r.eofs <- struct{}{}:
+	default:
+	}
+	return nil, io.EOF
+}
+
+func waitForEOF(t *testing.T, reader *fileReaderMock) {
+	select {
+	case <-reader.eofs:
+	case <-time.After(time.Second):
+		test.FailOnError(t, fmt.Errorf("reader wasn't drained"))
+	}
+}
+
+func (r *fileReaderMock) DroppedLines() uint64 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.droppedLines
+}
+
+type unterminatedLineReaderMock struct {
+	mu            sync.Mutex
+	line          string
+	flushDeadline time.Time
+}
+
+func (r *unterminatedLineReaderMock) ReadOneLineAsSlice() ([]byte, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.flushDeadline.IsZero() || time.Now().Before(r.flushDeadline) {
 		return nil, io.EOF
 	}
-	return <-r.lines, nil
+	r.flushDeadline = time.Time{}
+	return []byte(r.line), nil
+}
+
+func (r *unterminatedLineReaderMock) UnterminatedLineFlushDeadline() time.Time {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.flushDeadline
 }